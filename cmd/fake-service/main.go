@@ -18,14 +18,17 @@ package main
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/googleinterns/recomator/pkg/automation"
 	"github.com/jinzhu/copier"
 	"github.com/segmentio/ksuid"
 
@@ -217,6 +220,39 @@ func getFakeRecommendations() []*gcloudRecommendation {
 	return result[:numberOfFakeRecommendations]
 }
 
+// parseWeights parses weights in the format "name=weight,name=weight".
+func parseWeights(value string) (map[string]float64, error) {
+	weights := make(map[string]float64)
+	if value == "" {
+		return weights, nil
+	}
+	for _, item := range strings.Split(value, ",") {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("weight %q must have the format name=weight", item)
+		}
+		weight, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		weights[parts[0]] = weight
+	}
+	return weights, nil
+}
+
+// generateFakeRecommendations returns recommendations generated by automation.GenerateFakeRecommendations.
+func generateFakeRecommendations(config *automation.FakeRecommendationsConfig) []*gcloudRecommendation {
+	recs, err := automation.GenerateFakeRecommendations(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var result []*gcloudRecommendation
+	for _, rec := range recs {
+		result = append(result, (*gcloudRecommendation)(rec))
+	}
+	return result
+}
+
 type recommendationsMap struct {
 	data  map[string][]*gcloudRecommendation
 	mutex sync.Mutex
@@ -299,12 +335,34 @@ func corsMiddleware() gin.HandlerFunc {
 }
 
 func main() {
+	config := automation.DefaultFakeRecommendationsConfig()
+	generate := flag.Bool("generate", false, "generate random recommendations instead of the predefined ones")
+	flag.IntVar(&config.Count, "count", config.Count, "number of generated recommendations")
+	flag.Int64Var(&config.Seed, "seed", config.Seed, "seed of generated recommendations")
+	flag.Float64Var(&config.MeanMonthlySavings, "mean-savings", config.MeanMonthlySavings, "mean monthly savings of generated recommendations in USD")
+	recommenderWeights := flag.String("recommenders", "", "relative frequencies of generated recommenders, e.g. google.compute.instance.IdleResourceRecommender=3,google.compute.disk.IdleResourceRecommender=1")
+	stateWeights := flag.String("states", "", "relative frequencies of states of generated recommendations, e.g. ACTIVE=9,SUCCEEDED=1")
+	flag.Parse()
+
+	var err error
+	config.Weights, err = parseWeights(*recommenderWeights)
+	if err != nil {
+		log.Fatal(err)
+	}
+	config.StateWeights, err = parseWeights(*stateWeights)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	cachedCalls := recommendationsMap{data: make(map[string][]*gcloudRecommendation)} // the key is anotherPageToken
 	listRequestsInProcess := listRequestsMap{data: make(map[string]*mockListService)} // the key is AccessToken, but in this version, token is always ""
 
 	applyRequestsInProcess := applyRequestsMap{data: make(map[string]*mockApplyService)} // the key is recommendation names
 
 	recommendations := getFakeRecommendations()
+	if *generate {
+		recommendations = generateFakeRecommendations(config)
+	}
 
 	router := gin.Default()
 	router.Use(corsMiddleware())
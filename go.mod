@@ -10,6 +10,7 @@ require (
 	github.com/stretchr/testify v1.6.2-0.20200814104551-cf221cc87575
 	go.uber.org/config v1.4.0
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
+	golang.org/x/text v0.3.2
 	golang.org/x/tools v0.0.0-20200714190737-9048b464a08d // indirect
 	google.golang.org/api v0.29.0
 	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776 // indirect
@@ -17,6 +17,7 @@ limitations under the License.
 package automation
 
 import (
+	"context"
 	"net/http"
 	"strings"
 
@@ -25,8 +26,17 @@ import (
 	"google.golang.org/api/serviceusage/v1"
 )
 
+const (
+	computeAPI         = "compute.googleapis.com"
+	iamAPI             = "iam.googleapis.com"
+	recommenderAPI     = "recommender.googleapis.com"
+	resourceManagerAPI = "cloudresourcemanager.googleapis.com"
+	serviceUsageAPI    = "serviceusage.googleapis.com"
+	sqlAdminAPI        = "sqladmin.googleapis.com"
+)
+
 // requiredAPIs are APIs required for googleService
-var requiredAPIs = []string{"compute.googleapis.com", "recommender.googleapis.com", "cloudresourcemanager.googleapis.com"}
+var requiredAPIs = []string{computeAPI, recommenderAPI, resourceManagerAPI}
 
 const (
 	// RequirementFailed corresponds to the failed status of requirement
@@ -48,11 +58,10 @@ type Requirement struct {
 // services.get permission is required for this method.
 // First requirement in returned list will be related to Service Usage API.
 // If it is not enabled or user doesn't have services.get permission other APIs won't be checked.
-func (s *googleService) ListAPIRequirements(project string, apis []string) ([]*Requirement, error) {
+func (s *googleService) ListAPIRequirements(ctx context.Context, project string, apis []string) ([]*Requirement, error) {
 	servicesService := serviceusage.NewServicesService(s.serviceUsageService)
-	serviceUsageAPI := "serviceusage.googleapis.com"
 	serviceUsageName := "Service Usage API and services.get permission"
-	_, err := servicesService.Get("projects/" + project + "/services/" + serviceUsageAPI).Do()
+	_, err := servicesService.Get("projects/" + project + "/services/" + serviceUsageAPI).Context(ctx).Do()
 	if err != nil {
 		googleErr := err.(*googleapi.Error)
 		if googleErr.Code == http.StatusForbidden {
@@ -69,7 +78,7 @@ func (s *googleService) ListAPIRequirements(project string, apis []string) ([]*R
 		Status: RequirementCompleted,
 	}}
 	for _, api := range apis {
-		response, err := servicesService.Get("projects/" + project + "/services/" + api).Do()
+		response, err := servicesService.Get("projects/" + project + "/services/" + api).Context(ctx).Do()
 		if err != nil {
 			return nil, err
 		}
@@ -92,12 +101,21 @@ func (s *googleService) ListAPIRequirements(project string, apis []string) ([]*R
 	return result, nil
 }
 
-// requiredPermissions are permissions required for googleService
+// requiredPermissions are permissions required for googleService to list and apply recommendations of googleRecommenders,
+// projects without them are reported as failed. Permissions of optional recommenders are in optionalPermissions,
+// permissions of other supported resources, e.g. IAM policies, are checked by Apply in dry run.
 var requiredPermissions = [][]string{
 	[]string{"compute.instances.setMachineType"},                              // ChangeMachineType
-	[]string{"compute.disks.createSnapshot", "compute.snapshots.create"},      // CreateSnapshot
-	[]string{"compute.disks.delete"},                                          // DeleteDisk
+	[]string{"compute.disks.createSnapshot", "compute.snapshots.create"},      // CreateSnapshot, CreateRegionalSnapshot
+	[]string{"compute.disks.delete"},                                          // DeleteDisk, DeleteRegionalDisk
+	[]string{"compute.instances.delete"},                                      // DeleteInstance
+	[]string{"compute.snapshots.delete"},                                      // DeleteSnapshot
+	[]string{"compute.disks.get"},                                             // GetDisk, GetRegionalDisk
 	[]string{"compute.instances.get"},                                         // GetInstance
+	[]string{"compute.disks.list"},                                            // ListDisks
+	[]string{"compute.instances.list"},                                        // ListInstances
+	[]string{"compute.machineTypes.list"},                                     // ListMachineTypes
+	[]string{"recommender.usageCommitmentRecommendations.list"},               // ListRecommendations for google.compute.commitment.UsageCommitmentRecommender
 	[]string{"recommender.computeDiskIdleResourceRecommendations.list"},       // ListRecommendations for google.compute.disk.IdleResourceRecommender
 	[]string{"recommender.computeInstanceIdleResourceRecommendations.list"},   // ListRecommendations for google.compute.instance.IdleResourceRecommender
 	[]string{"recommender.computeInstanceMachineTypeRecommendations.list"},    // ListRecommendations for google.compute.instance.MachineTypeRecommender
@@ -106,22 +124,53 @@ var requiredPermissions = [][]string{
 	[]string{"recommender.computeInstanceMachineTypeRecommendations.get"},     // GetRecommendation for google.compute.instance.MachineTypeRecommender
 	[]string{"recommender.computeDiskIdleResourceRecommendations.update"},     // MarkClaimed/Failed/Suceeded for google.compute.disk.IdleResourceRecommender
 	[]string{"recommender.computeInstanceIdleResourceRecommendations.update"}, // MarkClaimed/Failed/Suceeded for google.compute.instance.IdleResourceRecommender
-	[]string{"recommender.computeInstanceMachineTypeRecommendations.update"},  // ListRecommendations for google.compute.instance.MachineTypeRecommender
+	[]string{"recommender.computeInstanceMachineTypeRecommendations.update"},  // MarkClaimed/Failed/Suceeded for google.compute.instance.MachineTypeRecommender
 	[]string{"compute.regions.list"},                                          // ListRegionsNames
+	[]string{"compute.snapshots.list"},                                        // ListSnapshots
+	[]string{"compute.disks.setLabels"},                                       // SetDiskLabels
 	[]string{"compute.zones.list"},                                            // ListZonesNames
+	[]string{"compute.instances.start"},                                       // StartInstance
 	[]string{"compute.instances.stop"},                                        // StopInstance
 }
 
+// optionalPermissions are permissions required to list and apply recommendations of optional recommenders,
+// in the format of requiredPermissions. Projects without them are not reported as failed,
+// the recommenders are skipped for them instead, see ProjectRequirements.SkippedRecommenders.
+var optionalPermissions = map[string][][]string{
+	"google.cloudsql.instance.IdleRecommender": {
+		{"cloudsql.instances.get"},    // GetSQLInstance
+		{"cloudsql.instances.update"}, // StopSQLInstance
+		{"recommender.cloudsqlIdleInstanceRecommendations.list"},
+		{"recommender.cloudsqlIdleInstanceRecommendations.get"},
+		{"recommender.cloudsqlIdleInstanceRecommendations.update"},
+	},
+	"google.cloudsql.instance.OverprovisionedRecommender": {
+		{"cloudsql.instances.get"},    // GetSQLInstance
+		{"cloudsql.instances.update"}, // ChangeSQLInstanceTier
+		{"recommender.cloudsqlOverprovisionedInstanceRecommendations.list"},
+		{"recommender.cloudsqlOverprovisionedInstanceRecommendations.get"},
+		{"recommender.cloudsqlOverprovisionedInstanceRecommendations.update"},
+	},
+	"google.compute.image.IdleResourceRecommender": {
+		{"compute.images.delete"}, // DeleteImage
+		{"compute.images.get"},    // GetImage
+		{"compute.images.list"},   // ListImages
+		{"recommender.computeImageIdleResourceRecommendations.list"},
+		{"recommender.computeImageIdleResourceRecommendations.get"},
+		{"recommender.computeImageIdleResourceRecommendations.update"},
+	},
+}
+
 // ListPermissionRequirements returns the list of permissions and their statuses for the project.
 // No permissions required for this method.
-func (s *googleService) ListPermissionRequirements(project string, permissions [][]string) ([]*Requirement, error) {
+func (s *googleService) ListPermissionRequirements(ctx context.Context, project string, permissions [][]string) ([]*Requirement, error) {
 	var result []*Requirement
 	for _, permissionsGroup := range permissions {
 		status := RequirementCompleted
 		errorMessage := ""
 		request := cloudresourcemanager.TestIamPermissionsRequest{Permissions: permissionsGroup}
 		projectsService := cloudresourcemanager.NewProjectsService(s.resourceManagerService)
-		response, err := projectsService.TestIamPermissions(project, &request).Do()
+		response, err := projectsService.TestIamPermissions(project, &request).Context(ctx).Do()
 		if err != nil {
 			return nil, err
 		}
@@ -137,15 +186,18 @@ func (s *googleService) ListPermissionRequirements(project string, permissions [
 }
 
 // ProjectRequirements contains information about permissions for the user for the project.
+// SkippedRecommenders are recommenders of optionalPermissions not listed for the project,
+// because some of their permissions are missing, sorted.
 type ProjectRequirements struct {
-	Project      string         `json:"project"`
-	Requirements []*Requirement `json:"requirements"`
+	Project             string         `json:"project"`
+	Requirements        []*Requirement `json:"requirements"`
+	SkippedRecommenders []string       `json:"skippedRecommenders,omitempty"`
 }
 
 // ListProjectRequirements is a function that lists all permissions and APIs and their statuses for a project.
 // If all statuses are equal to RequirementCompleted, user has all required permissions.
-func ListProjectRequirements(s GoogleService, project string) ([]*Requirement, error) {
-	requirements, err := s.ListAPIRequirements(project, requiredAPIs)
+func ListProjectRequirements(ctx context.Context, s GoogleService, project string) ([]*Requirement, error) {
+	requirements, err := s.ListAPIRequirements(ctx, project, requiredAPIs)
 	if err != nil {
 		return nil, err
 	}
@@ -155,7 +207,7 @@ func ListProjectRequirements(s GoogleService, project string) ([]*Requirement, e
 		}
 	}
 
-	permissions, err := s.ListPermissionRequirements(project, requiredPermissions)
+	permissions, err := s.ListPermissionRequirements(ctx, project, requiredPermissions)
 	if err != nil {
 		return nil, err
 	}
@@ -163,17 +215,56 @@ func ListProjectRequirements(s GoogleService, project string) ([]*Requirement, e
 	return requirements, nil
 }
 
+// requirementsCompleted checks that all requirements are completed.
+func requirementsCompleted(requirements []*Requirement) bool {
+	for _, req := range requirements {
+		if req.Status == RequirementFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// listSkippedRecommenders returns the sorted recommenders of optionalPermissions,
+// for which some of the permissions are missing in the project.
+func listSkippedRecommenders(ctx context.Context, s GoogleService, project string) ([]string, error) {
+	var skipped []string
+	for _, recommenderID := range googleRecommenders {
+		permissions, ok := optionalPermissions[recommenderID]
+		if !ok {
+			continue
+		}
+		requirements, err := s.ListPermissionRequirements(ctx, project, permissions)
+		if err != nil {
+			return nil, err
+		}
+		if !requirementsCompleted(requirements) {
+			skipped = append(skipped, recommenderID)
+		}
+	}
+	return skipped, nil
+}
+
 // ListRequirements lists the requirements and their statuses for every project.
+// For projects with all requirements completed, optional recommenders without permissions are listed
+// in SkippedRecommenders.
 // task structure tracks how many projects have been processed already.
-func ListRequirements(s GoogleService, projects []string, task *Task) ([]*ProjectRequirements, error) {
+func ListRequirements(ctx context.Context, s GoogleService, projects []string, task *Task) ([]*ProjectRequirements, error) {
 	task.SetNumberOfSubtasks(len(projects))
 	var result []*ProjectRequirements
 	for _, project := range projects {
-		requirements, err := ListProjectRequirements(s, project)
+		requirements, err := ListProjectRequirements(ctx, s, project)
 		if err != nil {
 			return nil, err
 		}
-		result = append(result, &ProjectRequirements{project, requirements})
+		projectRequirements := &ProjectRequirements{Project: project, Requirements: requirements}
+		if requirementsCompleted(requirements) {
+			projectRequirements.SkippedRecommenders, err = listSkippedRecommenders(ctx, s, project)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, projectRequirements)
 		task.IncrementDone()
 	}
 	task.SetAllDone()
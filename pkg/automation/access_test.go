@@ -17,6 +17,7 @@ limitations under the License.
 package automation
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -29,7 +30,7 @@ type mockAllCompletedService struct {
 	GoogleService
 }
 
-func (s *mockAllCompletedService) ListAPIRequirements(project string, apis []string) ([]*Requirement, error) {
+func (s *mockAllCompletedService) ListAPIRequirements(ctx context.Context, project string, apis []string) ([]*Requirement, error) {
 	var result []*Requirement
 	for _, api := range apis {
 		result = append(result, &Requirement{Name: api, Status: RequirementCompleted})
@@ -37,7 +38,7 @@ func (s *mockAllCompletedService) ListAPIRequirements(project string, apis []str
 	return result, nil
 }
 
-func (s *mockAllCompletedService) ListPermissionRequirements(project string, permissions [][]string) ([]*Requirement, error) {
+func (s *mockAllCompletedService) ListPermissionRequirements(ctx context.Context, project string, permissions [][]string) ([]*Requirement, error) {
 	var result []*Requirement
 	for _, perm := range permissions {
 		result = append(result, &Requirement{Name: perm[0], Status: RequirementCompleted})
@@ -62,7 +63,7 @@ func checkAllRequirementsCompleted(t *testing.T, reqs []*Requirement) {
 
 func TestAllCompleted(t *testing.T) {
 	mock := &mockAllCompletedService{}
-	reqs, err := ListProjectRequirements(mock, "")
+	reqs, err := ListProjectRequirements(context.Background(), mock, "")
 	if assert.NoError(t, err, "No error from ListProjectRequirements expected") {
 		checkAllRequirementsCompleted(t, reqs)
 	}
@@ -75,11 +76,11 @@ type mockService struct {
 	listPermissionsCalled bool
 }
 
-func (s *mockService) ListAPIRequirements(project string, apis []string) ([]*Requirement, error) {
+func (s *mockService) ListAPIRequirements(ctx context.Context, project string, apis []string) ([]*Requirement, error) {
 	return s.apiReqs, nil
 }
 
-func (s *mockService) ListPermissionRequirements(project string, permissions [][]string) ([]*Requirement, error) {
+func (s *mockService) ListPermissionRequirements(ctx context.Context, project string, permissions [][]string) ([]*Requirement, error) {
 	s.listPermissionsCalled = true
 	return s.permissionReqs, nil
 }
@@ -89,7 +90,7 @@ var failedRequirements = []*Requirement{&Requirement{Status: RequirementFailed}}
 func TestFailAPIRequirements(t *testing.T) {
 	mock := &mockService{apiReqs: failedRequirements}
 
-	reqs, err := ListProjectRequirements(mock, "")
+	reqs, err := ListProjectRequirements(context.Background(), mock, "")
 	if assert.NoError(t, err, "ListProjectRequirements should not return error") {
 		assert.ElementsMatch(t, mock.apiReqs, reqs, "ListProjectRequirements should return api requirements")
 		assert.False(t, mock.listPermissionsCalled, "ListPermissionRequirements should not be called if api reqs are failed")
@@ -100,7 +101,7 @@ func TestFailPermissionRequirements(t *testing.T) {
 	mock := &mockService{apiReqs: []*Requirement{&Requirement{Status: RequirementCompleted}},
 		permissionReqs: failedRequirements}
 
-	reqs, err := ListProjectRequirements(mock, "")
+	reqs, err := ListProjectRequirements(context.Background(), mock, "")
 	if assert.NoError(t, err, "ListProjectRequirements should not return error") {
 		assert.ElementsMatch(t, append(mock.apiReqs, mock.permissionReqs...), reqs,
 			"ListProjectRequirements should return api & permission requirements, if api requirements are completed")
@@ -112,7 +113,7 @@ type errorAPIService struct {
 	err error
 }
 
-func (s *errorAPIService) ListAPIRequirements(project string, apis []string) ([]*Requirement, error) {
+func (s *errorAPIService) ListAPIRequirements(ctx context.Context, project string, apis []string) ([]*Requirement, error) {
 	return nil, s.err
 }
 
@@ -121,18 +122,18 @@ type errorPermissionService struct {
 	err error
 }
 
-func (s *errorPermissionService) ListAPIRequirements(project string, apis []string) ([]*Requirement, error) {
+func (s *errorPermissionService) ListAPIRequirements(ctx context.Context, project string, apis []string) ([]*Requirement, error) {
 	return nil, nil
 }
 
-func (s *errorPermissionService) ListPermissionRequirements(project string, permissions [][]string) ([]*Requirement, error) {
+func (s *errorPermissionService) ListPermissionRequirements(ctx context.Context, project string, permissions [][]string) ([]*Requirement, error) {
 	return nil, s.err
 }
 
 func TestErrorAPIRequirements(t *testing.T) {
 	for _, mock := range []GoogleService{&errorAPIService{err: errors.New("hi! i'm error")},
 		&errorPermissionService{err: errors.New("another error")}} {
-		reqs, err := ListProjectRequirements(mock, "")
+		reqs, err := ListProjectRequirements(context.Background(), mock, "")
 		if assert.Error(t, err, "ListProjectRequirements should result in error") {
 			assert.Nil(t, reqs, "Only one of returned values should be non-nil")
 		}
@@ -161,13 +162,13 @@ func getService(project string) GoogleService {
 	return service
 }
 
-func (s *mockProjectService) ListAPIRequirements(project string, apis []string) ([]*Requirement, error) {
-	rec, err := getService(project).ListAPIRequirements(project, apis)
+func (s *mockProjectService) ListAPIRequirements(ctx context.Context, project string, apis []string) ([]*Requirement, error) {
+	rec, err := getService(project).ListAPIRequirements(ctx, project, apis)
 	return rec, err
 }
 
-func (s *mockProjectService) ListPermissionRequirements(project string, permissions [][]string) ([]*Requirement, error) {
-	rec, err := getService(project).ListPermissionRequirements(project, permissions)
+func (s *mockProjectService) ListPermissionRequirements(ctx context.Context, project string, permissions [][]string) ([]*Requirement, error) {
+	rec, err := getService(project).ListPermissionRequirements(ctx, project, permissions)
 	return rec, err
 }
 
@@ -185,7 +186,7 @@ func TestListRequirements(t *testing.T) {
 			}
 
 			task := &Task{}
-			reqs, err := ListRequirements(&mockProjectService{}, projects, task)
+			reqs, err := ListRequirements(context.Background(), &mockProjectService{}, projects, task)
 			if assert.NoError(t, err, "No error expected from ListRequirements") {
 				var actualProjects []string
 				for _, req := range reqs {
@@ -211,7 +212,7 @@ func TestListRequirements(t *testing.T) {
 func TestErrorListRequirements(t *testing.T) {
 	projects := []string{"ok", errorProject, failedProject}
 	task := &Task{}
-	reqs, err := ListRequirements(&mockProjectService{}, projects, task)
+	reqs, err := ListRequirements(context.Background(), &mockProjectService{}, projects, task)
 	if assert.Error(t, err) {
 		assert.Nil(t, reqs, "Only one value should be non-nil")
 		done, all := task.GetProgress()
@@ -0,0 +1,183 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Anonymizer replaces identifying information in strings of exported data,
+// so that users can share it with maintainers without leaking details of their infrastructure.
+// Implementations must be deterministic, so that the same name is replaced the same way in the whole export.
+type Anonymizer interface {
+	// returns s with identifying information replaced
+	Anonymize(s string) string
+}
+
+// anonymizedCollections are collections in resource names whose members are anonymized,
+// locations and recommenders are kept, because they are needed to reproduce problems.
+var anonymizedCollections = []string{
+	"commitments", "disks", "folders", "images", "instanceGroupManagers", "instanceGroups", "instanceTemplates",
+	"instances", "networks", "organizations", "projects", "snapshots", "subnetworks",
+}
+
+var (
+	resourceNameRegexp = regexp.MustCompile(`\b(` + strings.Join(anonymizedCollections, "|") + `)/([^/\s"']+)`)
+	emailRegexp        = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]+`)
+	ipCandidateRegexp  = regexp.MustCompile(`[0-9A-Fa-f:.]*[:.][0-9A-Fa-f:.]*`)
+)
+
+// keptFields are fields of exported JSON whose values are never anonymized, because they are
+// enumerations and types needed to interpret the data, e.g. "action": "test" stays as is even for the project "test".
+var keptFields = map[string]bool{
+	"action": true, "asset_type": true, "category": true, "currencyCode": true, "kind": true, "path": true,
+	"recommenderSubtype": true, "resourceType": true, "state": true, "status": true,
+}
+
+// redactedIP replaces IP addresses in anonymized strings.
+const redactedIP = "redacted-ip"
+
+// hashingAnonymizer implements Anonymizer replacing names by their salted hashes.
+// Names seen in resource names are also replaced wherever they are used alone, e.g. in descriptions.
+type hashingAnonymizer struct {
+	salt  string
+	names map[string]bool
+}
+
+// NewHashingAnonymizer creates new Anonymizer replacing names of projects, resources and members
+// by stable hashes, e.g. "anon-1f2e3d4c5b", and IP addresses by "redacted-ip".
+// The same salt gives the same hashes, so anonymized exports of the same user can be compared.
+// The anonymizer remembers names it has seen and is not safe for concurrent use.
+func NewHashingAnonymizer(salt string) Anonymizer {
+	return &hashingAnonymizer{salt: salt, names: make(map[string]bool)}
+}
+
+// hash returns the stable replacement of name.
+func (a *hashingAnonymizer) hash(name string) string {
+	sum := sha256.Sum256([]byte(a.salt + name))
+	return "anon-" + hex.EncodeToString(sum[:5])
+}
+
+// observe records names used in resource names of s, see anonymizeJSON.
+func (a *hashingAnonymizer) observe(s string) {
+	for _, match := range resourceNameRegexp.FindAllStringSubmatch(s, -1) {
+		a.names[match[2]] = true
+	}
+}
+
+func (a *hashingAnonymizer) Anonymize(s string) string {
+	s = ipCandidateRegexp.ReplaceAllStringFunc(s, func(candidate string) string {
+		if net.ParseIP(candidate) != nil {
+			return redactedIP
+		}
+		return candidate
+	})
+	s = emailRegexp.ReplaceAllStringFunc(s, a.hash)
+	s = resourceNameRegexp.ReplaceAllStringFunc(s, func(match string) string {
+		parts := resourceNameRegexp.FindStringSubmatch(match)
+		a.names[parts[2]] = true
+		return parts[1] + "/" + a.hash(parts[2])
+	})
+	if a.names[s] {
+		return a.hash(s)
+	}
+	// longer names first, so that a name containing another one is replaced as a whole
+	var names []string
+	for name := range a.names {
+		if strings.Contains(s, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	for _, name := range names {
+		s = regexp.MustCompile(`(^|[^A-Za-z0-9-])`+regexp.QuoteMeta(name)+`($|[^A-Za-z0-9-])`).
+			ReplaceAllString(s, "${1}"+a.hash(name)+"${2}")
+	}
+	return s
+}
+
+// anonymizeJSON returns v encoded to JSON with all string values replaced by anonymizer.
+// If anonymizer observes strings before anonymizing them, as the hashing anonymizer does,
+// all strings are observed first, so that names are replaced regardless of the order they appear in.
+func anonymizeJSON(anonymizer Anonymizer, v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	err = json.Unmarshal(data, &value)
+	if err != nil {
+		return nil, err
+	}
+	if observer, ok := anonymizer.(interface{ observe(s string) }); ok {
+		mapStrings(value, func(s string) string {
+			observer.observe(s)
+			return s
+		})
+	}
+	return mapStrings(value, anonymizer.Anonymize), nil
+}
+
+// mapStrings replaces string values in the decoded JSON value by results of f.
+// Keys of objects and values of keptFields are kept.
+func mapStrings(value interface{}, f func(s string) string) interface{} {
+	switch value := value.(type) {
+	case string:
+		return f(value)
+	case []interface{}:
+		for i := range value {
+			value[i] = mapStrings(value[i], f)
+		}
+	case map[string]interface{}:
+		for key := range value {
+			if !keptFields[key] {
+				value[key] = mapStrings(value[key], f)
+			}
+		}
+	}
+	return value
+}
+
+// ExportOption is the option of ExportAssets and WriteRecommendationsJSON.
+type ExportOption func(c *exportConfig)
+
+// exportConfig contains the configuration of exports.
+type exportConfig struct {
+	anonymizer Anonymizer
+}
+
+func newExportConfig(options []ExportOption) *exportConfig {
+	config := &exportConfig{}
+	for _, option := range options {
+		option(config)
+	}
+	return config
+}
+
+// WithAnonymizer makes exports replace identifying information using anonymizer,
+// e.g. the one created by NewHashingAnonymizer.
+func WithAnonymizer(anonymizer Anonymizer) ExportOption {
+	return func(c *exportConfig) {
+		c.anonymizer = anonymizer
+	}
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashingAnonymizer(t *testing.T) {
+	anonymizer := NewHashingAnonymizer("salt")
+	project, instance := anonymizer.Anonymize("projects/rightsizer-test"), anonymizer.Anonymize("instances/alicja-test")
+	assert.NotContains(t, project, "rightsizer-test")
+	assert.Equal(t, project, NewHashingAnonymizer("salt").Anonymize("projects/rightsizer-test"), "Hashes should be stable")
+	assert.NotEqual(t, project, NewHashingAnonymizer("pepper").Anonymize("projects/rightsizer-test"), "Hashes should depend on salt")
+
+	assert.Equal(t, "//compute.googleapis.com/"+project+"/zones/us-east1-b/"+instance,
+		anonymizer.Anonymize("//compute.googleapis.com/projects/rightsizer-test/zones/us-east1-b/instances/alicja-test"),
+		"Locations should be kept")
+	assert.Equal(t, "Stop "+strings.TrimPrefix(instance, "instances/")+" at redacted-ip, ask redacted-ip",
+		anonymizer.Anonymize("Stop alicja-test at 10.128.0.2, ask 2001:db8::1"))
+	assert.NotContains(t, anonymizer.Anonymize("user:alice@example.com"), "alice")
+	assert.Equal(t, "2020-07-13T06:41:17Z", anonymizer.Anonymize("2020-07-13T06:41:17Z"))
+}
+
+func TestWriteAnonymizedRecommendationsJSON(t *testing.T) {
+	var buffer bytes.Buffer
+	rec := machineTypeRecommendation()
+	rec.Description = "Save cost by changing machine type of alicja-test."
+	err := WriteRecommendationsJSON(&buffer, []*gcloudRecommendation{rec}, WithAnonymizer(NewHashingAnonymizer("")))
+	if assert.NoError(t, err) {
+		assert.NotContains(t, buffer.String(), "alicja-test")
+		assert.NotContains(t, buffer.String(), "rightsizer-test")
+		assert.Contains(t, buffer.String(), `"action":"test"`, "Operations should be kept")
+		assert.Contains(t, buffer.String(), "google.compute.instance.MachineTypeRecommender")
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Applicability is the result of checking whether the recommendation can be applied now.
+// Problems describe why it can't be applied.
+type Applicability struct {
+	Recommendation string   `json:"recommendation"`
+	Problems       []string `json:"problems"`
+}
+
+// Applicable returns whether no problems were found.
+func (a *Applicability) Applicable() bool {
+	return len(a.Problems) == 0
+}
+
+// modifiedResource returns the name of the resource modified by the call, e.g. "projects/p/zones/z/disks/d".
+func modifiedResource(call *OperationCall) string {
+	if isRegionalCall(call) {
+		return fmt.Sprintf("projects/%s/regions/%s/disks/%s", call.Project, call.Zone, call.Resource)
+	}
+	if call.Method == deleteImageMethod {
+		return fmt.Sprintf("projects/%s/global/images/%s", call.Project, call.Resource)
+	}
+	if isSQLCall(call) {
+		return fmt.Sprintf("projects/%s/instances/%s", call.Project, call.Resource)
+	}
+	if isIAMCall(call) || call.Method == deleteProjectMethod {
+		return "projects/" + call.Project
+	}
+	collection := "instances"
+	if call.Method == createSnapshotMethod || call.Method == deleteDiskMethod {
+		collection = "disks"
+	}
+	return fmt.Sprintf("projects/%s/zones/%s/%s/%s", call.Project, call.Zone, collection, call.Resource)
+}
+
+// isRegionalCall returns whether the call modifies a regional disk.
+func isRegionalCall(call *OperationCall) bool {
+	return call.Method == createRegionalSnapshotMethod || call.Method == deleteRegionalDiskMethod
+}
+
+// resourceExists returns whether the resource modified by the call exists.
+func resourceExists(ctx context.Context, service GoogleService, call *OperationCall) (bool, error) {
+	var err error
+	switch {
+	case isRegionalCall(call):
+		_, err = service.GetRegionalDisk(ctx, call.Project, call.Zone, call.Resource)
+	case call.Method == deleteImageMethod:
+		_, err = service.GetImage(ctx, call.Project, call.Resource)
+	case isSQLCall(call):
+		_, err = service.GetSQLInstance(ctx, call.Project, call.Resource)
+	case isIAMCall(call) || call.Method == deleteProjectMethod:
+		_, err = service.GetProjectIAMPolicy(ctx, call.Project)
+	case call.Method == createSnapshotMethod || call.Method == deleteDiskMethod:
+		_, err = service.GetDisk(ctx, call.Project, call.Zone, call.Resource)
+	default:
+		_, err = service.GetInstance(ctx, call.Project, call.Zone, call.Resource)
+	}
+	if isNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// CheckApplicability checks that the recommendation is valid and active, all its operations are supported,
+// the resources it modifies exist and its test operations pass, without claiming it or modifying resources.
+// Requires compute.instances.get and compute.disks.get permissions.
+// At most one of returned values will be non-nil.
+func CheckApplicability(ctx context.Context, service GoogleService, rec *gcloudRecommendation) (*Applicability, error) {
+	applicability := &Applicability{Recommendation: rec.Name}
+	if IsReportOnly(rec) {
+		applicability.Problems = append(applicability.Problems, "recommendation is report-only, it can't be applied")
+		return applicability, nil
+	}
+	err := ValidateRecommendation(rec)
+	if err != nil {
+		applicability.Problems = append(applicability.Problems, err.Error())
+		return applicability, nil
+	}
+	if rec.StateInfo.State != "ACTIVE" && !claimedByRecomator(rec, nil) {
+		applicability.Problems = append(applicability.Problems, fmt.Sprintf("recommendation is in state %s", rec.StateInfo.State))
+	}
+
+	checked := make(map[string]bool)
+	for _, group := range rec.Content.OperationGroups {
+		for _, operation := range group.Operations {
+			if operation.Action == "test" {
+				err := testOperation(ctx, service, operation)
+				var testErr *ErrTestFailed
+				switch {
+				case err == nil:
+				case errors.As(err, &testErr), errors.Is(err, ErrOperationNotSupported):
+					applicability.Problems = append(applicability.Problems, err.Error())
+				case isNotFound(err):
+					applicability.Problems = append(applicability.Problems, fmt.Sprintf("resource %s doesn't exist", operation.Resource))
+				default:
+					return nil, err
+				}
+				continue
+			}
+
+			call, err := planOperation(operation, nil)
+			if err != nil {
+				applicability.Problems = append(applicability.Problems, err.Error())
+				continue
+			}
+			resource := modifiedResource(call)
+			if checked[resource] {
+				continue
+			}
+			checked[resource] = true
+			exists, err := resourceExists(ctx, service, call)
+			if err != nil {
+				return nil, err
+			}
+			if !exists {
+				applicability.Problems = append(applicability.Problems, fmt.Sprintf("resource %s doesn't exist", call.Resource))
+			}
+		}
+	}
+	err = checkNotManaged(ctx, service, rec)
+	switch {
+	case errors.Is(err, ErrManagedInstance):
+		applicability.Problems = append(applicability.Problems, err.Error())
+	case err != nil && !isNotFound(err):
+		return nil, err
+	}
+	return applicability, nil
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestCheckApplicability(t *testing.T) {
+	service := newMockApplyService()
+	applicability, err := CheckApplicability(context.Background(), service, machineTypeRecommendation())
+	if assert.NoError(t, err) {
+		assert.True(t, applicability.Applicable(), "Unexpected problems: %v", applicability.Problems)
+	}
+
+	service.instance.MachineType = changedMachineType
+	rec := machineTypeRecommendation()
+	rec.StateInfo.State = "DISMISSED"
+	applicability, err = CheckApplicability(context.Background(), service, rec)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, len(applicability.Problems), "Both the state and the failed test should be reported")
+	}
+	assert.Empty(t, service.calls, "Resources must not be modified")
+	assert.Empty(t, service.marks, "The recommendation must not be modified")
+}
+
+func TestCheckApplicabilityDeletedDisk(t *testing.T) {
+	rec, err := ParseRecommendation([]byte(diskRecommendationJSON))
+	if !assert.NoError(t, err) {
+		return
+	}
+	rec.StateInfo = &gcloudStateInfo{State: "ACTIVE"}
+	service := &mockVerificationService{disk: &compute.Disk{}}
+	applicability, err := CheckApplicability(context.Background(), service, rec)
+	if assert.NoError(t, err) {
+		assert.True(t, applicability.Applicable(), "Unexpected problems: %v", applicability.Problems)
+	}
+
+	service.disk = nil
+	applicability, err = CheckApplicability(context.Background(), service, rec)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"resource krzysztofk2 doesn't exist"}, applicability.Problems, "Disk should be checked once")
+	}
+}
@@ -0,0 +1,944 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/googleinterns/recomator/pkg/resourcename"
+)
+
+const (
+	changeMachineTypeMethod      = "ChangeMachineType"
+	changeSQLInstanceTierMethod  = "ChangeSQLInstanceTier"
+	addIAMPolicyMemberMethod     = "AddIAMPolicyMember"
+	removeIAMPolicyMemberMethod  = "RemoveIAMPolicyMember"
+	deleteProjectMethod          = "DeleteProject"
+	createRegionalSnapshotMethod = "CreateRegionalSnapshot"
+	createSnapshotMethod         = "CreateSnapshot"
+	deleteDiskMethod             = "DeleteDisk"
+	deleteImageMethod            = "DeleteImage"
+	deleteInstanceMethod         = "DeleteInstance"
+	deleteRegionalDiskMethod     = "DeleteRegionalDisk"
+	deleteSnapshotMethod         = "DeleteSnapshot"
+	labelForDeletionMethod       = "LabelForDeletion"
+	startInstanceMethod          = "StartInstance"
+	stopInstanceMethod           = "StopInstance"
+	stopSQLInstanceMethod        = "StopSQLInstance"
+)
+
+// callPermissions are permissions required for the calls made by Apply, in the format of requiredPermissions.
+var callPermissions = map[string][]string{
+	changeMachineTypeMethod:      {"compute.instances.setMachineType"},
+	changeSQLInstanceTierMethod:  {"cloudsql.instances.update"},
+	addIAMPolicyMemberMethod:     {"resourcemanager.projects.setIamPolicy"},
+	removeIAMPolicyMemberMethod:  {"resourcemanager.projects.setIamPolicy"},
+	deleteProjectMethod:          {"resourcemanager.projects.delete"},
+	createRegionalSnapshotMethod: {"compute.disks.createSnapshot", "compute.snapshots.create"},
+	createSnapshotMethod:         {"compute.disks.createSnapshot", "compute.snapshots.create"},
+	deleteDiskMethod:             {"compute.disks.delete"},
+	deleteImageMethod:            {"compute.images.delete"},
+	deleteInstanceMethod:         {"compute.instances.delete"},
+	deleteRegionalDiskMethod:     {"compute.disks.delete"},
+	deleteSnapshotMethod:         {"compute.snapshots.delete"},
+	labelForDeletionMethod:       {"compute.disks.setLabels"},
+	startInstanceMethod:          {"compute.instances.start"},
+	stopInstanceMethod:           {"compute.instances.stop"},
+	stopSQLInstanceMethod:        {"cloudsql.instances.update"},
+}
+
+// updatePermissions are permissions required for marking recommendations of each recommender.
+var updatePermissions = map[string][]string{
+	"google.compute.disk.IdleResourceRecommender":     {"recommender.computeDiskIdleResourceRecommendations.update"},
+	"google.compute.image.IdleResourceRecommender":    {"recommender.computeImageIdleResourceRecommendations.update"},
+	"google.compute.instance.IdleResourceRecommender": {"recommender.computeInstanceIdleResourceRecommendations.update"},
+	"google.compute.instance.MachineTypeRecommender":  {"recommender.computeInstanceMachineTypeRecommendations.update"},
+	iamRecommenderID:                                      {"recommender.iamPolicyRecommendations.update"},
+	projectUtilizationRecommenderID:                       {"recommender.resourcemanagerProjectUtilizationRecommendations.update"},
+	"google.cloudsql.instance.IdleRecommender":            {"recommender.cloudsqlIdleInstanceRecommendations.update"},
+	"google.cloudsql.instance.OverprovisionedRecommender": {"recommender.cloudsqlOverprovisionedInstanceRecommendations.update"},
+}
+
+// parseZonalResource returns the project, the zone and the name of the zonal instance or disk,
+// e.g. "//compute.googleapis.com/projects/p/zones/z/instances/i" or "projects/p/zones/z/disks/d".
+func parseZonalResource(resource string) (project, zone, name string, err error) {
+	parsed, err := resourcename.Parse(resource)
+	if err != nil {
+		return "", "", "", err
+	}
+	if parsed.Scope != resourcename.ZoneScope {
+		return "", "", "", fmt.Errorf("%w: %s resource %s", ErrOperationNotSupported, parsed.Scope, resource)
+	}
+	if parsed.ResourceType != "instances" && parsed.ResourceType != "disks" {
+		return "", "", "", fmt.Errorf("%w: resource %s of type %s", ErrOperationNotSupported, resource, parsed.ResourceType)
+	}
+	return parsed.Project, parsed.Location, parsed.Name, nil
+}
+
+// parseRegionalResource returns the project, the region and the name of the regional disk,
+// e.g. a regional persistent disk replicated between two zones.
+func parseRegionalResource(resource string) (project, region, name string, err error) {
+	parsed, err := resourcename.Parse(resource)
+	if err != nil {
+		return "", "", "", err
+	}
+	if parsed.Scope != resourcename.RegionScope {
+		return "", "", "", fmt.Errorf("%s is not a regional resource", resource)
+	}
+	if parsed.ResourceType != "disks" {
+		return "", "", "", fmt.Errorf("%w: regional resource %s of type %s", ErrOperationNotSupported, resource, parsed.ResourceType)
+	}
+	return parsed.Project, parsed.Location, parsed.Name, nil
+}
+
+// isRegionalResource returns whether the name is the name of a regional resource.
+func isRegionalResource(resource string) bool {
+	parsed, err := resourcename.Parse(resource)
+	return err == nil && parsed.Scope == resourcename.RegionScope
+}
+
+// OperationCall describes the call of GoogleService method applying an operation.
+// Argument is the new machine type for ChangeMachineType, the name of the snapshot
+// for CreateSnapshot, the deletion time for LabelForDeletion, the new tier for ChangeSQLInstanceTier,
+// the role for AddIAMPolicyMember and RemoveIAMPolicyMember and is empty for other methods.
+// Zone is empty for DeleteSnapshot, DeleteImage, DeleteProject, Cloud SQL and IAM methods, whose Resource is the name
+// of the snapshot, the image, the project, the Cloud SQL instance or the IAM member, e.g. "user:alice@example.com",
+// and is the region of the disk for CreateRegionalSnapshot and DeleteRegionalDisk.
+type OperationCall struct {
+	Method   string `json:"method"`
+	Project  string `json:"project"`
+	Zone     string `json:"zone"`
+	Resource string `json:"resource"`
+	Argument string `json:"argument,omitempty"`
+}
+
+func (c *OperationCall) String() string {
+	call := fmt.Sprintf("%s(%s, %s, %s", c.Method, c.Project, c.Zone, c.Resource)
+	if c.Argument != "" {
+		call += ", " + c.Argument
+	}
+	return call + ")"
+}
+
+// do makes the call.
+func (c *OperationCall) do(ctx context.Context, service GoogleService) error {
+	switch c.Method {
+	case addIAMPolicyMemberMethod:
+		return updateIAMPolicyMember(ctx, service, c.Project, c.Resource, c.Argument, true)
+	case changeMachineTypeMethod:
+		return service.ChangeMachineType(ctx, c.Project, c.Zone, c.Resource, c.Argument)
+	case changeSQLInstanceTierMethod:
+		return service.ChangeSQLInstanceTier(ctx, c.Project, c.Resource, c.Argument)
+	case createRegionalSnapshotMethod:
+		return service.CreateRegionalSnapshot(ctx, c.Project, c.Zone, c.Resource, c.Argument)
+	case createSnapshotMethod:
+		return service.CreateSnapshot(ctx, c.Project, c.Zone, c.Resource, c.Argument)
+	case deleteDiskMethod:
+		return service.DeleteDisk(ctx, c.Project, c.Zone, c.Resource)
+	case deleteImageMethod:
+		return service.DeleteImage(ctx, c.Project, c.Resource)
+	case deleteInstanceMethod:
+		return service.DeleteInstance(ctx, c.Project, c.Zone, c.Resource)
+	case deleteRegionalDiskMethod:
+		return service.DeleteRegionalDisk(ctx, c.Project, c.Zone, c.Resource)
+	case deleteSnapshotMethod:
+		return service.DeleteSnapshot(ctx, c.Project, c.Resource)
+	case removeIAMPolicyMemberMethod:
+		return updateIAMPolicyMember(ctx, service, c.Project, c.Resource, c.Argument, false)
+	case deleteProjectMethod:
+		return service.DeleteProject(ctx, c.Project)
+	case labelForDeletionMethod:
+		return labelDiskForDeletion(ctx, service, c.Project, c.Zone, c.Resource, c.Argument)
+	case startInstanceMethod:
+		return service.StartInstance(ctx, c.Project, c.Zone, c.Resource)
+	case stopInstanceMethod:
+		return service.StopInstance(ctx, c.Project, c.Zone, c.Resource)
+	case stopSQLInstanceMethod:
+		return service.StopSQLInstance(ctx, c.Project, c.Resource)
+	default:
+		return fmt.Errorf("unknown method %s", c.Method)
+	}
+}
+
+// compensations return the calls reverting calls of each method, made when a later operation
+// of the recommendation fails. nil is returned if the call shouldn't be reverted with the configuration.
+// Calls of other methods, e.g. DeleteDisk, can't be reverted. ChangeMachineType isn't reverted,
+// only the instance stopped before changing its machine type is started again.
+var compensations = map[string]func(call *OperationCall, config *applyConfig) *OperationCall{
+	stopInstanceMethod: func(call *OperationCall, config *applyConfig) *OperationCall {
+		return &OperationCall{startInstanceMethod, call.Project, call.Zone, call.Resource, ""}
+	},
+	startInstanceMethod: func(call *OperationCall, config *applyConfig) *OperationCall {
+		return &OperationCall{stopInstanceMethod, call.Project, call.Zone, call.Resource, ""}
+	},
+	createSnapshotMethod:         deleteCreatedSnapshot,
+	createRegionalSnapshotMethod: deleteCreatedSnapshot,
+}
+
+// deleteCreatedSnapshot returns the call deleting the snapshot created by the call, if WithOrphanedSnapshotCleanup is used.
+func deleteCreatedSnapshot(call *OperationCall, config *applyConfig) *OperationCall {
+	if !config.deleteOrphanedSnapshots {
+		return nil
+	}
+	return &OperationCall{deleteSnapshotMethod, call.Project, "", call.Argument, ""}
+}
+
+// compensate reverts the calls made by Apply for the recommendation whose later operation failed,
+// in reverse order, see compensations.
+// If the error occurred the returned error is not nil and the remaining calls are not reverted.
+func compensate(ctx context.Context, service GoogleService, calls []*OperationCall, config *applyConfig) error {
+	for i := len(calls) - 1; i >= 0; i-- {
+		compensation, ok := compensations[calls[i].Method]
+		if !ok {
+			continue
+		}
+		call := compensation(calls[i], config)
+		if call == nil {
+			continue
+		}
+		err := call.do(ctx, service)
+		if err != nil {
+			return fmt.Errorf("reverting %v by %v failed: %v", calls[i], call, err)
+		}
+	}
+	return nil
+}
+
+// planOperation returns the call applying the operation, which must not be a test operation.
+// Snapshots are named according to naming, or with randomSnapshotName if it is nil.
+func planOperation(operation *gcloudOperation, naming *SnapshotNaming) (*OperationCall, error) {
+	if operation.ResourceType == sqlInstanceResourceType {
+		return planSQLOperation(operation)
+	}
+	if operation.ResourceType == projectResourceType && operation.Path == "/" {
+		return planProjectOperation(operation)
+	}
+	if operation.ResourceType == projectResourceType {
+		return planIAMOperation(operation)
+	}
+	switch {
+	case isMachineTypeOperation(operation):
+		project, zone, instance, err := parseZonalResource(operation.Resource)
+		if err != nil {
+			return nil, err
+		}
+		value, ok := operation.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("machine type must be a string, got %T", operation.Value)
+		}
+		machineType := lastPathElement(value)
+		if isCustomMachineType(machineType) {
+			custom, err := ParseCustomMachineType(machineType)
+			if err != nil {
+				return nil, err
+			}
+			machineType = custom.String()
+		}
+		return &OperationCall{changeMachineTypeMethod, project, zone, instance, machineType}, nil
+	case operation.Action == "replace" && operation.Path == "/status" && operation.Value == "TERMINATED":
+		project, zone, instance, err := parseZonalResource(operation.Resource)
+		if err != nil {
+			return nil, err
+		}
+		return &OperationCall{stopInstanceMethod, project, zone, instance, ""}, nil
+	case isStartOperation(operation):
+		project, zone, instance, err := parseZonalResource(operation.Resource)
+		if err != nil {
+			return nil, err
+		}
+		return &OperationCall{startInstanceMethod, project, zone, instance, ""}, nil
+	case operation.Action == "add" && operation.ResourceType == snapshotResourceType:
+		value, ok := operation.Value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("snapshot must be an object, got %T", operation.Value)
+		}
+		sourceDisk, ok := value["source_disk"].(string)
+		if !ok {
+			return nil, fmt.Errorf("source_disk of snapshot must be a string, got %T", value["source_disk"])
+		}
+		method, parse := createSnapshotMethod, parseZonalResource
+		if isRegionalResource(sourceDisk) {
+			method, parse = createRegionalSnapshotMethod, parseRegionalResource
+		}
+		project, location, disk, err := parse(sourceDisk)
+		if err != nil {
+			return nil, err
+		}
+		generator := rand.New(rand.NewSource(time.Now().UnixNano()))
+		var name string
+		if naming != nil {
+			name, err = naming.name(disk, time.Now(), generator)
+		} else {
+			name, err = randomSnapshotName(location, disk, generator)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &OperationCall{method, project, location, disk, name}, nil
+	case operation.Action == "remove" && operation.ResourceType == diskResourceType:
+		method, parse := deleteDiskMethod, parseZonalResource
+		if isRegionalResource(operation.Resource) {
+			method, parse = deleteRegionalDiskMethod, parseRegionalResource
+		}
+		project, location, disk, err := parse(operation.Resource)
+		if err != nil {
+			return nil, err
+		}
+		return &OperationCall{method, project, location, disk, ""}, nil
+	case operation.Action == "remove" && operation.ResourceType == instanceResourceType:
+		project, zone, instance, err := parseZonalResource(operation.Resource)
+		if err != nil {
+			return nil, err
+		}
+		return &OperationCall{deleteInstanceMethod, project, zone, instance, ""}, nil
+	case operation.Action == "remove" && operation.ResourceType == imageResourceType:
+		project, image, err := parseGlobalImage(operation.Resource)
+		if err != nil {
+			return nil, err
+		}
+		return &OperationCall{deleteImageMethod, project, "", image, ""}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s %s of %s", ErrOperationNotSupported, operation.Action, operation.Path, operation.ResourceType)
+	}
+}
+
+// planApplyCall returns the call Apply makes for the operation, which must not be a test operation:
+// the call planned by planOperation, labeling the disk for deletion instead of deleting it with WithSoftDelete option.
+func planApplyCall(operation *gcloudOperation, config *applyConfig) (*OperationCall, error) {
+	call, err := planOperation(operation, config.snapshotNaming)
+	if err != nil {
+		return nil, err
+	}
+	if isIAMCall(call) && !config.iamPolicyChanges && !config.dryRun {
+		return nil, fmt.Errorf("%w: %v changes the IAM policy, WithIAMPolicyChanges option must be used", ErrConfirmationRequired, call)
+	}
+	if call.Method == deleteProjectMethod && !config.projectDeletion && !config.dryRun {
+		return nil, fmt.Errorf("%w: %v deletes the project, WithProjectDeletion option must be used", ErrConfirmationRequired, call)
+	}
+	if config.gracePeriod > 0 && call.Method == deleteRegionalDiskMethod {
+		return nil, fmt.Errorf("%w: soft delete of regional disk %s", ErrOperationNotSupported, call.Resource)
+	}
+	if config.gracePeriod > 0 && call.Method == deleteInstanceMethod {
+		return nil, fmt.Errorf("%w: soft delete of instance %s", ErrOperationNotSupported, call.Resource)
+	}
+	if config.gracePeriod > 0 && call.Method == deleteDiskMethod {
+		call = softDeleteCall(call, time.Now().Add(config.gracePeriod))
+	}
+	return call, nil
+}
+
+// planOperations checks that all operations of the recommendation other than test operations can be planned,
+// e.g. that target custom machine types and snapshot names rendered by WithSnapshotNaming are valid, so that
+// the recommendation is not claimed and resources are not modified, like instances stopped before
+// changing their machine types, if some of them can't be applied.
+func planOperations(rec *gcloudRecommendation, config *applyConfig) error {
+	for _, group := range rec.Content.OperationGroups {
+		for _, operation := range group.Operations {
+			if operation.Action == "test" {
+				continue
+			}
+			call, err := planApplyCall(operation, config)
+			if err != nil {
+				return err
+			}
+			isSnapshot := call.Method == createSnapshotMethod || call.Method == createRegionalSnapshotMethod
+			if isSnapshot && config.snapshotNaming != nil && !snapshotNameRegexp.MatchString(call.Argument) {
+				return fmt.Errorf("snapshot name %s of disk %s is not valid, it must match %s", call.Argument, call.Resource, snapshotNameRegexp)
+			}
+		}
+	}
+	return nil
+}
+
+// machineTypeChangeCalls returns the calls changing the machine type by the call. GCE changes
+// machine types only of stopped instances, so the instance is stopped before and started again after,
+// if it is running and wasn't stopped by the previous calls made for the recommendation.
+func machineTypeChangeCalls(ctx context.Context, service GoogleService, call *OperationCall, previous []*OperationCall) ([]*OperationCall, error) {
+	stopped := false
+	for _, other := range previous {
+		if other.Project == call.Project && other.Zone == call.Zone && other.Resource == call.Resource {
+			stopped = (stopped || other.Method == stopInstanceMethod) && other.Method != startInstanceMethod
+		}
+	}
+	if stopped {
+		return []*OperationCall{call}, nil
+	}
+	instance, err := service.GetInstance(ctx, call.Project, call.Zone, call.Resource)
+	if err != nil {
+		return nil, err
+	}
+	if instance.Status != "RUNNING" {
+		return []*OperationCall{call}, nil
+	}
+	return []*OperationCall{
+		{stopInstanceMethod, call.Project, call.Zone, call.Resource, ""},
+		call,
+		{startInstanceMethod, call.Project, call.Zone, call.Resource, ""},
+	}, nil
+}
+
+// testOperation checks that the value of the instance at the path of the test operation
+// matches the operation, otherwise the error is returned.
+func testOperation(ctx context.Context, service GoogleService, operation *gcloudOperation) error {
+	if operation.ResourceType == sqlInstanceResourceType {
+		return testSQLOperation(ctx, service, operation)
+	}
+	project, zone, name, err := parseZonalResource(operation.Resource)
+	if err != nil {
+		return err
+	}
+	if operation.ResourceType != instanceResourceType {
+		return fmt.Errorf("%w: test of %s", ErrOperationNotSupported, operation.ResourceType)
+	}
+	instance, err := service.GetInstance(ctx, project, zone, name)
+	if err != nil {
+		return err
+	}
+
+	var value string
+	switch operation.Path {
+	case "/machineType":
+		value = instance.MachineType
+	case "/status":
+		value = instance.Status
+	default:
+		return fmt.Errorf("%w: test of path %s", ErrOperationNotSupported, operation.Path)
+	}
+	return checkTestValue(operation, value)
+}
+
+// checkTestValue returns *ErrTestFailed if value of the resource doesn't match the test operation.
+func checkTestValue(operation *gcloudOperation, value string) error {
+	matches, err := testMatching(value, operation.Value, operation.ValueMatcher)
+	if err != nil {
+		return err
+	}
+	if !matches {
+		want := fmt.Sprint(operation.Value)
+		if operation.ValueMatcher != nil {
+			want = "pattern " + operation.ValueMatcher.MatchesPattern
+		}
+		return &ErrTestFailed{Resource: operation.Resource, Path: operation.Path, Got: value, Want: want}
+	}
+	return nil
+}
+
+// DoOperation applies the operation: checks the resource for test operations,
+// otherwise makes the calls modifying the resource, see machineTypeChangeCalls for machine type changes.
+// Operations requiring confirmation options of Apply, e.g. deleting projects or changing IAM policies, are not applied,
+// ErrConfirmationRequired is wrapped for them.
+// If the error occurred the returned error is not nil.
+func DoOperation(ctx context.Context, service GoogleService, operation *gcloudOperation) error {
+	if operation.Action == "test" {
+		return testOperation(ctx, service, operation)
+	}
+	call, err := planApplyCall(operation, &applyConfig{})
+	if err != nil {
+		return err
+	}
+	calls := []*OperationCall{call}
+	if call.Method == changeMachineTypeMethod {
+		calls, err = machineTypeChangeCalls(ctx, service, call, nil)
+		if err != nil {
+			return err
+		}
+	}
+	for _, call := range calls {
+		err = call.do(ctx, service)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyConfig contains the configuration of Apply.
+type applyConfig struct {
+	dryRun         bool
+	parallelism    int
+	gracePeriod    time.Duration
+	listener       ProgressListener
+	checkpoints    CheckpointStore
+	snapshotNaming *SnapshotNaming
+	force          bool
+	stepTimeout    time.Duration
+	applyTimeout   time.Duration
+
+	deleteOrphanedSnapshots bool
+	failureDomainLabels     []string
+	capacityFloors          []CapacityFloor
+	leaveStopped            bool
+	imageExporter           ImageExporter
+	iamPolicyChanges        bool
+	projectDeletion         bool
+}
+
+// ApplyOption configures Apply.
+type ApplyOption func(*applyConfig)
+
+// WithDryRun makes Apply only perform the test operations and check the permissions
+// required for applying the recommendation. Resources and the recommendation are not modified,
+// the calls that would be made are returned in ApplyReport.
+func WithDryRun() ApplyOption {
+	return func(c *applyConfig) {
+		c.dryRun = true
+	}
+}
+
+// WithSoftDelete makes Apply label disks for deletion after gracePeriod instead of deleting them,
+// they are deleted later by DeleteExpiredDisks unless reclaimed with ReclaimDisk.
+// Regional disks and instances can't be soft deleted, recommendations deleting them fail with ErrOperationNotSupported.
+func WithSoftDelete(gracePeriod time.Duration) ApplyOption {
+	return func(c *applyConfig) {
+		c.gracePeriod = gracePeriod
+	}
+}
+
+// WithProgressListener makes Apply report its progress to listener.
+// ApplyAll passes it to Apply for every recommendation, so then it must be thread-safe.
+func WithProgressListener(listener ProgressListener) ApplyOption {
+	return func(c *applyConfig) {
+		c.listener = listener
+	}
+}
+
+// WithCheckpoints makes Apply store its progress in store after every completed operation.
+// If the process crashes, the recommendation stays claimed and Resume can finish applying it.
+func WithCheckpoints(store CheckpointStore) ApplyOption {
+	return func(c *applyConfig) {
+		c.checkpoints = store
+	}
+}
+
+// WithForce makes Apply skip test operations and apply the other operations even if
+// resources have changed since the recommendation was generated, e.g. the instance was stopped manually.
+// ApplyReport records that the recommendation was forced.
+func WithForce() ApplyOption {
+	return func(c *applyConfig) {
+		c.force = true
+	}
+}
+
+// WithLeaveStopped makes Apply skip operations starting instances and the start after changing
+// the machine type, so that instances stay stopped until they are started manually.
+// Such instances are recorded in ApplyReport.
+func WithLeaveStopped() ApplyOption {
+	return func(c *applyConfig) {
+		c.leaveStopped = true
+	}
+}
+
+// WithSnapshotNaming makes Apply name snapshots according to naming, instead of
+// following the convention of scheduled snapshots. Names are returned in ApplyReport.
+func WithSnapshotNaming(naming *SnapshotNaming) ApplyOption {
+	return func(c *applyConfig) {
+		c.snapshotNaming = naming
+	}
+}
+
+// WithParallelism sets the maximum number of recommendations ApplyAll applies concurrently.
+// Non-positive values are ignored, instead the default value is used. Apply ignores this option.
+func WithParallelism(parallelism int) ApplyOption {
+	return func(c *applyConfig) {
+		c.parallelism = parallelism
+	}
+}
+
+// WithStepTimeout limits the time of applying a single operation of the recommendation,
+// including waiting for the zone operation it started, e.g. stopping the instance.
+// Non-positive values are ignored. On timeout the recommendation is marked as failed and ErrTimeout is wrapped.
+func WithStepTimeout(timeout time.Duration) ApplyOption {
+	return func(c *applyConfig) {
+		c.stepTimeout = timeout
+	}
+}
+
+// WithApplyTimeout limits the time of applying all operations of the recommendation,
+// marking the recommendation doesn't count towards it. ApplyAll uses it for every recommendation separately.
+// Non-positive values are ignored. On timeout the recommendation is marked as failed and ErrTimeout is wrapped.
+func WithApplyTimeout(timeout time.Duration) ApplyOption {
+	return func(c *applyConfig) {
+		c.applyTimeout = timeout
+	}
+}
+
+// WithOrphanedSnapshotCleanup makes Apply delete the snapshot it created
+// if a later operation of the recommendation failed, e.g. deleting the disk.
+// By default such snapshots are kept, so that they can be inspected.
+func WithOrphanedSnapshotCleanup() ApplyOption {
+	return func(c *applyConfig) {
+		c.deleteOrphanedSnapshots = true
+	}
+}
+
+// timeoutContext returns the context derived from ctx, limited to timeout if it is positive.
+func timeoutContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// WithFailureDomainLabels makes ApplyAll apply recommendations for instances sharing a failure domain
+// one at a time, so that a service doesn't lose several instances at once. The failure domain is the zone
+// and the managed instance group of the instance or values of labels, e.g. WithFailureDomainLabels("service").
+// Instances not in a group and without any of the labels are applied concurrently. Apply ignores this option.
+func WithFailureDomainLabels(labels ...string) ApplyOption {
+	return func(c *applyConfig) {
+		c.failureDomainLabels = append([]string{}, labels...)
+	}
+}
+
+// newApplyConfig returns the configuration with options applied.
+func newApplyConfig(options []ApplyOption) *applyConfig {
+	config := &applyConfig{}
+	for _, option := range options {
+		option(config)
+	}
+	return config
+}
+
+// deleteCheckpoint deletes the checkpoint of the recommendation if the checkpoint store is set.
+func (c *applyConfig) deleteCheckpoint(name string) {
+	if c.checkpoints != nil {
+		c.checkpoints.Delete(name)
+	}
+}
+
+// ApplyReport describes what Apply did.
+// Calls are the calls modifying resources, in dry run the calls that would be made.
+// Snapshots are the names of snapshots created by these calls.
+// Forced is true if test operations were skipped because of WithForce option.
+// LeftStopped are the instances not started because of WithLeaveStopped option.
+// Requirements are the permissions required for these calls, they are checked only in dry run.
+// CorrelationID is the correlation ID sent on the API calls made by Apply.
+type ApplyReport struct {
+	CorrelationID string           `json:"correlationId"`
+	DryRun        bool             `json:"dryRun"`
+	Forced        bool             `json:"forced"`
+	Calls         []*OperationCall `json:"calls"`
+	Snapshots     []string         `json:"snapshots"`
+	LeftStopped   []string         `json:"leftStopped,omitempty"`
+	Requirements  []*Requirement   `json:"requirements"`
+}
+
+// isStartOperation returns whether the operation starts the instance.
+func isStartOperation(operation *gcloudOperation) bool {
+	return operation.Action == "replace" && operation.Path == "/status" && operation.Value == "RUNNING"
+}
+
+// newApplyReport returns the report of the calls made by Apply for the recommendation configured with config.
+func newApplyReport(ctx context.Context, rec *gcloudRecommendation, calls []*OperationCall, config *applyConfig) *ApplyReport {
+	report := &ApplyReport{CorrelationID: CorrelationID(ctx), DryRun: config.dryRun, Forced: config.force, Calls: calls}
+	for _, call := range calls {
+		if call.Method == createSnapshotMethod || call.Method == createRegionalSnapshotMethod {
+			report.Snapshots = append(report.Snapshots, call.Argument)
+		}
+	}
+	if config.leaveStopped {
+		added := make(map[string]bool)
+		for _, group := range rec.Content.OperationGroups {
+			for _, operation := range group.Operations {
+				if !isStartOperation(operation) && !isMachineTypeOperation(operation) {
+					continue
+				}
+				if !added[operation.Resource] && leftStopped(operation.Resource, calls) {
+					added[operation.Resource] = true
+					report.LeftStopped = append(report.LeftStopped, operation.Resource)
+				}
+			}
+		}
+	}
+	return report
+}
+
+// isMachineTypeOperation returns whether the operation changes the machine type of the instance.
+func isMachineTypeOperation(operation *gcloudOperation) bool {
+	return operation.Action == "replace" && operation.Path == "/machineType"
+}
+
+// leftStopped returns whether the instance was stopped by the calls and not started again.
+func leftStopped(instance string, calls []*OperationCall) bool {
+	project, zone, name, err := parseZonalResource(instance)
+	if err != nil {
+		return false
+	}
+	stopped := false
+	for _, call := range calls {
+		if call.Project == project && call.Zone == zone && call.Resource == name {
+			stopped = (stopped || call.Method == stopInstanceMethod) && call.Method != startInstanceMethod
+		}
+	}
+	return stopped
+}
+
+// checkPermissions returns the statuses of permissions required for the calls and for marking the recommendation.
+func checkPermissions(ctx context.Context, service GoogleService, recommenderName string, calls []*OperationCall) ([]*Requirement, error) {
+	projectPermissions := make(map[string][][]string)
+	var projects []string
+	addPermissions := func(project string, permissions []string) {
+		if _, ok := projectPermissions[project]; !ok {
+			projects = append(projects, project)
+		}
+		for _, added := range projectPermissions[project] {
+			if strings.Join(added, ",") == strings.Join(permissions, ",") {
+				return
+			}
+		}
+		projectPermissions[project] = append(projectPermissions[project], permissions)
+	}
+	for _, call := range calls {
+		addPermissions(call.Project, callPermissions[call.Method])
+		if permissions, ok := updatePermissions[recommenderName]; ok {
+			addPermissions(call.Project, permissions)
+		}
+	}
+
+	var result []*Requirement
+	for _, project := range projects {
+		requirements, err := service.ListPermissionRequirements(ctx, project, projectPermissions[project])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, requirements...)
+	}
+	return result, nil
+}
+
+// applyOperations applies all operations of the recommendation, or only test operations in dry run,
+// reporting the progress to the listener if it is set. If start is not nil, operations completed
+// according to it are skipped. Unless in dry run, the progress is stored in the checkpoint store if it is set.
+// Returns the calls made, or the calls that would be made in dry run, also if the error occurred.
+func applyOperations(ctx context.Context, service GoogleService, rec *gcloudRecommendation, config *applyConfig, start *ApplyCheckpoint) ([]*OperationCall, error) {
+	listener := config.listener
+	if listener == nil {
+		listener = noopListener{}
+	}
+	progress := &OperationProgress{Recommendation: rec.Name}
+	for _, group := range rec.Content.OperationGroups {
+		progress.Total += len(group.Operations)
+	}
+
+	var calls []*OperationCall
+	if start != nil {
+		progress.Done = start.Done
+		calls = append(calls, start.Calls...)
+	}
+	skip := progress.Done
+	applyGroup := func(groupIndex int, group *gcloudOperationGroup) error {
+		for i, operation := range group.Operations {
+			if skip > 0 {
+				skip--
+				continue
+			}
+			progress.Group, progress.Index, progress.Operation = groupIndex, i, operation
+			listener.OnOperationStart(progress)
+			stepCtx, cancel := timeoutContext(ctx, config.stepTimeout)
+			made, err := applyOperation(stepCtx, service, operation, config, calls)
+			calls = append(calls, made...)
+			if err != nil && errors.Is(stepCtx.Err(), context.DeadlineExceeded) {
+				err = fmt.Errorf("%w: %v", ErrTimeout, err)
+			}
+			cancel()
+			listener.OnOperationDone(progress, err)
+			if err != nil {
+				return fmt.Errorf("%s: %w", progress.Description(), err)
+			}
+			progress.Done++
+			if config.checkpoints != nil && !config.dryRun {
+				config.checkpoints.Store(&ApplyCheckpoint{
+					Recommendation: rec.Name,
+					ClaimToken:     start.ClaimToken,
+					Etag:           start.Etag,
+					Done:           progress.Done,
+					Calls:          append([]*OperationCall(nil), calls...),
+				})
+			}
+		}
+		return nil
+	}
+	for i, group := range rec.Content.OperationGroups {
+		listener.OnGroupStart(rec.Name, i, len(rec.Content.OperationGroups))
+		err := applyGroup(i, group)
+		listener.OnGroupDone(rec.Name, i, err)
+		if err != nil {
+			return calls, err
+		}
+	}
+	return calls, nil
+}
+
+// applyOperation applies the operation, or only checks it if it is a test operation or in dry run.
+// Test operations are skipped with WithForce option, operations starting instances with WithLeaveStopped option.
+// previous are the calls already made for the recommendation, see machineTypeChangeCalls.
+// Returns the calls made, or that would be made in dry run, also if the error occurred.
+func applyOperation(ctx context.Context, service GoogleService, operation *gcloudOperation, config *applyConfig,
+	previous []*OperationCall) ([]*OperationCall, error) {
+	if operation.Action == "test" {
+		if config.force {
+			return nil, nil
+		}
+		return nil, testOperation(ctx, service, operation)
+	}
+	if config.leaveStopped && isStartOperation(operation) {
+		return nil, nil
+	}
+	call, err := planApplyCall(operation, config)
+	if err != nil {
+		return nil, err
+	}
+	calls := []*OperationCall{call}
+	if call.Method == changeMachineTypeMethod {
+		calls, err = machineTypeChangeCalls(ctx, service, call, previous)
+		if err != nil {
+			return nil, err
+		}
+		if last := calls[len(calls)-1]; config.leaveStopped && last.Method == startInstanceMethod {
+			calls = calls[:len(calls)-1]
+		}
+	}
+	if config.dryRun {
+		return calls, nil
+	}
+	for i, call := range calls {
+		if config.imageExporter != nil && call.Method == deleteImageMethod {
+			err = config.imageExporter.ExportImage(ctx, call.Project, call.Resource)
+			if err != nil {
+				return calls[:i], fmt.Errorf("exporting image %s before deleting it: %w", call.Resource, err)
+			}
+		}
+		err = call.do(ctx, service)
+		if err != nil {
+			return calls[:i], err
+		}
+	}
+	return calls, nil
+}
+
+// Apply applies the recommendation: marks it as claimed, applies all its operations
+// and then marks it as succeeded, or as failed if applying some operation failed.
+// Before marking the recommendation as failed, the calls already made are reverted where possible:
+// stopped instances are started again and, with WithOrphanedSnapshotCleanup option, created snapshots are deleted.
+// Errors of operations are wrapped with their descriptions, they can be checked with errors.Is
+// for ErrOperationNotSupported, ErrTimeout and ErrConfirmationRequired or errors.As for *ErrTestFailed. ErrNotActive is wrapped if
+// the recommendation is neither active nor claimed by this run of recomator, ErrCapacityFloor if it is deferred
+// because of WithCapacityFloor option, ErrManagedInstance if it changes the machine type of an instance
+// of a managed instance group and ErrReportOnly if the recommendation is report-only, see IsReportOnly.
+// With WithDryRun option only test operations and permission checks are performed.
+// With WithCheckpoints option the progress is stored, so that Resume can finish applying it.
+// If marking the recommendation fails because of a stale etag, it is fetched again and marked
+// with the fresh etag, unless its content or state has changed, then ErrRecommendationChanged is wrapped.
+// The recommendation must be valid according to ValidateRecommendation and active,
+// or claimed earlier by this run of recomator, or by a run that stored the checkpoint of the claim
+// in the store of WithCheckpoints, e.g. if applying it was interrupted by a crash, and unchanged since then.
+// API calls carry the correlation ID of ctx set by WithCorrelationID, or a new one, returned in ApplyReport.
+// At most one of returned values will be non-nil.
+func Apply(ctx context.Context, service GoogleService, rec *gcloudRecommendation, options ...ApplyOption) (*ApplyReport, error) {
+	ctx = ensureCorrelationID(ctx)
+	config := newApplyConfig(options)
+	err := checkNotReportOnly(rec)
+	if err != nil {
+		return nil, err
+	}
+	err = ValidateRecommendation(rec)
+	if err != nil {
+		return nil, err
+	}
+	if state := rec.StateInfo.State; state != "ACTIVE" && !claimedByRecomator(rec, config.checkpoints) {
+		if state == "CLAIMED" {
+			return nil, fmt.Errorf("%w: %s is claimed by someone else", ErrNotActive, rec.Name)
+		}
+		return nil, fmt.Errorf("%w: %s in state %s can't be applied", ErrNotActive, rec.Name, state)
+	}
+	err = planOperations(rec, config)
+	if err != nil {
+		return nil, err
+	}
+	err = checkNotManaged(ctx, service, rec)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.capacityFloors) != 0 {
+		err = checkCapacityFloors(ctx, service, rec, config.capacityFloors)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if config.dryRun {
+		applyCtx, cancel := timeoutContext(ctx, config.applyTimeout)
+		defer cancel()
+		calls, err := applyOperations(applyCtx, service, rec, config, nil)
+		if err != nil {
+			return nil, err
+		}
+		recommenderName, _ := recommenderID(rec.Name)
+		requirements, err := checkPermissions(ctx, service, recommenderName, calls)
+		if err != nil {
+			return nil, err
+		}
+		report := newApplyReport(ctx, rec, calls, config)
+		report.Requirements = requirements
+		return report, nil
+	}
+
+	claimed, err := markRecommendation(ctx, service, rec, rec.Etag, rec.StateInfo.State, service.MarkRecommendationClaimed)
+	if err != nil {
+		return nil, err
+	}
+	recordClaim(claimed)
+	start := &ApplyCheckpoint{Recommendation: rec.Name, ClaimToken: claimToken, Etag: claimed.Etag}
+	if config.checkpoints != nil {
+		config.checkpoints.Store(start)
+	}
+	return finishApply(ctx, service, rec, claimed.Etag, config, start)
+}
+
+// finishApply applies operations of the claimed recommendation not completed according to start,
+// then marks the recommendation as succeeded, or reverts the calls made and marks it as failed,
+// and deletes its checkpoint.
+// The checkpoint is kept if marking the recommendation failed, so that it can be resumed.
+// The apply timeout limits only applying the operations, so that the recommendation can be marked after it.
+func finishApply(ctx context.Context, service GoogleService, rec *gcloudRecommendation, etag string,
+	config *applyConfig, start *ApplyCheckpoint) (*ApplyReport, error) {
+	applyCtx, cancel := timeoutContext(ctx, config.applyTimeout)
+	defer cancel()
+	calls, err := applyOperations(applyCtx, service, rec, config, start)
+	if err != nil {
+		compensateErr := compensate(ctx, service, calls, config)
+		if compensateErr != nil {
+			err = fmt.Errorf("%w, %v", err, compensateErr)
+		}
+		_, markErr := markRecommendation(ctx, service, rec, etag, "CLAIMED", service.MarkRecommendationFailed)
+		if markErr != nil {
+			return nil, fmt.Errorf("%w, marking the recommendation as failed also failed: %v", err, markErr)
+		}
+		config.deleteCheckpoint(rec.Name)
+		return nil, err
+	}
+	_, err = markRecommendation(ctx, service, rec, etag, "CLAIMED", service.MarkRecommendationSucceeded)
+	if err != nil {
+		return nil, err
+	}
+	config.deleteCheckpoint(rec.Name)
+	return newApplyReport(ctx, rec, calls, config), nil
+}
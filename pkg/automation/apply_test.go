@@ -0,0 +1,552 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/googleinterns/recomator/pkg/resourcename"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/compute/v1"
+)
+
+const (
+	applyInstance = "//compute.googleapis.com/projects/rightsizer-test/zones/us-east1-b/instances/alicja-test"
+	applyRecName  = "projects/323016592286/locations/us-east1-b/recommenders/google.compute.instance.MachineTypeRecommender/recommendations/r"
+	idleRecName   = "projects/323016592286/locations/us-east1-b/recommenders/google.compute.instance.IdleResourceRecommender/recommendations/r"
+	// changedMachineType is the machine type of the instance not matching machineTypeRecommendation.
+	changedMachineType = "https://www.googleapis.com/compute/v1/projects/rightsizer-test/zones/us-east1-b/machineTypes/n1-standard-8"
+)
+
+// mockApplyService records calls made by Apply.
+type mockApplyService struct {
+	GoogleService
+	instance    *compute.Instance
+	calls       []string
+	marks       []string
+	permissions [][]string
+	failCalls   bool
+}
+
+func (s *mockApplyService) GetInstance(ctx context.Context, project, zone, instance string) (*compute.Instance, error) {
+	return s.instance, nil
+}
+
+func (s *mockApplyService) ChangeMachineType(ctx context.Context, project, zone, instance, machineType string) error {
+	s.calls = append(s.calls, "ChangeMachineType "+project+" "+zone+" "+instance+" "+machineType)
+	if s.failCalls {
+		return errors.New("quota exceeded")
+	}
+	return nil
+}
+
+func (s *mockApplyService) CreateRegionalSnapshot(ctx context.Context, project, region, disk, name string) error {
+	s.calls = append(s.calls, "CreateRegionalSnapshot "+project+" "+region+" "+disk)
+	return nil
+}
+
+func (s *mockApplyService) DeleteRegionalDisk(ctx context.Context, project, region, disk string) error {
+	s.calls = append(s.calls, "DeleteRegionalDisk "+project+" "+region+" "+disk)
+	return nil
+}
+
+func (s *mockApplyService) DeleteInstance(ctx context.Context, project, zone, instance string) error {
+	s.calls = append(s.calls, "DeleteInstance "+project+" "+zone+" "+instance)
+	return nil
+}
+
+func (s *mockApplyService) StartInstance(ctx context.Context, project, zone, instance string) error {
+	s.calls = append(s.calls, "StartInstance "+project+" "+zone+" "+instance)
+	return nil
+}
+
+func (s *mockApplyService) StopInstance(ctx context.Context, project, zone, instance string) error {
+	s.calls = append(s.calls, "StopInstance "+project+" "+zone+" "+instance)
+	return nil
+}
+
+func (s *mockApplyService) mark(state, name, etag string) (*gcloudRecommendation, error) {
+	s.marks = append(s.marks, state)
+	return &gcloudRecommendation{Name: name, Etag: etag + "-" + state}, nil
+}
+
+func (s *mockApplyService) MarkRecommendationClaimed(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	return s.mark("CLAIMED", name, etag)
+}
+
+func (s *mockApplyService) MarkRecommendationFailed(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	return s.mark("FAILED", name, etag)
+}
+
+func (s *mockApplyService) MarkRecommendationSucceeded(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	return s.mark("SUCCEEDED", name, etag)
+}
+
+func (s *mockApplyService) ListPermissionRequirements(ctx context.Context, project string, permissions [][]string) ([]*Requirement, error) {
+	s.permissions = append(s.permissions, permissions...)
+	var result []*Requirement
+	for range permissions {
+		result = append(result, &Requirement{Status: RequirementCompleted})
+	}
+	return result, nil
+}
+
+func machineTypeRecommendation() *gcloudRecommendation {
+	rec := makeRecommendation(applyRecName, 10,
+		&gcloudOperation{Action: "test", Path: "/machineType", Resource: applyInstance, ResourceType: instanceResourceType,
+			ValueMatcher: &gcloudValueMatcher{MatchesPattern: ".*zones/us-east1-b/machineTypes/n1-standard-4"}},
+		&gcloudOperation{Action: "replace", Path: "/machineType", Resource: applyInstance, ResourceType: instanceResourceType,
+			Value: "zones/us-east1-b/machineTypes/custom-2-5120"})
+	rec.StateInfo = &gcloudStateInfo{State: "ACTIVE"}
+	rec.Etag = "etag"
+	return rec
+}
+
+func newMockApplyService() *mockApplyService {
+	return &mockApplyService{instance: &compute.Instance{
+		MachineType: "https://www.googleapis.com/compute/v1/projects/rightsizer-test/zones/us-east1-b/machineTypes/n1-standard-4",
+		Status:      "RUNNING",
+	}}
+}
+
+func TestApply(t *testing.T) {
+	service := newMockApplyService()
+	report, err := Apply(context.Background(), service, machineTypeRecommendation())
+	if assert.NoError(t, err) {
+		assert.False(t, report.DryRun)
+		assert.Equal(t, 3, len(report.Calls))
+	}
+	assert.Equal(t, []string{
+		"StopInstance rightsizer-test us-east1-b alicja-test",
+		"ChangeMachineType rightsizer-test us-east1-b alicja-test custom-2-5120",
+		"StartInstance rightsizer-test us-east1-b alicja-test",
+	}, service.calls)
+	assert.Equal(t, []string{"CLAIMED", "SUCCEEDED"}, service.marks)
+}
+
+func TestApplyDryRun(t *testing.T) {
+	service := newMockApplyService()
+	report, err := Apply(context.Background(), service, machineTypeRecommendation(), WithDryRun())
+	if assert.NoError(t, err) {
+		assert.True(t, report.DryRun)
+		if assert.Equal(t, 3, len(report.Calls)) {
+			assert.Equal(t, "StopInstance(rightsizer-test, us-east1-b, alicja-test)", report.Calls[0].String())
+			assert.Equal(t, "ChangeMachineType(rightsizer-test, us-east1-b, alicja-test, custom-2-5120)", report.Calls[1].String())
+			assert.Equal(t, "StartInstance(rightsizer-test, us-east1-b, alicja-test)", report.Calls[2].String())
+		}
+		assert.Equal(t, 4, len(report.Requirements), "Update permission should be checked once")
+	}
+	assert.Empty(t, service.calls, "Dry run must not modify resources")
+	assert.Empty(t, service.marks, "Dry run must not modify the recommendation")
+	assert.Equal(t, [][]string{
+		{"compute.instances.stop"},
+		{"recommender.computeInstanceMachineTypeRecommendations.update"},
+		{"compute.instances.setMachineType"},
+		{"compute.instances.start"},
+	}, service.permissions)
+}
+
+func TestApplyTestFailed(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		service := newMockApplyService()
+		service.instance.MachineType = changedMachineType
+		var options []ApplyOption
+		if dryRun {
+			options = append(options, WithDryRun())
+		}
+		report, err := Apply(context.Background(), service, machineTypeRecommendation(), options...)
+		assert.Error(t, err, "Test operation should fail")
+		assert.Nil(t, report, "Only one of returned values should be non-nil")
+		assert.Empty(t, service.calls, "Nothing should be modified after failed test operation")
+		if !dryRun {
+			assert.Equal(t, []string{"CLAIMED", "FAILED"}, service.marks)
+		}
+	}
+}
+
+// mockFailingMarkService is mockApplyService failing to mark recommendations as failed.
+type mockFailingMarkService struct {
+	*mockApplyService
+}
+
+func (s *mockFailingMarkService) MarkRecommendationFailed(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	return nil, errors.New("permission denied")
+}
+
+func TestApplyMarkFailedError(t *testing.T) {
+	service := &mockFailingMarkService{newMockApplyService()}
+	service.instance.MachineType = changedMachineType
+	_, err := Apply(context.Background(), service, machineTypeRecommendation())
+	var testErr *ErrTestFailed
+	assert.True(t, errors.As(err, &testErr), "Error of the operation should be wrapped, got %v", err)
+	assert.Contains(t, err.Error(), "permission denied")
+}
+
+func TestApplyCallFailed(t *testing.T) {
+	service := newMockApplyService()
+	service.failCalls = true
+	_, err := Apply(context.Background(), service, machineTypeRecommendation())
+	assert.Error(t, err)
+	assert.Equal(t, []string{"CLAIMED", "FAILED"}, service.marks)
+	assert.Equal(t, []string{
+		"StopInstance rightsizer-test us-east1-b alicja-test",
+		"ChangeMachineType rightsizer-test us-east1-b alicja-test custom-2-5120",
+		"StartInstance rightsizer-test us-east1-b alicja-test",
+	}, service.calls, "Stopped instance should be started again")
+}
+
+func TestApplyMachineTypeChangeOrder(t *testing.T) {
+	rec := makeRecommendation(applyRecName, 10,
+		&gcloudOperation{Action: "replace", Path: "/machineType", Resource: applyInstance, ResourceType: instanceResourceType,
+			Value: "zones/us-east1-b/machineTypes/n1-standard-2"})
+	rec.StateInfo = &gcloudStateInfo{State: "ACTIVE"}
+
+	service := newMockApplyService()
+	report, err := Apply(context.Background(), service, rec)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, len(report.Calls))
+	}
+	assert.Equal(t, []string{
+		"StopInstance rightsizer-test us-east1-b alicja-test",
+		"ChangeMachineType rightsizer-test us-east1-b alicja-test n1-standard-2",
+		"StartInstance rightsizer-test us-east1-b alicja-test",
+	}, service.calls, "Running instance should be stopped before the change and started after it")
+
+	service = newMockApplyService()
+	service.instance.Status = "TERMINATED"
+	_, err = Apply(context.Background(), service, rec)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"ChangeMachineType rightsizer-test us-east1-b alicja-test n1-standard-2",
+	}, service.calls, "Stopped instance should stay stopped")
+}
+
+// mockFailingDeleteService is mockSoftDeleteService failing to delete disks.
+type mockFailingDeleteService struct {
+	*mockSoftDeleteService
+	deletedSnapshots []string
+	marked           bool
+}
+
+func (s *mockFailingDeleteService) DeleteDisk(ctx context.Context, project, zone, disk string) error {
+	return errors.New("disk is in use")
+}
+
+func (s *mockFailingDeleteService) DeleteSnapshot(ctx context.Context, project, snapshot string) error {
+	s.deletedSnapshots = append(s.deletedSnapshots, project+"/"+snapshot)
+	return nil
+}
+
+func (s *mockFailingDeleteService) MarkRecommendationFailed(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	s.marked = true
+	return &gcloudRecommendation{Name: name, Etag: etag}, nil
+}
+
+func TestApplyCompensation(t *testing.T) {
+	rec, err := ParseRecommendation([]byte(diskRecommendationJSON))
+	if !assert.NoError(t, err) {
+		return
+	}
+	service := &mockFailingDeleteService{mockSoftDeleteService: newMockSoftDeleteService()}
+	naming := &SnapshotNaming{Prefix: "before-delete"}
+	_, err = Apply(context.Background(), service, rec, WithSnapshotNaming(naming))
+	assert.Error(t, err)
+	assert.True(t, service.marked)
+	assert.Empty(t, service.deletedSnapshots, "Snapshots should be kept by default")
+
+	service = &mockFailingDeleteService{mockSoftDeleteService: newMockSoftDeleteService()}
+	_, err = Apply(context.Background(), service, rec, WithSnapshotNaming(naming), WithOrphanedSnapshotCleanup())
+	assert.Error(t, err)
+	assert.True(t, service.marked)
+	assert.Equal(t, []string{"rightsizer-test/before-delete-krzysztofk2"}, service.deletedSnapshots)
+}
+
+func TestApplyInvalidSnapshotName(t *testing.T) {
+	rec, err := ParseRecommendation([]byte(diskRecommendationJSON))
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, naming := range []*SnapshotNaming{{Prefix: "Backup"}, {Prefix: "backup", TimestampFormat: "2006-01-02T15:04"}} {
+		service := newMockApplyService()
+		_, err = Apply(context.Background(), service, rec, WithSnapshotNaming(naming))
+		assert.Error(t, err, "Snapshot name rejected by GCE should not be used")
+		assert.Empty(t, service.calls)
+		assert.Empty(t, service.marks, "Recommendation should not be claimed if the snapshot name is invalid")
+	}
+}
+
+func TestPlanSnapshotOperation(t *testing.T) {
+	rec, err := ParseRecommendation([]byte(diskRecommendationJSON))
+	if !assert.NoError(t, err) {
+		return
+	}
+	operations := rec.Content.OperationGroups[0].Operations
+	call, err := planOperation(operations[0], nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, createSnapshotMethod, call.Method)
+		assert.Equal(t, "rightsizer-test", call.Project)
+		assert.Equal(t, "europe-west1-d", call.Zone)
+		assert.Equal(t, "krzysztofk2", call.Resource)
+		assert.Equal(t, maxSnapshotnameLen, len(call.Argument), "Snapshot name should be generated")
+	}
+	call, err = planOperation(operations[1], nil)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "DeleteDisk(rightsizer-test, europe-west1-d, krzysztofk2)", call.String())
+	}
+}
+
+func TestDoStartInstanceOperation(t *testing.T) {
+	service := newMockApplyService()
+	operation := &gcloudOperation{Action: "replace", Path: "/status", Resource: applyInstance, ResourceType: instanceResourceType, Value: "RUNNING"}
+	err := DoOperation(context.Background(), service, operation)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"StartInstance rightsizer-test us-east1-b alicja-test"}, service.calls)
+	progress := &OperationProgress{Operation: operation}
+	assert.Equal(t, "starting instance alicja-test", progress.Description())
+
+	operation.Value = "SUSPENDED"
+	err = DoOperation(context.Background(), service, operation)
+	assert.True(t, errors.Is(err, ErrOperationNotSupported), "Only TERMINATED and RUNNING statuses should be supported")
+}
+
+// recordingListener records the progress of Apply.
+type recordingListener struct {
+	events []string
+}
+
+func (l *recordingListener) OnGroupStart(recommendation string, group, numberOfGroups int) {
+	l.events = append(l.events, fmt.Sprintf("group %d/%d", group+1, numberOfGroups))
+}
+
+func (l *recordingListener) OnGroupDone(recommendation string, group int, err error) {
+	l.events = append(l.events, fmt.Sprintf("group %d done: %v", group+1, err))
+}
+
+func (l *recordingListener) OnOperationStart(progress *OperationProgress) {
+	l.events = append(l.events, progress.String())
+}
+
+func (l *recordingListener) OnOperationDone(progress *OperationProgress, err error) {
+	if err != nil {
+		l.events = append(l.events, "failed: "+progress.Description())
+	}
+}
+
+func TestApplyProgressListener(t *testing.T) {
+	listener := &recordingListener{}
+	_, err := Apply(context.Background(), newMockApplyService(), machineTypeRecommendation(), WithProgressListener(listener))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"group 1/1",
+		"0/2 operations done: checking /machineType of alicja-test",
+		"1/2 operations done: changing machine type of instance alicja-test",
+		"group 1 done: <nil>",
+	}, listener.events)
+
+	listener = &recordingListener{}
+	service := newMockApplyService()
+	service.failCalls = true
+	_, err = Apply(context.Background(), service, machineTypeRecommendation(), WithProgressListener(listener))
+	assert.Error(t, err)
+	if assert.True(t, len(listener.events) >= 2) {
+		assert.Equal(t, "failed: changing machine type of instance alicja-test", listener.events[len(listener.events)-2])
+		assert.Equal(t, "group 1 done: changing machine type of instance alicja-test: quota exceeded", listener.events[len(listener.events)-1])
+	}
+}
+
+func TestApplyErrors(t *testing.T) {
+	service := newMockApplyService()
+	service.instance.MachineType = changedMachineType
+	_, err := Apply(context.Background(), service, machineTypeRecommendation())
+	var testErr *ErrTestFailed
+	if assert.True(t, errors.As(err, &testErr), "Failed test operation should be reported as ErrTestFailed") {
+		assert.Equal(t, "/machineType", testErr.Path)
+		assert.Equal(t, changedMachineType, testErr.Got)
+		assert.Equal(t, "pattern .*zones/us-east1-b/machineTypes/n1-standard-4", testErr.Want)
+	}
+
+	rec := machineTypeRecommendation()
+	rec.StateInfo.State = "DISMISSED"
+	_, err = Apply(context.Background(), newMockApplyService(), rec)
+	assert.True(t, errors.Is(err, ErrNotActive), "Dismissed recommendation can't be applied")
+
+	rec = machineTypeRecommendation()
+	group := rec.Content.OperationGroups[0]
+	group.Operations = append(group.Operations, &gcloudOperation{Action: "replace", Path: "/status",
+		Resource: applyInstance, ResourceType: instanceResourceType, Value: "SUSPENDED"})
+	_, err = Apply(context.Background(), newMockApplyService(), rec, WithDryRun())
+	assert.True(t, errors.Is(err, ErrOperationNotSupported))
+}
+
+func TestApplyClaimed(t *testing.T) {
+	rec := machineTypeRecommendation()
+	rec.StateInfo = &gcloudStateInfo{State: "CLAIMED", StateMetadata: stateMetadata}
+	recordClaim(rec)
+	_, err := Apply(context.Background(), newMockApplyService(), rec)
+	assert.NoError(t, err, "Recommendation claimed by this run of recomator can be applied again")
+
+	for _, metadata := range []map[string]string{
+		{"owner": "someone"},
+		{ClaimedByMetadataKey: ClaimedByMetadataValue, ClaimTokenMetadataKey: "other"},
+	} {
+		rec.StateInfo.StateMetadata = metadata
+		service := newMockApplyService()
+		_, err = Apply(context.Background(), service, rec)
+		assert.True(t, errors.Is(err, ErrNotActive), "Recommendation claimed by someone else can't be applied")
+		assert.Empty(t, service.marks)
+	}
+
+	rec.StateInfo.StateMetadata = stateMetadata
+	rec.Etag = "changed"
+	_, err = Apply(context.Background(), newMockApplyService(), rec)
+	assert.True(t, errors.Is(err, ErrNotActive), "Recommendation changed since it was claimed can't be applied")
+}
+
+func TestApplyClaimedBeforeRestart(t *testing.T) {
+	claims.Lock()
+	claims.etags = make(map[string]string)
+	claims.Unlock()
+	rec := machineTypeRecommendation()
+	rec.Etag = "claimed"
+	rec.StateInfo = &gcloudStateInfo{State: "CLAIMED",
+		StateMetadata: map[string]string{ClaimedByMetadataKey: ClaimedByMetadataValue, ClaimTokenMetadataKey: "previous run"}}
+
+	_, err := Apply(context.Background(), newMockApplyService(), rec)
+	assert.True(t, errors.Is(err, ErrNotActive), "Claim of another run can't be recognized without its checkpoint")
+
+	store := NewMemoryCheckpointStore()
+	store.Store(&ApplyCheckpoint{Recommendation: rec.Name, ClaimToken: "previous run", Etag: "claimed"})
+	_, err = Apply(context.Background(), newMockApplyService(), rec, WithCheckpoints(store))
+	assert.NoError(t, err, "Recommendation claimed by the run that crashed can be applied again")
+}
+
+func TestApplyForce(t *testing.T) {
+	service := newMockApplyService()
+	service.instance.MachineType = changedMachineType
+	report, err := Apply(context.Background(), service, machineTypeRecommendation(), WithForce())
+	if assert.NoError(t, err, "Test operations should be skipped") {
+		assert.True(t, report.Forced)
+		assert.Equal(t, 3, len(report.Calls))
+	}
+	assert.Equal(t, []string{"CLAIMED", "SUCCEEDED"}, service.marks)
+}
+
+func TestDoOperationMalformedResource(t *testing.T) {
+	service := newMockApplyService()
+	operation := &gcloudOperation{Action: "remove", Path: "/", ResourceType: diskResourceType,
+		Resource: "//compute.googleapis.com/projects/p/regions/us-east1/addresses/a"}
+	err := DoOperation(context.Background(), service, operation)
+	assert.True(t, errors.Is(err, ErrOperationNotSupported), "Regional addresses are not supported")
+
+	operation.Resource = "//compute.googleapis.com/projects/p/disks/d"
+	err = DoOperation(context.Background(), service, operation)
+	var nameErr *resourcename.Error
+	assert.True(t, errors.As(err, &nameErr), "Malformed name should be reported")
+	assert.Empty(t, service.calls)
+}
+
+// mockSlowApplyService is mockApplyService with StopInstance finishing only when the context is done.
+type mockSlowApplyService struct {
+	*mockApplyService
+}
+
+func (s *mockSlowApplyService) StopInstance(ctx context.Context, project, zone, instance string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestApplyTimeouts(t *testing.T) {
+	for _, option := range []ApplyOption{WithStepTimeout(10 * time.Millisecond), WithApplyTimeout(10 * time.Millisecond)} {
+		service := &mockSlowApplyService{newMockApplyService()}
+		_, err := Apply(context.Background(), service, machineTypeRecommendation(), option)
+		assert.True(t, errors.Is(err, ErrTimeout), "Timeout should be reported, got %v", err)
+		assert.Equal(t, []string{"CLAIMED", "FAILED"}, service.marks, "Recommendation should be marked after the timeout")
+		assert.Empty(t, service.calls, "Machine type should not be changed after the timeout")
+	}
+
+	service := newMockApplyService()
+	_, err := Apply(context.Background(), service, machineTypeRecommendation(), WithStepTimeout(time.Minute), WithApplyTimeout(time.Hour))
+	assert.NoError(t, err)
+}
+
+func TestApplyLeaveStopped(t *testing.T) {
+	rec := machineTypeRecommendation()
+	service := newMockApplyService()
+	report, err := Apply(context.Background(), service, rec, WithLeaveStopped())
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{applyInstance}, report.LeftStopped)
+	}
+	assert.Equal(t, []string{
+		"StopInstance rightsizer-test us-east1-b alicja-test",
+		"ChangeMachineType rightsizer-test us-east1-b alicja-test custom-2-5120",
+	}, service.calls, "Instance should not be started")
+
+	service = newMockApplyService()
+	report, err = Apply(context.Background(), service, rec)
+	if assert.NoError(t, err) {
+		assert.Empty(t, report.LeftStopped)
+	}
+	assert.Equal(t, 3, len(service.calls), "Instance should be started by default")
+}
+
+func TestDoDeleteInstanceOperation(t *testing.T) {
+	service := newMockApplyService()
+	operation := &gcloudOperation{Action: "remove", Path: "/", Resource: applyInstance, ResourceType: instanceResourceType}
+	err := DoOperation(context.Background(), service, operation)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"DeleteInstance rightsizer-test us-east1-b alicja-test"}, service.calls)
+	progress := &OperationProgress{Operation: operation}
+	assert.Equal(t, "deleting instance alicja-test", progress.Description())
+
+	rec := makeRecommendation(idleRecName, 1, operation)
+	rec.StateInfo = &gcloudStateInfo{State: "ACTIVE"}
+	service = newMockApplyService()
+	_, err = Apply(context.Background(), service, rec, WithSoftDelete(time.Hour))
+	assert.True(t, errors.Is(err, ErrOperationNotSupported), "Soft delete of instances is not supported")
+	assert.Empty(t, service.calls, "Instance should not be deleted with WithSoftDelete")
+	assert.Empty(t, service.marks)
+}
+
+func TestApplyRegionalDisk(t *testing.T) {
+	regionalJSON := strings.ReplaceAll(diskRecommendationJSON, "zones/europe-west1-d/disks", "regions/europe-west1/disks")
+	rec, err := ParseRecommendation([]byte(regionalJSON))
+	if !assert.NoError(t, err) {
+		return
+	}
+	service := newMockApplyService()
+	report, err := Apply(context.Background(), service, rec)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, len(report.Snapshots), "Regional snapshot should be reported")
+		assert.Equal(t, "DeleteRegionalDisk(rightsizer-test, europe-west1, krzysztofk2)", report.Calls[1].String())
+	}
+	assert.Equal(t, []string{
+		"CreateRegionalSnapshot rightsizer-test europe-west1 krzysztofk2",
+		"DeleteRegionalDisk rightsizer-test europe-west1 krzysztofk2",
+	}, service.calls)
+
+	rec, _ = ParseRecommendation([]byte(regionalJSON))
+	service = newMockApplyService()
+	_, err = Apply(context.Background(), service, rec, WithSoftDelete(time.Hour))
+	assert.True(t, errors.Is(err, ErrOperationNotSupported), "Soft delete of regional disks is not supported")
+	assert.Empty(t, service.calls, "Snapshot should not be created if the disk can't be soft deleted")
+	assert.Empty(t, service.marks)
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/compute/v1"
+)
+
+const defaultApplyParallelism = 16
+
+// createdByMetadataKey is the key of the metadata item naming the instance group that created the instance.
+const createdByMetadataKey = "created-by"
+
+// instanceGroup returns the instance group that created the instance, or empty string if there is none.
+func instanceGroup(instance *compute.Instance) string {
+	if instance.Metadata == nil {
+		return ""
+	}
+	for _, item := range instance.Metadata.Items {
+		if item.Key == createdByMetadataKey && item.Value != nil {
+			return *item.Value
+		}
+	}
+	return ""
+}
+
+// failureDomain returns the failure domain of the instance modified by the recommendation:
+// its zone and the instance group or values of labels identifying the service it belongs to.
+// Empty string is returned if the recommendation doesn't modify an instance of a group or a labeled service.
+// If the error occurred, e.g. the instance couldn't be fetched, the returned error is not nil.
+func failureDomain(ctx context.Context, service GoogleService, rec *gcloudRecommendation, labels []string) (string, error) {
+	for _, group := range rec.Content.OperationGroups {
+		for _, operation := range group.Operations {
+			if operation.ResourceType != instanceResourceType {
+				continue
+			}
+			project, zone, name, err := parseZonalResource(operation.Resource)
+			if err != nil {
+				return "", err
+			}
+			instance, err := service.GetInstance(ctx, project, zone, name)
+			if err != nil {
+				return "", err
+			}
+			domain := instanceGroup(instance)
+			for _, label := range labels {
+				if value, ok := instance.Labels[label]; ok {
+					domain += "," + label + "=" + value
+				}
+			}
+			if domain == "" {
+				return "", nil
+			}
+			return strings.Join([]string{project, zone, domain}, "/"), nil
+		}
+	}
+	return "", nil
+}
+
+// domainLocks serializes applying recommendations in the same failure domain or capacity group.
+type domainLocks struct {
+	mutex sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// lock locks the domains in sorted order, so that locking several domains can't deadlock,
+// returning the function unlocking them. Empty domains aren't locked.
+func (d *domainLocks) lock(domains ...string) func() {
+	unique := make(map[string]bool)
+	for _, domain := range domains {
+		if domain != "" {
+			unique[domain] = true
+		}
+	}
+	var sorted []string
+	for domain := range unique {
+		sorted = append(sorted, domain)
+	}
+	sort.Strings(sorted)
+
+	var locks []*sync.Mutex
+	d.mutex.Lock()
+	for _, domain := range sorted {
+		lock, ok := d.locks[domain]
+		if !ok {
+			lock = &sync.Mutex{}
+			d.locks[domain] = lock
+		}
+		locks = append(locks, lock)
+	}
+	d.mutex.Unlock()
+	for _, lock := range locks {
+		lock.Lock()
+	}
+	return func() {
+		for _, lock := range locks {
+			lock.Unlock()
+		}
+	}
+}
+
+// ApplyResult is the result of applying one of the recommendations by ApplyAll.
+// At most one of Report and Err is non-nil. Error is the message of Err, so that it is serialized.
+type ApplyResult struct {
+	Recommendation *gcloudRecommendation `json:"recommendation"`
+	Report         *ApplyReport          `json:"report"`
+	Err            error                 `json:"-"`
+	Error          string                `json:"error,omitempty"`
+}
+
+// newApplyResult returns the result of applying the recommendation.
+func newApplyResult(rec *gcloudRecommendation, report *ApplyReport, err error) *ApplyResult {
+	result := &ApplyResult{Recommendation: rec, Report: report, Err: err}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// applyInDomain applies the recommendation with options, holding the lock of its failure domain
+// if config has failure domain labels, and the locks of its capacity groups if config has capacity floors.
+func applyInDomain(ctx context.Context, service GoogleService, rec *gcloudRecommendation, locks *domainLocks,
+	config *applyConfig, options []ApplyOption) *ApplyResult {
+	var domains []string
+	if config.failureDomainLabels != nil {
+		domain, err := failureDomain(ctx, service, rec, config.failureDomainLabels)
+		if err != nil {
+			return newApplyResult(rec, nil, fmt.Errorf("determining the failure domain of %s failed: %w", rec.Name, err))
+		}
+		domains = append(domains, domain)
+	}
+	if len(config.capacityFloors) != 0 {
+		groups, err := capacityGroups(ctx, service, rec, config.capacityFloors)
+		if err != nil {
+			return newApplyResult(rec, nil, fmt.Errorf("determining the capacity groups of %s failed: %w", rec.Name, err))
+		}
+		domains = append(domains, groups...)
+	}
+	defer locks.lock(domains...)()
+	report, err := Apply(ctx, service, rec, options...)
+	return newApplyResult(rec, report, err)
+}
+
+// ApplyAll applies the recommendations concurrently, using at most WithParallelism workers.
+// With WithFailureDomainLabels option, recommendations modifying instances of the same
+// failure domain are applied one at a time, recommendations whose failure domain can't be determined
+// are not applied and the error is recorded in their results. With WithCapacityFloor option, recommendations
+// that may stop instances of the same group are applied one at a time, see WithCapacityFloor.
+// Other options are passed to Apply for each recommendation.
+// Results are in the same order as recs, failure of one recommendation doesn't stop the others.
+// task structure tracks how many recommendations have been processed already.
+func ApplyAll(ctx context.Context, service GoogleService, recs []*gcloudRecommendation, task *Task, options ...ApplyOption) []*ApplyResult {
+	config := newApplyConfig(options)
+	numWorkers := config.parallelism
+	if numWorkers <= 0 {
+		numWorkers = defaultApplyParallelism
+	}
+	task.SetNumberOfSubtasks(len(recs))
+
+	locks := &domainLocks{locks: make(map[string]*sync.Mutex)}
+	results := make([]*ApplyResult, len(recs))
+	indices := make(chan int, len(recs))
+	done := make(chan struct{}, len(recs))
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			for index := range indices {
+				results[index] = applyInDomain(ctx, service, recs[index], locks, config, options)
+				task.IncrementDone()
+				done <- struct{}{}
+			}
+		}()
+	}
+
+	for i := range recs {
+		indices <- i
+	}
+	close(indices)
+	for range recs {
+		<-done
+	}
+	task.SetAllDone()
+	return results
+}
@@ -0,0 +1,174 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/compute/v1"
+)
+
+// mockConcurrentService counts concurrent calls modifying instances.
+type mockConcurrentService struct {
+	GoogleService
+	mutex         sync.Mutex
+	active        int
+	maxActive     int
+	modifications int
+}
+
+func (s *mockConcurrentService) GetInstance(ctx context.Context, project, zone, instance string) (*compute.Instance, error) {
+	return newMockApplyService().instance, nil
+}
+
+func (s *mockConcurrentService) modify() error {
+	s.mutex.Lock()
+	s.active++
+	s.modifications++
+	if s.active > s.maxActive {
+		s.maxActive = s.active
+	}
+	s.mutex.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	s.mutex.Lock()
+	s.active--
+	s.mutex.Unlock()
+	return nil
+}
+
+func (s *mockConcurrentService) StopInstance(ctx context.Context, project, zone, instance string) error {
+	return s.modify()
+}
+
+func (s *mockConcurrentService) StartInstance(ctx context.Context, project, zone, instance string) error {
+	return s.modify()
+}
+
+func (s *mockConcurrentService) ChangeMachineType(ctx context.Context, project, zone, instance, machineType string) error {
+	return s.modify()
+}
+
+func (s *mockConcurrentService) MarkRecommendationClaimed(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	return &gcloudRecommendation{Name: name, Etag: etag}, nil
+}
+
+func (s *mockConcurrentService) MarkRecommendationSucceeded(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	return &gcloudRecommendation{Name: name, Etag: etag}, nil
+}
+
+func TestApplyAll(t *testing.T) {
+	const numRecs = 20
+	var recs []*gcloudRecommendation
+	for i := 0; i < numRecs; i++ {
+		recs = append(recs, machineTypeRecommendation())
+	}
+	recs[5].StateInfo.State = "DISMISSED"
+
+	service := &mockConcurrentService{}
+	task := &Task{}
+	results := ApplyAll(context.Background(), service, recs, task, WithParallelism(3))
+	if !assert.Equal(t, numRecs, len(results)) {
+		return
+	}
+	for i, result := range results {
+		assert.Equal(t, recs[i], result.Recommendation, "Results should be in the same order as recommendations")
+		if i == 5 {
+			assert.Error(t, result.Err, "Dismissed recommendation can't be applied")
+			assert.Nil(t, result.Report)
+			encoded, err := json.Marshal(result)
+			if assert.NoError(t, err) {
+				assert.Contains(t, string(encoded), `"error":"`+result.Err.Error(), "Error should be serialized")
+			}
+		} else {
+			assert.NoError(t, result.Err)
+			assert.Empty(t, result.Error)
+		}
+	}
+	assert.Equal(t, 3*(numRecs-1), service.modifications, "Failure of one recommendation should not stop others")
+	assert.True(t, service.maxActive <= 3, "At most 3 recommendations should be applied concurrently")
+	done, all := task.GetProgress()
+	assert.Equal(t, done, all)
+}
+
+// mockLabeledService is mockConcurrentService whose instance has the label service=zk.
+type mockLabeledService struct {
+	*mockConcurrentService
+}
+
+func (s *mockLabeledService) GetInstance(ctx context.Context, project, zone, instance string) (*compute.Instance, error) {
+	result := newMockApplyService().instance
+	result.Labels = map[string]string{"service": "zk"}
+	return result, nil
+}
+
+func TestApplyAllFailureDomains(t *testing.T) {
+	var recs []*gcloudRecommendation
+	for i := 0; i < 6; i++ {
+		recs = append(recs, machineTypeRecommendation())
+	}
+	service := &mockLabeledService{&mockConcurrentService{}}
+	results := ApplyAll(context.Background(), service, recs, &Task{}, WithParallelism(3), WithFailureDomainLabels("service"))
+	for _, result := range results {
+		assert.NoError(t, result.Err)
+	}
+	assert.Equal(t, 1, service.maxActive, "Instances of the same service should not be modified concurrently")
+
+	domain, err := failureDomain(context.Background(), service, recs[0], []string{"service"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "rightsizer-test/us-east1-b/,service=zk", domain)
+	}
+	domain, err = failureDomain(context.Background(), service, recs[0], []string{"cluster"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "", domain, "Instances without the label should not be in a failure domain")
+	}
+}
+
+// mockMissingInstanceService is mockConcurrentService failing to get instances.
+type mockMissingInstanceService struct {
+	*mockConcurrentService
+}
+
+func (s *mockMissingInstanceService) GetInstance(ctx context.Context, project, zone, instance string) (*compute.Instance, error) {
+	return nil, errors.New("backend error")
+}
+
+func TestApplyAllFailureDomainError(t *testing.T) {
+	service := &mockMissingInstanceService{&mockConcurrentService{}}
+	results := ApplyAll(context.Background(), service, []*gcloudRecommendation{machineTypeRecommendation()}, &Task{},
+		WithFailureDomainLabels("service"))
+	if assert.Equal(t, 1, len(results)) {
+		assert.Error(t, results[0].Err, "Recommendation with unknown failure domain should not be applied")
+		assert.Contains(t, results[0].Error, "backend error")
+		assert.Nil(t, results[0].Report)
+	}
+	assert.Equal(t, 0, service.modifications)
+}
+
+func TestInstanceGroup(t *testing.T) {
+	group := "projects/123/zones/us-east1-b/instanceGroupManagers/web"
+	instance := &compute.Instance{Metadata: &compute.Metadata{Items: []*compute.MetadataItems{{Key: "created-by", Value: &group}}}}
+	assert.Equal(t, group, instanceGroup(instance))
+	assert.Equal(t, "", instanceGroup(&compute.Instance{}))
+}
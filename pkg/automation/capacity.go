@@ -0,0 +1,128 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// CapacityFloor is the minimum number of running instances of each group of instances
+// with the same value of Label, e.g. {"cluster", 2} for quorum-based services.
+type CapacityFloor struct {
+	Label      string
+	MinRunning int
+}
+
+// WithCapacityFloor makes Apply check, before stopping or deleting an instance with floor.Label,
+// also stopping it only to change its machine type, that at least
+// floor.MinRunning other instances in the project with the same value of the label are running.
+// Otherwise the recommendation is not claimed and ErrCapacityFloor is wrapped, so that it can be applied later.
+// ApplyAll applies recommendations for instances of the same group one at a time, also across zones,
+// so that each of them is checked against the state left by the others.
+// Requires compute.instances.list permission.
+func WithCapacityFloor(floor CapacityFloor) ApplyOption {
+	return func(c *applyConfig) {
+		c.capacityFloors = append(c.capacityFloors, floor)
+	}
+}
+
+// stopsInstance checks if the operation stops or deletes an instance.
+func stopsInstance(operation *gcloudOperation) bool {
+	return operation.Action == "replace" && operation.Path == "/status" && operation.Value == "TERMINATED" ||
+		operation.Action == "remove" && operation.ResourceType == instanceResourceType
+}
+
+// capacityGroups returns the groups of instances guarded by floors, as "project/label=value",
+// that the recommendation may stop or delete instances of.
+func capacityGroups(ctx context.Context, service GoogleService, rec *gcloudRecommendation, floors []CapacityFloor) ([]string, error) {
+	var groups []string
+	for _, group := range rec.Content.OperationGroups {
+		for _, operation := range group.Operations {
+			if !stopsInstance(operation) && !isMachineTypeOperation(operation) {
+				continue
+			}
+			project, zone, name, err := parseZonalResource(operation.Resource)
+			if err != nil {
+				return nil, err
+			}
+			instance, err := service.GetInstance(ctx, project, zone, name)
+			if err != nil {
+				return nil, err
+			}
+			for _, floor := range floors {
+				if value, ok := instance.Labels[floor.Label]; ok {
+					groups = append(groups, project+"/"+floor.Label+"="+value)
+				}
+			}
+		}
+	}
+	return groups, nil
+}
+
+// checkCapacityFloors returns the error wrapping ErrCapacityFloor if stopping or deleting an instance
+// by the recommendation would leave fewer running instances of its group than the floors allow.
+func checkCapacityFloors(ctx context.Context, service GoogleService, rec *gcloudRecommendation, floors []CapacityFloor) error {
+	for _, group := range rec.Content.OperationGroups {
+		for _, operation := range group.Operations {
+			stop := stopsInstance(operation)
+			if !stop && !isMachineTypeOperation(operation) {
+				continue
+			}
+			project, zone, name, err := parseZonalResource(operation.Resource)
+			if err != nil {
+				return err
+			}
+			instance, err := service.GetInstance(ctx, project, zone, name)
+			if err != nil {
+				return err
+			}
+			if !stop && instance.Status != "RUNNING" {
+				continue
+			}
+			var instances []*compute.Instance
+			for _, floor := range floors {
+				value, ok := instance.Labels[floor.Label]
+				if !ok {
+					continue
+				}
+				if instances == nil {
+					instances, err = service.ListInstances(ctx, project, "")
+					if err != nil {
+						return err
+					}
+				}
+				running := 0
+				for _, other := range instances {
+					if other.Name == name && lastPathElement(other.Zone) == zone {
+						continue
+					}
+					if other.Status == "RUNNING" && other.Labels[floor.Label] == value {
+						running++
+					}
+				}
+				if running < floor.MinRunning {
+					return fmt.Errorf("%w: stopping or deleting %s would leave %d running instances with %s=%s, at least %d required",
+						ErrCapacityFloor, name, running, floor.Label, value, floor.MinRunning)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/compute/v1"
+)
+
+// mockClusterService is mockApplyService whose instance belongs to the cluster zk.
+type mockClusterService struct {
+	*mockApplyService
+	cluster []*compute.Instance
+}
+
+func (s *mockClusterService) ListInstances(ctx context.Context, project, zone string) ([]*compute.Instance, error) {
+	return s.cluster, nil
+}
+
+func newMockClusterService() *mockClusterService {
+	service := &mockClusterService{mockApplyService: newMockApplyService()}
+	service.instance.Labels = map[string]string{"cluster": "zk"}
+	member := func(name, zone, status, cluster string) *compute.Instance {
+		return &compute.Instance{Name: name, Zone: "projects/rightsizer-test/zones/" + zone, Status: status,
+			Labels: map[string]string{"cluster": cluster}}
+	}
+	service.cluster = []*compute.Instance{
+		member("alicja-test", "us-east1-b", "RUNNING", "zk"),
+		member("alicja-test", "us-east1-c", "RUNNING", "zk"),
+		member("zk-2", "us-east1-b", "TERMINATED", "zk"),
+		member("web-1", "us-east1-b", "RUNNING", "web"),
+	}
+	return service
+}
+
+func TestApplyCapacityFloor(t *testing.T) {
+	service := newMockClusterService()
+	_, err := Apply(context.Background(), service, machineTypeRecommendation(), WithCapacityFloor(CapacityFloor{"cluster", 1}))
+	assert.NoError(t, err, "Instance with the same name in other zone should be counted")
+
+	service = newMockClusterService()
+	_, err = Apply(context.Background(), service, machineTypeRecommendation(), WithCapacityFloor(CapacityFloor{"cluster", 2}))
+	assert.True(t, errors.Is(err, ErrCapacityFloor), "Floor should be checked, got %v", err)
+	assert.Empty(t, service.marks, "Deferred recommendation should not be claimed")
+	assert.Empty(t, service.calls)
+
+	service = newMockClusterService()
+	_, err = Apply(context.Background(), service, machineTypeRecommendation(), WithCapacityFloor(CapacityFloor{"service", 2}))
+	assert.NoError(t, err, "Instances without the label should not be checked")
+
+	deletion := makeRecommendation(idleRecName, 1,
+		&gcloudOperation{Action: "remove", Path: "/", Resource: applyInstance, ResourceType: instanceResourceType})
+	deletion.StateInfo = &gcloudStateInfo{State: "ACTIVE"}
+	service = newMockClusterService()
+	_, err = Apply(context.Background(), service, deletion, WithCapacityFloor(CapacityFloor{"cluster", 2}))
+	assert.True(t, errors.Is(err, ErrCapacityFloor), "Deletions should be checked, got %v", err)
+	assert.Empty(t, service.calls)
+}
+
+// mockQuorumService is a cluster of running instances labeled cluster=zk in different zones,
+// stopping an instance takes some time and changes its status.
+type mockQuorumService struct {
+	GoogleService
+	mutex     sync.Mutex
+	instances map[string]*compute.Instance // by zone
+}
+
+func (s *mockQuorumService) GetInstance(ctx context.Context, project, zone, instance string) (*compute.Instance, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	result := *s.instances[zone]
+	return &result, nil
+}
+
+func (s *mockQuorumService) ListInstances(ctx context.Context, project, zone string) ([]*compute.Instance, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var result []*compute.Instance
+	for _, instance := range s.instances {
+		copied := *instance
+		result = append(result, &copied)
+	}
+	return result, nil
+}
+
+func (s *mockQuorumService) StopInstance(ctx context.Context, project, zone, instance string) error {
+	time.Sleep(10 * time.Millisecond)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.instances[zone].Status = "TERMINATED"
+	return nil
+}
+
+func (s *mockQuorumService) MarkRecommendationClaimed(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	return &gcloudRecommendation{Name: name, Etag: etag}, nil
+}
+
+func (s *mockQuorumService) MarkRecommendationSucceeded(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	return &gcloudRecommendation{Name: name, Etag: etag}, nil
+}
+
+func TestApplyAllCapacityFloor(t *testing.T) {
+	zones := []string{"us-east1-b", "us-east1-c"}
+	service := &mockQuorumService{instances: make(map[string]*compute.Instance)}
+	var recs []*gcloudRecommendation
+	for i, zone := range zones {
+		name := fmt.Sprintf("zk-%d", i)
+		service.instances[zone] = &compute.Instance{Name: name, Zone: "projects/rightsizer-test/zones/" + zone,
+			Status: "RUNNING", Labels: map[string]string{"cluster": "zk"}}
+		resource := fmt.Sprintf("//compute.googleapis.com/projects/rightsizer-test/zones/%s/instances/%s", zone, name)
+		rec := makeRecommendation(fmt.Sprintf("%s-%d", idleRecName, i), 1,
+			&gcloudOperation{Action: "test", Path: "/status", Resource: resource, ResourceType: instanceResourceType, Value: "RUNNING"},
+			&gcloudOperation{Action: "replace", Path: "/status", Resource: resource, ResourceType: instanceResourceType, Value: "TERMINATED"})
+		rec.StateInfo = &gcloudStateInfo{State: "ACTIVE"}
+		recs = append(recs, rec)
+	}
+
+	results := ApplyAll(context.Background(), service, recs, &Task{}, WithParallelism(2), WithCapacityFloor(CapacityFloor{"cluster", 1}))
+	var deferred int
+	for _, result := range results {
+		if result.Err != nil {
+			assert.True(t, errors.Is(result.Err, ErrCapacityFloor), "Unexpected error %v", result.Err)
+			deferred++
+		}
+	}
+	assert.Equal(t, 1, deferred, "Instances of the same group in different zones should not be stopped concurrently")
+	running, _ := service.ListInstances(context.Background(), "rightsizer-test", "")
+	assert.Contains(t, []string{running[0].Status, running[1].Status}, "RUNNING", "Floor should be kept")
+}
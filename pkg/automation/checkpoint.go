@@ -0,0 +1,131 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ApplyCheckpoint is the progress of Apply stored with WithCheckpoints option.
+// Done is the number of completed operations of the recommendation, counting all groups in order,
+// Calls are the calls made by them. ClaimToken and Etag identify the claim of the recommendation,
+// so that Resume applies it only if it is still claimed by the interrupted run of recomator.
+type ApplyCheckpoint struct {
+	Recommendation string           `json:"recommendation"`
+	ClaimToken     string           `json:"claimToken"`
+	Etag           string           `json:"etag"`
+	Done           int              `json:"done"`
+	Calls          []*OperationCall `json:"calls"`
+}
+
+// CheckpointStore is the interface for storing checkpoints of Apply, see WithCheckpoints.
+// To survive crashes implementations should persist checkpoints, e.g. in a file or a database.
+// Implementations must be thread-safe.
+type CheckpointStore interface {
+	// returns the checkpoint stored for the recommendation
+	Load(recommendation string) (*ApplyCheckpoint, bool)
+
+	// stores the checkpoint, replacing the previous one of the same recommendation
+	Store(checkpoint *ApplyCheckpoint)
+
+	// deletes the checkpoint of the recommendation
+	Delete(recommendation string)
+
+	// returns all stored checkpoints
+	List() []*ApplyCheckpoint
+}
+
+// memoryCheckpointStore implements CheckpointStore interface storing the checkpoints in memory.
+type memoryCheckpointStore struct {
+	data  map[string]*ApplyCheckpoint
+	mutex sync.Mutex
+}
+
+// NewMemoryCheckpointStore creates new CheckpointStore storing the checkpoints in memory.
+func NewMemoryCheckpointStore() CheckpointStore {
+	return &memoryCheckpointStore{data: make(map[string]*ApplyCheckpoint)}
+}
+
+func (s *memoryCheckpointStore) Load(recommendation string) (*ApplyCheckpoint, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	checkpoint, ok := s.data[recommendation]
+	return checkpoint, ok
+}
+
+func (s *memoryCheckpointStore) Store(checkpoint *ApplyCheckpoint) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data[checkpoint.Recommendation] = checkpoint
+}
+
+func (s *memoryCheckpointStore) Delete(recommendation string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.data, recommendation)
+}
+
+func (s *memoryCheckpointStore) List() []*ApplyCheckpoint {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var result []*ApplyCheckpoint
+	for _, checkpoint := range s.data {
+		result = append(result, checkpoint)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Recommendation < result[j].Recommendation })
+	return result
+}
+
+// Resume finishes applying the recommendation interrupted during Apply with WithCheckpoints(store) option,
+// e.g. by a crash: applies operations not completed according to the checkpoint in store
+// and marks the recommendation as succeeded or failed. The operation in progress during the interruption is applied again.
+// Options are used as in Apply, the checkpoint store is always set to store.
+// If the recommendation has been already marked as succeeded, only the checkpoint is deleted.
+// ErrNotActive is wrapped if the recommendation is no longer claimed as recorded in the checkpoint.
+// At most one of returned values will be non-nil.
+func Resume(ctx context.Context, service GoogleService, store CheckpointStore, name string, options ...ApplyOption) (*ApplyReport, error) {
+	ctx = ensureCorrelationID(ctx)
+	config := newApplyConfig(append(options, WithCheckpoints(store)))
+	if config.dryRun {
+		return nil, fmt.Errorf("recommendation %s can't be resumed in dry run", name)
+	}
+	checkpoint, ok := store.Load(name)
+	if !ok {
+		return nil, fmt.Errorf("no checkpoint of recommendation %s", name)
+	}
+	rec, err := service.GetRecommendation(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case claimedWith(rec, checkpoint.ClaimToken, checkpoint.Etag):
+	case rec.StateInfo.State == "SUCCEEDED":
+		store.Delete(name)
+		return newApplyReport(ctx, rec, checkpoint.Calls, config), nil
+	default:
+		store.Delete(name)
+		return nil, fmt.Errorf("%w: %s in state %s can't be resumed", ErrNotActive, name, rec.StateInfo.State)
+	}
+	err = ValidateRecommendation(rec)
+	if err != nil {
+		return nil, err
+	}
+	return finishApply(ctx, service, rec, rec.Etag, config, checkpoint)
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingCheckpointStore records all checkpoints stored in the wrapped store.
+type recordingCheckpointStore struct {
+	CheckpointStore
+	stored []*ApplyCheckpoint
+}
+
+func (s *recordingCheckpointStore) Store(checkpoint *ApplyCheckpoint) {
+	s.stored = append(s.stored, checkpoint)
+	s.CheckpointStore.Store(checkpoint)
+}
+
+// mockResumeService returns the recommendation in its current state.
+type mockResumeService struct {
+	*mockApplyService
+	rec *gcloudRecommendation
+}
+
+func (s *mockResumeService) GetRecommendation(ctx context.Context, name string) (*gcloudRecommendation, error) {
+	return s.rec, nil
+}
+
+func TestResume(t *testing.T) {
+	store := &recordingCheckpointStore{CheckpointStore: NewMemoryCheckpointStore()}
+	_, err := Apply(context.Background(), newMockApplyService(), machineTypeRecommendation(), WithCheckpoints(store))
+	if !assert.NoError(t, err) || !assert.Equal(t, 3, len(store.stored), "Checkpoint should be stored after claiming and every operation") {
+		return
+	}
+	assert.Empty(t, store.List(), "Checkpoint should be deleted after applying")
+
+	// the process crashed after the test operation
+	store.Store(store.stored[1])
+	rec := machineTypeRecommendation()
+	rec.StateInfo = &gcloudStateInfo{State: "CLAIMED", StateMetadata: stateMetadata}
+	rec.Etag = store.stored[1].Etag
+	service := &mockResumeService{mockApplyService: newMockApplyService(), rec: rec}
+	service.instance.MachineType = changedMachineType
+	report, err := Resume(context.Background(), service, store, applyRecName)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, len(report.Calls))
+	}
+	assert.Equal(t, []string{
+		"StopInstance rightsizer-test us-east1-b alicja-test",
+		"ChangeMachineType rightsizer-test us-east1-b alicja-test custom-2-5120",
+		"StartInstance rightsizer-test us-east1-b alicja-test",
+	}, service.calls, "Completed operations should not be applied again")
+	assert.Equal(t, []string{"SUCCEEDED"}, service.marks)
+	assert.Empty(t, store.List())
+
+	_, err = Resume(context.Background(), service, store, applyRecName)
+	assert.Error(t, err, "Recommendation without checkpoint can't be resumed")
+
+	store.Store(&ApplyCheckpoint{Recommendation: applyRecName})
+	rec.StateInfo.State = "SUCCEEDED"
+	_, err = Resume(context.Background(), service, store, applyRecName)
+	assert.NoError(t, err, "Checkpoint should be deleted if the recommendation succeeded")
+	assert.Empty(t, store.List())
+
+	store.Store(&ApplyCheckpoint{Recommendation: applyRecName, ClaimToken: claimToken, Etag: "claimed"})
+	rec.StateInfo.State = "CLAIMED"
+	rec.Etag = "reclaimed"
+	_, err = Resume(context.Background(), service, store, applyRecName)
+	assert.True(t, errors.Is(err, ErrNotActive), "Recommendation claimed again since the checkpoint can't be resumed")
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/sqladmin/v1beta4"
+)
+
+// activationPolicy of stopped Cloud SQL instances
+const sqlStoppedActivationPolicy = "NEVER"
+
+// sqlOperationPollInterval is the time between checks whether the Cloud SQL operation is done,
+// Cloud SQL Admin API has no method waiting for operations.
+var sqlOperationPollInterval = 2 * time.Second
+
+var sqlInstanceRegexp = regexp.MustCompile("^//sqladmin.googleapis.com/projects/([^/]+)/instances/([^/]+)$")
+
+// parseSQLInstance returns the project and the name of the Cloud SQL instance,
+// e.g. "//sqladmin.googleapis.com/projects/p/instances/i".
+func parseSQLInstance(resource string) (project, instance string, err error) {
+	match := sqlInstanceRegexp.FindStringSubmatch(resource)
+	if match == nil {
+		return "", "", fmt.Errorf("%w: resource %s is not a Cloud SQL instance", ErrOperationNotSupported, resource)
+	}
+	return match[1], match[2], nil
+}
+
+// ChangeSQLInstanceTier sets the tier of the Cloud SQL instance, e.g. "db-custom-2-7680",
+// using instances.patch method, and waits for the operation to finish. The instance is restarted.
+// Requires cloudsql.instances.update permission.
+func (s *googleService) ChangeSQLInstanceTier(ctx context.Context, project, instance, tier string) error {
+	return s.patchSQLInstanceSettings(ctx, project, instance, &sqladmin.Settings{Tier: tier})
+}
+
+// StopSQLInstance stops the Cloud SQL instance by setting its activation policy to NEVER,
+// using instances.patch method, and waits for the operation to finish.
+// Requires cloudsql.instances.update permission.
+func (s *googleService) StopSQLInstance(ctx context.Context, project, instance string) error {
+	return s.patchSQLInstanceSettings(ctx, project, instance, &sqladmin.Settings{ActivationPolicy: sqlStoppedActivationPolicy})
+}
+
+// GetSQLInstance calls the instances.get method of Cloud SQL Admin API.
+// Requires cloudsql.instances.get permission.
+// At most one of returned values will be non-nil.
+func (s *googleService) GetSQLInstance(ctx context.Context, project, instance string) (*sqladmin.DatabaseInstance, error) {
+	instancesService := sqladmin.NewInstancesService(s.sqlAdminService)
+	return instancesService.Get(project, instance).Context(ctx).Do()
+}
+
+// patchSQLInstanceSettings updates the settings of the instance that are set in settings.
+func (s *googleService) patchSQLInstanceSettings(ctx context.Context, project, instance string, settings *sqladmin.Settings) error {
+	instancesService := sqladmin.NewInstancesService(s.sqlAdminService)
+	operation, err := instancesService.Patch(project, instance, &sqladmin.DatabaseInstance{Settings: settings}).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return s.waitForSQLOperation(ctx, project, operation)
+}
+
+// waitForSQLOperation polls the Cloud SQL operation until it is done.
+// Returns OperationError if the operation failed, or an error wrapping the context error
+// if it wasn't done before the operation timeout.
+func (s *googleService) waitForSQLOperation(ctx context.Context, project string, operation *sqladmin.Operation) error {
+	timeout := s.operationTimeout
+	if timeout <= 0 {
+		timeout = defaultOperationTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	operationsService := sqladmin.NewOperationsService(s.sqlAdminService)
+	for operation.Status != "DONE" {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for operation %s: %w", operation.Name, ctx.Err())
+		case <-time.After(sqlOperationPollInterval):
+		}
+		current, err := operationsService.Get(project, operation.Name).Context(ctx).Do()
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("waiting for operation %s: %w", operation.Name, ctx.Err())
+			}
+			return err
+		}
+		operation = current
+	}
+	if operation.Error != nil && len(operation.Error.Errors) != 0 {
+		var errs []*compute.OperationErrorErrors
+		for _, item := range operation.Error.Errors {
+			errs = append(errs, &compute.OperationErrorErrors{Code: item.Code, Message: item.Message})
+		}
+		return &OperationError{Operation: operation.Name, Errors: errs}
+	}
+	return nil
+}
+
+// isSQLCall returns whether the call modifies a Cloud SQL instance.
+func isSQLCall(call *OperationCall) bool {
+	return call.Method == changeSQLInstanceTierMethod || call.Method == stopSQLInstanceMethod
+}
+
+// sqlInstanceValue returns the value of the Cloud SQL instance at the path of the operation,
+// one of "/state", "/settings/tier" and "/settings/activationPolicy".
+func sqlInstanceValue(instance *sqladmin.DatabaseInstance, path string) (string, error) {
+	switch path {
+	case "/state":
+		return instance.State, nil
+	case "/settings/tier", "/settings/activationPolicy":
+		if instance.Settings == nil {
+			return "", nil
+		}
+		if path == "/settings/tier" {
+			return instance.Settings.Tier, nil
+		}
+		return instance.Settings.ActivationPolicy, nil
+	default:
+		return "", fmt.Errorf("%w: test of path %s", ErrOperationNotSupported, path)
+	}
+}
+
+// testSQLOperation checks that the value of the Cloud SQL instance at the path of the test operation
+// matches the operation, otherwise the error is returned.
+func testSQLOperation(ctx context.Context, service GoogleService, operation *gcloudOperation) error {
+	project, name, err := parseSQLInstance(operation.Resource)
+	if err != nil {
+		return err
+	}
+	instance, err := service.GetSQLInstance(ctx, project, name)
+	if err != nil {
+		return err
+	}
+	value, err := sqlInstanceValue(instance, operation.Path)
+	if err != nil {
+		return err
+	}
+	return checkTestValue(operation, value)
+}
+
+// planSQLOperation returns the call applying the operation on the Cloud SQL instance,
+// which must not be a test operation. Tiers are changed by replacing /settings/tier, instances are stopped
+// by replacing /settings/activationPolicy with NEVER or /state with STOPPED.
+func planSQLOperation(operation *gcloudOperation) (*OperationCall, error) {
+	project, instance, err := parseSQLInstance(operation.Resource)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case operation.Action == "replace" && operation.Path == "/settings/tier":
+		tier, ok := operation.Value.(string)
+		if !ok {
+			return nil, fmt.Errorf("tier must be a string, got %T", operation.Value)
+		}
+		return &OperationCall{changeSQLInstanceTierMethod, project, "", instance, tier}, nil
+	case operation.Action == "replace" && operation.Path == "/settings/activationPolicy" && operation.Value == sqlStoppedActivationPolicy,
+		operation.Action == "replace" && operation.Path == "/state" && operation.Value == "STOPPED":
+		return &OperationCall{stopSQLInstanceMethod, project, "", instance, ""}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s %s of %s", ErrOperationNotSupported, operation.Action, operation.Path, operation.ResourceType)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/sqladmin/v1beta4"
+)
+
+const testSQLInstance = "//sqladmin.googleapis.com/projects/p/instances/db"
+
+// mockSQLService is mockApplyService with a Cloud SQL instance, recording calls modifying it.
+type mockSQLService struct {
+	*mockApplyService
+	sqlInstance *sqladmin.DatabaseInstance
+}
+
+func (s *mockSQLService) GetSQLInstance(ctx context.Context, project, instance string) (*sqladmin.DatabaseInstance, error) {
+	return s.sqlInstance, nil
+}
+
+func (s *mockSQLService) ChangeSQLInstanceTier(ctx context.Context, project, instance, tier string) error {
+	s.calls = append(s.calls, "ChangeSQLInstanceTier "+project+" "+instance+" "+tier)
+	return nil
+}
+
+func (s *mockSQLService) StopSQLInstance(ctx context.Context, project, instance string) error {
+	s.calls = append(s.calls, "StopSQLInstance "+project+" "+instance)
+	return nil
+}
+
+func newMockSQLService() *mockSQLService {
+	return &mockSQLService{
+		mockApplyService: newMockApplyService(),
+		sqlInstance: &sqladmin.DatabaseInstance{
+			State:    "RUNNABLE",
+			Settings: &sqladmin.Settings{Tier: "db-custom-4-15360", ActivationPolicy: "ALWAYS"},
+		},
+	}
+}
+
+func sqlRecommendation(recommender string, operations ...*gcloudOperation) *gcloudRecommendation {
+	rec := makeRecommendation("projects/p/locations/us-central1/recommenders/"+recommender+"/recommendations/r", 1, operations...)
+	rec.StateInfo = &gcloudStateInfo{State: "ACTIVE"}
+	return rec
+}
+
+func tierRecommendation() *gcloudRecommendation {
+	return sqlRecommendation("google.cloudsql.instance.OverprovisionedRecommender",
+		&gcloudOperation{Action: "test", Path: "/state", Resource: testSQLInstance, ResourceType: sqlInstanceResourceType, Value: "RUNNABLE"},
+		&gcloudOperation{Action: "test", Path: "/settings/tier", Resource: testSQLInstance, ResourceType: sqlInstanceResourceType, Value: "db-custom-4-15360"},
+		&gcloudOperation{Action: "replace", Path: "/settings/tier", Resource: testSQLInstance, ResourceType: sqlInstanceResourceType, Value: "db-custom-2-7680"})
+}
+
+func TestApplySQLTierRecommendation(t *testing.T) {
+	service := newMockSQLService()
+	_, err := Apply(context.Background(), service, tierRecommendation())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ChangeSQLInstanceTier p db db-custom-2-7680"}, service.calls)
+	assert.Equal(t, []string{"CLAIMED", "SUCCEEDED"}, service.marks)
+
+	service = newMockSQLService()
+	service.sqlInstance.Settings.Tier = "db-custom-8-30720"
+	_, err = Apply(context.Background(), service, tierRecommendation())
+	var testErr *ErrTestFailed
+	assert.True(t, errors.As(err, &testErr), "Test of the tier should fail")
+	assert.Empty(t, service.calls)
+
+	progress := &OperationProgress{Operation: tierRecommendation().Content.OperationGroups[0].Operations[2]}
+	assert.Equal(t, "changing tier of Cloud SQL instance db", progress.Description())
+}
+
+func TestApplySQLIdleRecommendation(t *testing.T) {
+	for _, operation := range []*gcloudOperation{
+		{Action: "replace", Path: "/settings/activationPolicy", Resource: testSQLInstance, ResourceType: sqlInstanceResourceType, Value: "NEVER"},
+		{Action: "replace", Path: "/state", Resource: testSQLInstance, ResourceType: sqlInstanceResourceType, Value: "STOPPED"},
+	} {
+		service := newMockSQLService()
+		rec := sqlRecommendation("google.cloudsql.instance.IdleRecommender",
+			&gcloudOperation{Action: "test", Path: "/state", Resource: testSQLInstance, ResourceType: sqlInstanceResourceType, Value: "RUNNABLE"},
+			operation)
+		_, err := Apply(context.Background(), service, rec)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"StopSQLInstance p db"}, service.calls, "Instance should be stopped by replacing %s", operation.Path)
+	}
+}
+
+func TestStopSQLInstance(t *testing.T) {
+	defer func(interval time.Duration) { sqlOperationPollInterval = interval }(sqlOperationPollInterval)
+	sqlOperationPollInterval = time.Millisecond
+
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+string(body))
+		w.Header().Set("Content-Type", "application/json")
+		status := "RUNNING"
+		if r.Method == http.MethodGet {
+			status = "DONE"
+		}
+		fmt.Fprintf(w, `{"name": "operation-1", "status": "%s"}`, status)
+	}))
+	defer server.Close()
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	service, err := NewGoogleServiceFromTokenSource(context.Background(), tokenSource,
+		WithEndpoint(sqlAdminAPI, server.URL+"/"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = service.StopSQLInstance(context.Background(), "p", "db")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`PATCH /sql/v1beta4/projects/p/instances/db {"settings":{"activationPolicy":"NEVER"}}` + "\n",
+		"GET /sql/v1beta4/projects/p/operations/operation-1 ",
+	}, requests)
+}
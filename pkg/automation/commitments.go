@@ -0,0 +1,45 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import "fmt"
+
+const commitmentRecommenderID = "google.compute.commitment.UsageCommitmentRecommender"
+
+// reportOnlyRecommenders are recommenders whose recommendations are listed with their cost projections,
+// but never applied, e.g. purchasing committed use discounts must be decided by the user.
+var reportOnlyRecommenders = map[string]bool{
+	commitmentRecommenderID: true,
+}
+
+// IsReportOnly returns whether the recommendation is only listed and can't be applied by Apply,
+// e.g. the recommendation to purchase a commitment.
+func IsReportOnly(rec *gcloudRecommendation) bool {
+	if rec == nil {
+		return false
+	}
+	recommenderName, _ := recommenderID(rec.Name)
+	return reportOnlyRecommenders[recommenderName]
+}
+
+// checkNotReportOnly returns the error wrapping ErrReportOnly if the recommendation is report-only.
+func checkNotReportOnly(rec *gcloudRecommendation) error {
+	if IsReportOnly(rec) {
+		return fmt.Errorf("%w: %s", ErrReportOnly, rec.Name)
+	}
+	return nil
+}
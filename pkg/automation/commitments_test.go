@@ -0,0 +1,49 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func commitmentRecommendation() *gcloudRecommendation {
+	rec := makeRecommendation("projects/p/locations/us-central1/recommenders/google.compute.commitment.UsageCommitmentRecommender/recommendations/r", 100,
+		&gcloudOperation{Action: "add", Path: "/", Resource: "//compute.googleapis.com/projects/p/regions/us-central1/commitments/c",
+			ResourceType: "compute.googleapis.com/Commitment", Value: map[string]interface{}{"plan": "TWELVE_MONTH"}})
+	rec.StateInfo = &gcloudStateInfo{State: "ACTIVE"}
+	return rec
+}
+
+func TestApplyReportOnlyRecommendation(t *testing.T) {
+	rec := commitmentRecommendation()
+	assert.True(t, IsReportOnly(rec))
+	assert.False(t, IsReportOnly(machineTypeRecommendation()))
+
+	service := newMockApplyService()
+	_, err := Apply(context.Background(), service, rec)
+	assert.True(t, errors.Is(err, ErrReportOnly), "Commitments should never be purchased by Apply")
+	assert.Empty(t, service.marks, "Recommendation shouldn't be claimed")
+
+	applicability, err := CheckApplicability(context.Background(), service, rec)
+	if assert.NoError(t, err) {
+		assert.False(t, applicability.Applicable())
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/segmentio/ksuid"
+)
+
+// CorrelationHeader is the header with the correlation ID sent on API calls made by googleService.
+const CorrelationHeader = "X-Correlation-Id"
+
+// correlationUserAgentPrefix prefixes the correlation ID appended to User-Agent,
+// which is recorded as callerSuppliedUserAgent in Cloud Audit Logs.
+const correlationUserAgentPrefix = " recomator-correlation-id/"
+
+type correlationKey struct{}
+
+// NewCorrelationID returns new unique correlation ID.
+func NewCorrelationID() string {
+	return ksuid.New().String()
+}
+
+// WithCorrelationID returns the context carrying the correlation ID, used to trace a task, e.g. Apply,
+// across recomator and Cloud Audit Logs. googleService sends it on all API calls made with the context.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the correlation ID carried by the context, or empty string if there is none.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// ensureCorrelationID returns the context carrying a correlation ID, new one if ctx doesn't carry any.
+func ensureCorrelationID(ctx context.Context) context.Context {
+	if CorrelationID(ctx) != "" {
+		return ctx
+	}
+	return WithCorrelationID(ctx, NewCorrelationID())
+}
+
+// correlationTransport adds the correlation ID of the request context
+// to CorrelationHeader and User-Agent headers of the requests.
+type correlationTransport struct {
+	base http.RoundTripper
+}
+
+func (t *correlationTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := CorrelationID(req.Context())
+	if id == "" {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set(CorrelationHeader, id)
+	req.Header.Set("User-Agent", req.Header.Get("User-Agent")+correlationUserAgentPrefix+id)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestCorrelationID(t *testing.T) {
+	var headers []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"items": [{"name": "zone1"}]}`)
+	}))
+	defer server.Close()
+
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	service, err := NewGoogleServiceFromTokenSource(context.Background(), tokenSource,
+		WithEndpoint(computeAPI, server.URL+"/compute/v1/projects/"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	id := NewCorrelationID()
+	_, err = service.ListZonesNames(WithCorrelationID(context.Background(), id), "project")
+	assert.NoError(t, err)
+	_, err = service.ListZonesNames(context.Background(), "project")
+	assert.NoError(t, err)
+	if assert.Equal(t, 2, len(headers)) {
+		assert.Equal(t, id, headers[0].Get(CorrelationHeader))
+		assert.True(t, strings.HasSuffix(headers[0].Get("User-Agent"), "recomator-correlation-id/"+id),
+			"Correlation ID should be appended to User-Agent, got %s", headers[0].Get("User-Agent"))
+		assert.Equal(t, "", headers[1].Get(CorrelationHeader), "Calls without correlation ID should not be changed")
+		assert.True(t, strings.HasPrefix(headers[1].Get("User-Agent"), "recomator/"+Version+" (endpoints) "),
+			"User-Agent should start with recomator, got %s", headers[1].Get("User-Agent"))
+	}
+}
+
+func TestApplyCorrelationID(t *testing.T) {
+	report, err := Apply(WithCorrelationID(context.Background(), "id"), newMockApplyService(), machineTypeRecommendation())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "id", report.CorrelationID)
+	}
+	report, err = Apply(context.Background(), newMockApplyService(), machineTypeRecommendation())
+	if assert.NoError(t, err) {
+		assert.NotEmpty(t, report.CorrelationID, "New correlation ID should be generated")
+	}
+}
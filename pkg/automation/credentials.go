@@ -0,0 +1,156 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// tokens expiring in less than refreshMargin are refreshed before being used,
+// so that long running applies don't fail in the middle because of expired credentials.
+const refreshMargin = 5 * time.Minute
+
+// TokenCache is the interface for storing OAuth tokens, for example per user or per project.
+// Implementations must be thread-safe.
+type TokenCache interface {
+	// returns token stored for key
+	Load(key string) (*oauth2.Token, bool)
+
+	// stores token for key
+	Store(key string, tok *oauth2.Token)
+}
+
+// memoryTokenCache implements TokenCache interface storing the tokens in memory.
+type memoryTokenCache struct {
+	data  map[string]*oauth2.Token
+	mutex sync.Mutex
+}
+
+// NewMemoryTokenCache creates new TokenCache storing the tokens in memory.
+func NewMemoryTokenCache() TokenCache {
+	return &memoryTokenCache{data: make(map[string]*oauth2.Token)}
+}
+
+func (c *memoryTokenCache) Load(key string) (*oauth2.Token, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	tok, ok := c.data[key]
+	return tok, ok
+}
+
+func (c *memoryTokenCache) Store(key string, tok *oauth2.Token) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.data[key] = tok
+}
+
+// TokenRefreshStats counts token refreshes and their failures.
+// All methods are thread-safe.
+type TokenRefreshStats struct {
+	refreshes int
+	failures  int
+	lastError error
+	mutex     sync.Mutex
+}
+
+func (s *TokenRefreshStats) record(err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.refreshes++
+	if err != nil {
+		s.failures++
+		s.lastError = err
+	}
+}
+
+// GetStats returns the number of refreshes, the number of failed refreshes and the last refresh error.
+func (s *TokenRefreshStats) GetStats() (int, int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.refreshes, s.failures, s.lastError
+}
+
+// cachedTokenSource implements oauth2.TokenSource interface
+// returning the token stored in cache and refreshing it if needed.
+type cachedTokenSource struct {
+	ctx   context.Context
+	conf  *oauth2.Config
+	cache TokenCache
+	key   string
+	stats *TokenRefreshStats
+	mutex sync.Mutex
+}
+
+// NewCachedTokenSource creates a token source returning the token stored in cache for key.
+// If the token expires in less than refreshMargin, it is refreshed using conf and stored back in cache.
+// Every refresh is recorded in stats, unless it is nil.
+func NewCachedTokenSource(ctx context.Context, conf *oauth2.Config, cache TokenCache, key string, stats *TokenRefreshStats) oauth2.TokenSource {
+	return &cachedTokenSource{ctx: ctx, conf: conf, cache: cache, key: key, stats: stats}
+}
+
+// needsRefresh checks if the token has expired or will expire soon.
+func needsRefresh(tok *oauth2.Token) bool {
+	if tok.Expiry.IsZero() {
+		return tok.AccessToken == ""
+	}
+	return tok.Expiry.Before(time.Now().Add(refreshMargin))
+}
+
+func (s *cachedTokenSource) Token() (*oauth2.Token, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	tok, ok := s.cache.Load(s.key)
+	if !ok {
+		tok = &oauth2.Token{}
+	}
+	if !needsRefresh(tok) {
+		return tok, nil
+	}
+
+	// access token is dropped to make the source refresh it
+	newTok, err := s.conf.TokenSource(s.ctx, &oauth2.Token{RefreshToken: tok.RefreshToken}).Token()
+	if s.stats != nil {
+		s.stats.record(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.cache.Store(s.key, newTok)
+	return newTok, nil
+}
+
+// NewDelegatedGoogleService creates new googleServices acting on behalf of subject (user email)
+// using domain-wide delegation of the service account, so that users of Workspace-managed
+// organizations don't have to complete the OAuth flow themselves.
+// serviceAccountJSON is the JSON key of the service account, which must be allowed to impersonate users
+// with scopes in the admin console. RequiredScopes can be used to compute scopes.
+// If creation failed the error will be non-nil.
+func NewDelegatedGoogleService(ctx context.Context, serviceAccountJSON []byte, subject string, scopes []string, options ...ServiceOption) (GoogleService, error) {
+	conf, err := google.JWTConfigFromJSON(serviceAccountJSON, scopes...)
+	if err != nil {
+		return nil, err
+	}
+	conf.Subject = subject
+	config := newServiceConfig(options)
+	ctx = config.withHTTPClient(ctx)
+	return newGoogleService(ctx, config, conf.TokenSource(ctx))
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// newTokenServer creates a server issuing tokens "token 1", "token 2", ...
+// If fail is true, the server responds with an error.
+func newTokenServer(fail *bool) *httptest.Server {
+	issued := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if *fail {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		issued++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": "token %d", "token_type": "Bearer", "expires_in": 3600}`, issued)
+	}))
+}
+
+func TestCachedTokenSource(t *testing.T) {
+	fail := false
+	server := newTokenServer(&fail)
+	defer server.Close()
+
+	conf := &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: server.URL}}
+	cache := NewMemoryTokenCache()
+	cache.Store("user", &oauth2.Token{AccessToken: "old", RefreshToken: "refresh", Expiry: time.Now().Add(time.Minute)})
+	stats := &TokenRefreshStats{}
+	source := NewCachedTokenSource(context.Background(), conf, cache, "user", stats)
+
+	tok, err := source.Token()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "token 1", tok.AccessToken, "Token expiring soon should be refreshed")
+		assert.Equal(t, "refresh", tok.RefreshToken, "Refresh token should be kept")
+		cached, _ := cache.Load("user")
+		assert.Equal(t, tok, cached, "Refreshed token should be stored in cache")
+	}
+
+	tok, err = source.Token()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "token 1", tok.AccessToken, "Valid token should be reused")
+	}
+
+	refreshes, failures, lastErr := stats.GetStats()
+	assert.Equal(t, 1, refreshes)
+	assert.Equal(t, 0, failures)
+	assert.NoError(t, lastErr)
+}
+
+func TestCachedTokenSourceClient(t *testing.T) {
+	fail := false
+	tokenServer := newTokenServer(&fail)
+	defer tokenServer.Close()
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"items": [{"name": "zone1"}]}`)
+	}))
+	defer server.Close()
+
+	conf := &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: tokenServer.URL}}
+	cache := NewMemoryTokenCache()
+	cache.Store("user", &oauth2.Token{AccessToken: "valid", RefreshToken: "refresh", Expiry: time.Now().Add(time.Hour)})
+	source := NewCachedTokenSource(context.Background(), conf, cache, "user", &TokenRefreshStats{})
+	service, err := NewGoogleServiceFromTokenSource(context.Background(), source,
+		WithEndpoint(computeAPI, server.URL+"/compute/v1/projects/"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = service.ListZonesNames(context.Background(), "project")
+	assert.NoError(t, err)
+	cache.Store("user", &oauth2.Token{AccessToken: "old", RefreshToken: "refresh", Expiry: time.Now().Add(time.Minute)})
+	_, err = service.ListZonesNames(context.Background(), "project")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Bearer valid", "Bearer token 1"}, authorizations,
+		"Token expiring soon should be refreshed before the call")
+}
+
+func TestCachedTokenSourceWithoutStats(t *testing.T) {
+	fail := false
+	server := newTokenServer(&fail)
+	defer server.Close()
+
+	conf := &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: server.URL}}
+	cache := NewMemoryTokenCache()
+	cache.Store("user", &oauth2.Token{AccessToken: "old", RefreshToken: "refresh", Expiry: time.Now().Add(time.Minute)})
+	source := NewCachedTokenSource(context.Background(), conf, cache, "user", nil)
+	tok, err := source.Token()
+	if assert.NoError(t, err, "Stats should be optional") {
+		assert.Equal(t, "token 1", tok.AccessToken)
+	}
+}
+
+func TestCachedTokenSourceFailure(t *testing.T) {
+	fail := true
+	server := newTokenServer(&fail)
+	defer server.Close()
+
+	conf := &oauth2.Config{Endpoint: oauth2.Endpoint{TokenURL: server.URL}}
+	stats := &TokenRefreshStats{}
+	source := NewCachedTokenSource(context.Background(), conf, NewMemoryTokenCache(), "user", stats)
+
+	_, err := source.Token()
+	assert.Error(t, err, "Failed refresh should result in error")
+	refreshes, failures, lastErr := stats.GetStats()
+	assert.Equal(t, 1, refreshes)
+	assert.Equal(t, 1, failures, "Failed refresh should be counted")
+	assert.Equal(t, err, lastErr)
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import "fmt"
+
+// CurrencyConverter is the interface for converting amounts of money between currencies,
+// e.g. to report savings of projects billed in different currencies together.
+// Implementations must be thread-safe.
+type CurrencyConverter interface {
+	// converts amount in currency from to currency to
+	Convert(amount float64, from, to string) (float64, error)
+}
+
+// staticRatesConverter implements CurrencyConverter interface using fixed exchange rates.
+type staticRatesConverter struct {
+	rates map[string]float64 // units of the currency equal to one unit of the base currency
+}
+
+// NewStaticRatesConverter creates new CurrencyConverter using fixed exchange rates.
+// rates contain units of each currency equal to one unit of the base currency,
+// e.g. NewStaticRatesConverter("USD", map[string]float64{"EUR": 0.85}).
+// The rates are not updated, so they should be reloaded periodically for reports.
+func NewStaticRatesConverter(base string, rates map[string]float64) CurrencyConverter {
+	converter := &staticRatesConverter{rates: map[string]float64{base: 1}}
+	for currencyCode, rate := range rates {
+		converter.rates[currencyCode] = rate
+	}
+	return converter
+}
+
+func (c *staticRatesConverter) Convert(amount float64, from, to string) (float64, error) {
+	if from == to {
+		return amount, nil
+	}
+	fromRate, ok := c.rates[from]
+	if !ok || fromRate <= 0 {
+		return 0, fmt.Errorf("exchange rate of %s is unknown", from)
+	}
+	toRate, ok := c.rates[to]
+	if !ok || toRate <= 0 {
+		return 0, fmt.Errorf("exchange rate of %s is unknown", to)
+	}
+	return amount / fromRate * toRate, nil
+}
+
+// NormalizeSavings returns the total of savings given per currency code,
+// such as ResourceCard.Savings or HierarchyNode.Savings, converted to currencyCode.
+// If the error occurred the returned error is not nil.
+func NormalizeSavings(savings map[string]float64, converter CurrencyConverter, currencyCode string) (float64, error) {
+	total := 0.0
+	for from, amount := range savings {
+		converted, err := converter.Convert(amount, from, currencyCode)
+		if err != nil {
+			return 0, err
+		}
+		total += converted
+	}
+	return total, nil
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaticRatesConvert(t *testing.T) {
+	converter := NewStaticRatesConverter("USD", map[string]float64{"EUR": 0.5, "PLN": 4})
+	converted, err := converter.Convert(10, "EUR", "PLN")
+	if assert.NoError(t, err) {
+		assert.InDelta(t, 80, converted, 1e-9, "Conversion should go through the base currency")
+	}
+	converted, err = converter.Convert(10, "USD", "EUR")
+	if assert.NoError(t, err) {
+		assert.InDelta(t, 5, converted, 1e-9)
+	}
+	converted, err = converter.Convert(10, "XYZ", "XYZ")
+	if assert.NoError(t, err, "Converting to the same currency doesn't need the rate") {
+		assert.Equal(t, 10.0, converted)
+	}
+	_, err = converter.Convert(10, "XYZ", "USD")
+	assert.Error(t, err, "Unknown currency should result in error")
+}
+
+func TestNormalizeSavings(t *testing.T) {
+	converter := NewStaticRatesConverter("USD", map[string]float64{"EUR": 0.5})
+	total, err := NormalizeSavings(map[string]float64{"USD": 3, "EUR": 1}, converter, "USD")
+	if assert.NoError(t, err) {
+		assert.InDelta(t, 5, total, 1e-9)
+	}
+	_, err = NormalizeSavings(map[string]float64{"JPY": 1}, converter, "USD")
+	assert.Error(t, err)
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// CustomMachineType is the parsed name of the custom machine type, e.g. "e2-custom-4-8192".
+// ExtendedMemory is set for names ending with "-ext".
+type CustomMachineType struct {
+	Family         string
+	GuestCpus      int64
+	MemoryMb       int64
+	ExtendedMemory bool
+}
+
+// String returns the normalized name of the machine type, N1 types are named without the family prefix.
+func (m *CustomMachineType) String() string {
+	name := fmt.Sprintf("custom-%d-%d", m.GuestCpus, m.MemoryMb)
+	if m.Family != "n1" {
+		name = m.Family + "-" + name
+	}
+	if m.ExtendedMemory {
+		name += "-ext"
+	}
+	return name
+}
+
+// customFamily describes constraints of custom machine types of the family.
+type customFamily struct {
+	validCpus       func(cpus int64) bool
+	cpusDescription string
+	minMbPerCpu     float64
+	maxMbPerCpu     float64
+	maxMemoryMb     int64 // 0 if only limited per vCPU
+	extendedMemory  bool
+}
+
+// memoryMultipleMb is the granularity of memory of custom machine types.
+const memoryMultipleMb = 256
+
+// customFamilies are constraints of custom machine types described in
+// https://cloud.google.com/compute/docs/instances/creating-instance-with-custom-machine-type
+var customFamilies = map[string]customFamily{
+	"n1": {
+		validCpus:       func(cpus int64) bool { return cpus == 1 || (cpus%2 == 0 && cpus <= 96) },
+		cpusDescription: "1 or an even number up to 96",
+		minMbPerCpu:     0.9 * 1024,
+		maxMbPerCpu:     6.5 * 1024,
+		extendedMemory:  true,
+	},
+	"n2": {
+		validCpus: func(cpus int64) bool {
+			return cpus >= 2 && ((cpus <= 32 && cpus%2 == 0) || (cpus <= 80 && cpus%4 == 0))
+		},
+		cpusDescription: "a multiple of 2 up to 32 or a multiple of 4 up to 80",
+		minMbPerCpu:     0.5 * 1024,
+		maxMbPerCpu:     8 * 1024,
+		extendedMemory:  true,
+	},
+	"n2d": {
+		validCpus: func(cpus int64) bool {
+			return cpus == 2 || cpus == 4 || cpus == 8 || (cpus%16 == 0 && cpus >= 16 && cpus <= 96)
+		},
+		cpusDescription: "2, 4, 8 or a multiple of 16 up to 96",
+		minMbPerCpu:     0.5 * 1024,
+		maxMbPerCpu:     8 * 1024,
+		extendedMemory:  true,
+	},
+	"e2": {
+		validCpus:       func(cpus int64) bool { return cpus >= 2 && cpus <= 32 && cpus%2 == 0 },
+		cpusDescription: "an even number from 2 to 32",
+		minMbPerCpu:     0.5 * 1024,
+		maxMbPerCpu:     8 * 1024,
+		maxMemoryMb:     128 * 1024,
+	},
+}
+
+var customMachineTypeRegexp = regexp.MustCompile(`^(?:([a-z0-9]+)-)?custom-([0-9]+)-([0-9]+)(-ext)?$`)
+
+// isCustomMachineType returns whether the name of the machine type is the name of a custom machine type.
+func isCustomMachineType(name string) bool {
+	return customMachineTypeRegexp.MatchString(name)
+}
+
+// ParseCustomMachineType parses the name of the custom machine type, e.g. "custom-2-5120"
+// or "e2-custom-4-8192", and checks it against constraints of custom machine types of its family.
+// "n1-custom-2-5120" is accepted as "custom-2-5120".
+// If the name is malformed or the machine type is not valid the returned error is not nil.
+func ParseCustomMachineType(name string) (*CustomMachineType, error) {
+	match := customMachineTypeRegexp.FindStringSubmatch(name)
+	if match == nil {
+		return nil, fmt.Errorf("%s is not a custom machine type", name)
+	}
+	result := &CustomMachineType{Family: match[1], ExtendedMemory: match[4] != ""}
+	if result.Family == "" {
+		result.Family = "n1"
+	}
+	result.GuestCpus, _ = strconv.ParseInt(match[2], 10, 64)
+	result.MemoryMb, _ = strconv.ParseInt(match[3], 10, 64)
+
+	family, ok := customFamilies[result.Family]
+	if !ok {
+		return nil, fmt.Errorf("custom machine type %s: unsupported family %s", name, result.Family)
+	}
+	if !family.validCpus(result.GuestCpus) {
+		return nil, fmt.Errorf("custom machine type %s: number of vCPUs must be %s, got %d",
+			name, family.cpusDescription, result.GuestCpus)
+	}
+	if result.MemoryMb%memoryMultipleMb != 0 {
+		return nil, fmt.Errorf("custom machine type %s: memory must be a multiple of %d MB, got %d MB",
+			name, memoryMultipleMb, result.MemoryMb)
+	}
+	if result.ExtendedMemory && !family.extendedMemory {
+		return nil, fmt.Errorf("custom machine type %s: extended memory is not supported by %s", name, result.Family)
+	}
+	perCpu := float64(result.MemoryMb) / float64(result.GuestCpus)
+	if perCpu < family.minMbPerCpu {
+		return nil, fmt.Errorf("custom machine type %s: memory must be at least %.0f MB per vCPU, got %.0f MB",
+			name, family.minMbPerCpu, perCpu)
+	}
+	if perCpu > family.maxMbPerCpu && !result.ExtendedMemory {
+		return nil, fmt.Errorf("custom machine type %s: memory must be at most %.0f MB per vCPU without extended memory, got %.0f MB",
+			name, family.maxMbPerCpu, perCpu)
+	}
+	if family.maxMemoryMb > 0 && result.MemoryMb > family.maxMemoryMb {
+		return nil, fmt.Errorf("custom machine type %s: memory must be at most %d MB, got %d MB",
+			name, family.maxMemoryMb, result.MemoryMb)
+	}
+	return result, nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCustomMachineType(t *testing.T) {
+	for _, test := range []struct {
+		name       string
+		normalized string
+	}{
+		{"custom-2-5120", "custom-2-5120"},
+		{"n1-custom-1-1024", "custom-1-1024"},
+		{"e2-custom-4-8192", "e2-custom-4-8192"},
+		{"n2-custom-36-36864", "n2-custom-36-36864"},
+		{"custom-2-20480-ext", "custom-2-20480-ext"},
+	} {
+		machineType, err := ParseCustomMachineType(test.name)
+		if assert.NoError(t, err, "%s should be valid", test.name) {
+			assert.Equal(t, test.normalized, machineType.String())
+		}
+	}
+}
+
+func TestParseInvalidCustomMachineType(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		err  string
+	}{
+		{"n1-standard-4", "n1-standard-4 is not a custom machine type"},
+		{"custom-3-5120", "custom machine type custom-3-5120: number of vCPUs must be 1 or an even number up to 96, got 3"},
+		{"custom-2-5000", "custom machine type custom-2-5000: memory must be a multiple of 256 MB, got 5000 MB"},
+		{"e2-custom-4-1024", "custom machine type e2-custom-4-1024: memory must be at least 512 MB per vCPU, got 256 MB"},
+		{"custom-2-20480", "custom machine type custom-2-20480: memory must be at most 6656 MB per vCPU without extended memory, got 10240 MB"},
+		{"e2-custom-2-4096-ext", "custom machine type e2-custom-2-4096-ext: extended memory is not supported by e2"},
+		{"n2-custom-34-34816", "custom machine type n2-custom-34-34816: number of vCPUs must be a multiple of 2 up to 32 or a multiple of 4 up to 80, got 34"},
+		{"m1-custom-2-4096", "custom machine type m1-custom-2-4096: unsupported family m1"},
+	} {
+		_, err := ParseCustomMachineType(test.name)
+		assert.EqualError(t, err, test.err)
+	}
+}
+
+func TestApplyInvalidCustomMachineType(t *testing.T) {
+	rec := machineTypeRecommendation()
+	rec.Content.OperationGroups[0].Operations[1].Value = "zones/us-east1-b/machineTypes/custom-2-5000"
+	service := newMockApplyService()
+	_, err := Apply(context.Background(), service, rec)
+	assert.Error(t, err)
+	assert.Empty(t, service.calls, "Instance should not be stopped if the machine type is invalid")
+	assert.Empty(t, service.marks, "Recommendation should not be claimed if the machine type is invalid")
+}
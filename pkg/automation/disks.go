@@ -17,8 +17,12 @@ limitations under the License.
 package automation
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
+	"regexp"
+	"sort"
+	"strings"
 	"time"
 
 	"google.golang.org/api/compute/v1"
@@ -82,24 +86,200 @@ func randomSnapshotName(zone string, disk string, generator *rand.Rand) (string,
 	return result, nil
 }
 
-// CreateSnapshot calls the disks.createSnapshot method.
+// lowercase characters of random suffixes of names generated by SnapshotNaming
+const nameCharacters = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// snapshotNameRegexp matches names of snapshots accepted by GCE.
+var snapshotNameRegexp = regexp.MustCompile("^[a-z]([-a-z0-9]{0,61}[a-z0-9])?$")
+
+// SnapshotNaming configures names of snapshots created by Apply, see WithSnapshotNaming.
+// The name consists of Prefix, the disk name, the current UTC time in TimestampFormat and
+// RandomSuffixLength random lowercase characters and digits, separated by "-". Empty parts are skipped.
+// The disk name is shortened if the name would be longer than 63 characters.
+type SnapshotNaming struct {
+	Prefix             string
+	TimestampFormat    string
+	RandomSuffixLength int
+}
+
+// name returns the name of the snapshot of the disk created at now.
+func (n *SnapshotNaming) name(disk string, now time.Time, generator *rand.Rand) (string, error) {
+	var suffix []string
+	if n.TimestampFormat != "" {
+		suffix = append(suffix, now.UTC().Format(n.TimestampFormat))
+	}
+	if n.RandomSuffixLength > 0 {
+		random := make([]byte, n.RandomSuffixLength)
+		for i := range random {
+			random[i] = nameCharacters[generator.Intn(len(nameCharacters))]
+		}
+		suffix = append(suffix, string(random))
+	}
+
+	var parts []string
+	if n.Prefix != "" {
+		parts = append(parts, n.Prefix)
+	}
+	length := len(strings.Join(append(parts, suffix...), "-")) + 1
+	if length+min(1, len(disk)) > maxSnapshotnameLen {
+		return "", fmt.Errorf("snapshot name of disk %s would be longer than %d characters", disk, maxSnapshotnameLen)
+	}
+	parts = append(parts, disk[:min(len(disk), maxSnapshotnameLen-length)])
+	return strings.Join(append(parts, suffix...), "-"), nil
+}
+
+// CreateSnapshot calls the disks.createSnapshot method and waits for the operation to finish.
 // Requires compute.disks.createSnapshot or compute.snapshots.create permission.
 // For a given name, there can only be one snapshot having it.
 // The maximum name length is 63.
-func (s *googleService) CreateSnapshot(project, zone, disk, name string) error {
+func (s *googleService) CreateSnapshot(ctx context.Context, project, zone, disk, name string) error {
 	if len(name) > maxSnapshotnameLen {
 		return fmt.Errorf("length of the snapshot name must not exceed %d", maxSnapshotnameLen)
 	}
 	disksService := compute.NewDisksService(s.computeService)
 	snapshot := &compute.Snapshot{Name: name}
-	_, err := disksService.CreateSnapshot(project, zone, disk, snapshot).Do()
-	return err
+	operation, err := disksService.CreateSnapshot(project, zone, disk, snapshot).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return s.waitForOperation(ctx, project, zone, operation)
 }
 
-// DeleteDisk calls the disks.delete method.
+// CreateRegionalSnapshot calls the regionDisks.createSnapshot method for the regional disk
+// and waits for the operation to finish. Requirements are the same as for CreateSnapshot.
+func (s *googleService) CreateRegionalSnapshot(ctx context.Context, project, region, disk, name string) error {
+	if len(name) > maxSnapshotnameLen {
+		return fmt.Errorf("length of the snapshot name must not exceed %d", maxSnapshotnameLen)
+	}
+	regionDisksService := compute.NewRegionDisksService(s.computeService)
+	snapshot := &compute.Snapshot{Name: name}
+	operation, err := regionDisksService.CreateSnapshot(project, region, disk, snapshot).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return s.waitForRegionOperation(ctx, project, region, operation)
+}
+
+// DeleteDisk calls the disks.delete method and waits for the operation to finish.
 // Requires compute.disks.delete permission.
-func (s *googleService) DeleteDisk(project, zone, disk string) error {
+func (s *googleService) DeleteDisk(ctx context.Context, project, zone, disk string) error {
+	disksService := compute.NewDisksService(s.computeService)
+	operation, err := disksService.Delete(project, zone, disk).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return s.waitForOperation(ctx, project, zone, operation)
+}
+
+// DeleteRegionalDisk calls the regionDisks.delete method and waits for the operation to finish.
+// Requires compute.disks.delete permission.
+func (s *googleService) DeleteRegionalDisk(ctx context.Context, project, region, disk string) error {
+	regionDisksService := compute.NewRegionDisksService(s.computeService)
+	operation, err := regionDisksService.Delete(project, region, disk).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return s.waitForRegionOperation(ctx, project, region, operation)
+}
+
+// DeleteSnapshot calls the snapshots.delete method and waits for the operation to finish.
+// Requires compute.snapshots.delete permission.
+func (s *googleService) DeleteSnapshot(ctx context.Context, project, snapshot string) error {
+	snapshotsService := compute.NewSnapshotsService(s.computeService)
+	operation, err := snapshotsService.Delete(project, snapshot).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return s.waitForOperation(ctx, project, "", operation)
+}
+
+// GetDisk calls the disks.get method.
+// Requires compute.disks.get permission.
+// At most one of returned values will be non-nil.
+func (s *googleService) GetDisk(ctx context.Context, project, zone, disk string) (*compute.Disk, error) {
 	disksService := compute.NewDisksService(s.computeService)
-	_, err := disksService.Delete(project, zone, disk).Do()
-	return err
+	return disksService.Get(project, zone, disk).Context(ctx).Do()
+}
+
+// GetRegionalDisk calls the regionDisks.get method.
+// Requires compute.disks.get permission.
+// At most one of returned values will be non-nil.
+func (s *googleService) GetRegionalDisk(ctx context.Context, project, region, disk string) (*compute.Disk, error) {
+	regionDisksService := compute.NewRegionDisksService(s.computeService)
+	return regionDisksService.Get(project, region, disk).Context(ctx).Do()
+}
+
+// SetDiskLabels calls the disks.setLabels method, replacing all labels of the disk,
+// and waits for the operation to finish.
+// Requires compute.disks.setLabels permission.
+// fingerprint must be the label fingerprint of the disk, the call fails if labels were changed since it was read.
+func (s *googleService) SetDiskLabels(ctx context.Context, project, zone, disk string, labels map[string]string, fingerprint string) error {
+	disksService := compute.NewDisksService(s.computeService)
+	request := &compute.ZoneSetLabelsRequest{Labels: labels, LabelFingerprint: fingerprint}
+	operation, err := disksService.SetLabels(project, zone, disk, request).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return s.waitForOperation(ctx, project, zone, operation)
+}
+
+// LabelsFilter returns the filter expression for list methods of Compute API
+// matching resources having all the given labels.
+// Expressions are sorted by label key, so the result doesn't depend on the order of map iteration.
+func LabelsFilter(labels map[string]string) string {
+	var expressions []string
+	for key, value := range labels {
+		expressions = append(expressions, fmt.Sprintf("(labels.%s = %q)", key, value))
+	}
+	sort.Strings(expressions)
+	return strings.Join(expressions, " ")
+}
+
+// ListDisks returns the list of disks in the zone matching the filter, e.g. created by LabelsFilter.
+// If zone is empty, disks from all zones are listed.
+// Uses disks.list or disks.aggregatedList methods, all pages are fetched.
+// Requires compute.disks.list permission.
+func (s *googleService) ListDisks(ctx context.Context, project, zone, filter string) ([]*compute.Disk, error) {
+	disksService := compute.NewDisksService(s.computeService)
+	var disks []*compute.Disk
+	if zone != "" {
+		addDisks := func(diskList *compute.DiskList) error {
+			disks = append(disks, diskList.Items...)
+			return nil
+		}
+		err := disksService.List(project, zone).Filter(filter).Pages(ctx, addDisks)
+		if err != nil {
+			return nil, err
+		}
+		return disks, nil
+	}
+
+	addDisks := func(diskList *compute.DiskAggregatedList) error {
+		for _, scopedList := range diskList.Items {
+			disks = append(disks, scopedList.Disks...)
+		}
+		return nil
+	}
+	err := disksService.AggregatedList(project).Filter(filter).Pages(ctx, addDisks)
+	if err != nil {
+		return nil, err
+	}
+	return disks, nil
+}
+
+// ListSnapshots returns the list of snapshots in the project matching the filter, e.g. created by LabelsFilter.
+// Uses snapshots.list method, all pages are fetched.
+// Requires compute.snapshots.list permission.
+func (s *googleService) ListSnapshots(ctx context.Context, project, filter string) ([]*compute.Snapshot, error) {
+	snapshotsService := compute.NewSnapshotsService(s.computeService)
+	var snapshots []*compute.Snapshot
+	addSnapshots := func(snapshotList *compute.SnapshotList) error {
+		snapshots = append(snapshots, snapshotList.Items...)
+		return nil
+	}
+	err := snapshotsService.List(project).Filter(filter).Pages(ctx, addSnapshots)
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
 }
@@ -17,14 +17,18 @@ limitations under the License.
 package automation
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"sort"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
 )
 
 // Tests if the generated names are different
@@ -102,3 +106,61 @@ func TestLongDiskName(t *testing.T) {
 
 	assert.LessOrEqual(t, len(result), maxSnapshotnameLen, fmt.Sprintf("The length of the returned snapshot name must be less than %d", maxSnapshotnameLen))
 }
+
+func TestLabelsFilter(t *testing.T) {
+	assert.Equal(t, "", LabelsFilter(nil), "No labels should result in empty filter")
+	filter := LabelsFilter(map[string]string{"team": "infra", "env": "prod"})
+	assert.Equal(t, `(labels.env = "prod") (labels.team = "infra")`, filter)
+}
+
+// Tests that all pages of snapshots are listed
+func TestListSnapshotsPages(t *testing.T) {
+	var filters []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		filters = append(filters, r.URL.Query().Get("filter"))
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Query().Get("pageToken") == "" {
+			fmt.Fprint(w, `{"items": [{"name": "s1"}], "nextPageToken": "next"}`)
+		} else {
+			fmt.Fprint(w, `{"items": [{"name": "s2"}]}`)
+		}
+	}))
+	defer server.Close()
+
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	service, err := NewGoogleServiceFromTokenSource(context.Background(), tokenSource,
+		WithEndpoint(computeAPI, server.URL+"/compute/v1/projects/"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	filter := LabelsFilter(map[string]string{"created-by": "recomator"})
+	snapshots, err := service.ListSnapshots(context.Background(), "project", filter)
+	if assert.NoError(t, err) && assert.Equal(t, 2, len(snapshots), "Snapshots from all pages should be listed") {
+		assert.Equal(t, "s1", snapshots[0].Name)
+		assert.Equal(t, "s2", snapshots[1].Name)
+		assert.Equal(t, []string{filter, filter}, filters, "Filter should be sent with every page request")
+	}
+}
+
+func TestSnapshotNaming(t *testing.T) {
+	now := time.Date(2020, 8, 1, 12, 30, 0, 0, time.UTC)
+	generator := rand.New(rand.NewSource(1))
+	naming := &SnapshotNaming{Prefix: "recomator", TimestampFormat: "20060102", RandomSuffixLength: 4}
+	name, err := naming.name("disk", now, generator)
+	if assert.NoError(t, err) {
+		assert.Regexp(t, "^recomator-disk-20200801-[a-z0-9]{4}$", name)
+	}
+
+	name, err = (&SnapshotNaming{}).name("disk", now, generator)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "disk", name, "Empty parts should be skipped")
+	}
+
+	name, err = (&SnapshotNaming{Prefix: "backup", RandomSuffixLength: 10}).name(strings.Repeat("d", 60), now, generator)
+	if assert.NoError(t, err) {
+		assert.Equal(t, maxSnapshotnameLen, len(name), "Disk name should be shortened")
+	}
+
+	_, err = (&SnapshotNaming{RandomSuffixLength: 63}).name("disk", now, generator)
+	assert.Error(t, err, "Name without the disk would be too long")
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrOperationNotSupported is returned, wrapped with the description of the operation,
+	// when applying or testing the operation is not supported.
+	ErrOperationNotSupported = errors.New("operation is not supported")
+
+	// ErrNotActive is returned, wrapped with the name and the state of the recommendation,
+	// when the state of the recommendation doesn't allow applying it.
+	ErrNotActive = errors.New("recommendation is not active")
+
+	// ErrRecommendationChanged is returned, wrapped with the name of the recommendation,
+	// when marking the recommendation failed because its content changed since it was listed.
+	ErrRecommendationChanged = errors.New("recommendation has changed")
+
+	// ErrTimeout is returned, wrapped with the description of the operation,
+	// when applying the operation exceeded the timeout set by WithStepTimeout or WithApplyTimeout.
+	ErrTimeout = errors.New("operation timed out")
+
+	// ErrCapacityFloor is returned, wrapped with the name of the instance and its group,
+	// when stopping the instance would violate the floor set by WithCapacityFloor.
+	ErrCapacityFloor = errors.New("too few running instances in the group")
+
+	// ErrManagedInstance is returned, wrapped with the name of the instance and its managed instance group,
+	// when changing the machine type of the instance would be reverted by the group.
+	ErrManagedInstance = errors.New("instance is managed by an instance group")
+
+	// ErrReportOnly is returned, wrapped with the name of the recommendation,
+	// when the recommendation is only meant to be listed, see IsReportOnly.
+	ErrReportOnly = errors.New("recommendation is report-only")
+
+	// ErrConfirmationRequired is returned, wrapped with the description of the call,
+	// when applying the recommendation requires an option confirming sensitive changes, e.g. WithIAMPolicyChanges.
+	ErrConfirmationRequired = errors.New("confirmation required")
+)
+
+// ErrTestFailed is returned when the value of the resource doesn't match the test operation.
+// Want is the value or the pattern of the operation, Got is the value of the resource.
+type ErrTestFailed struct {
+	Resource string
+	Path     string
+	Got      string
+	Want     string
+}
+
+func (e *ErrTestFailed) Error() string {
+	return fmt.Sprintf("value of %s for %s is %s, which doesn't match %s", e.Path, e.Resource, e.Got, e.Want)
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+)
+
+// markFunc is the type of GoogleService methods marking recommendations.
+type markFunc func(ctx context.Context, name, etag string) (*gcloudRecommendation, error)
+
+// isEtagConflict returns whether the call failed with err because the etag was stale.
+func isEtagConflict(err error) bool {
+	var googleErr *googleapi.Error
+	if !errors.As(err, &googleErr) {
+		return false
+	}
+	switch googleErr.Code {
+	case http.StatusConflict, http.StatusPreconditionFailed:
+		return true
+	case http.StatusBadRequest:
+		return strings.Contains(strings.ToLower(googleErr.Message), "etag")
+	default:
+		return false
+	}
+}
+
+// sameContent checks if the recommendations have the same content, so they describe the same change,
+// and current is still in the state, e.g. it wasn't dismissed in the meantime.
+func sameContent(rec, current *gcloudRecommendation, state string) bool {
+	if current.StateInfo == nil || current.StateInfo.State != state {
+		return false
+	}
+	recJSON, recErr := json.Marshal(rec.Content)
+	currentJSON, currentErr := json.Marshal(current.Content)
+	return recErr == nil && currentErr == nil && string(recJSON) == string(currentJSON)
+}
+
+// markRecommendation marks rec, which is in the state, with mark using etag. If the etag is stale,
+// the recommendation is fetched again and, if neither its content nor its state has changed,
+// marked using the fresh etag. Otherwise ErrRecommendationChanged is wrapped in the returned error.
+func markRecommendation(ctx context.Context, service GoogleService, rec *gcloudRecommendation, etag, state string,
+	mark markFunc) (*gcloudRecommendation, error) {
+	marked, err := mark(ctx, rec.Name, etag)
+	if err == nil || !isEtagConflict(err) {
+		return marked, err
+	}
+	current, getErr := service.GetRecommendation(ctx, rec.Name)
+	if getErr != nil {
+		return nil, fmt.Errorf("%v, fetching the recommendation again failed: %v", err, getErr)
+	}
+	if !sameContent(rec, current, state) {
+		return nil, fmt.Errorf("%w: %s", ErrRecommendationChanged, rec.Name)
+	}
+	return mark(ctx, rec.Name, current.Etag)
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+// mockEtagService accepts marks only with the etag of its current recommendation.
+type mockEtagService struct {
+	*mockApplyService
+	current *gcloudRecommendation
+}
+
+func (s *mockEtagService) GetRecommendation(ctx context.Context, name string) (*gcloudRecommendation, error) {
+	return s.current, nil
+}
+
+func (s *mockEtagService) MarkRecommendationClaimed(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	if etag != s.current.Etag {
+		return nil, &googleapi.Error{Code: http.StatusBadRequest, Message: "Etag doesn't match the current one"}
+	}
+	return s.mockApplyService.MarkRecommendationClaimed(ctx, name, etag)
+}
+
+func TestApplyStaleEtag(t *testing.T) {
+	current := machineTypeRecommendation()
+	current.Etag = "fresh"
+	service := &mockEtagService{mockApplyService: newMockApplyService(), current: current}
+	_, err := Apply(context.Background(), service, machineTypeRecommendation())
+	assert.NoError(t, err, "Recommendation should be marked with the fresh etag")
+	assert.Equal(t, []string{"CLAIMED", "SUCCEEDED"}, service.marks)
+
+	current.Content.OperationGroups[0].Operations[1].Value = "zones/us-east1-b/machineTypes/n1-standard-1"
+	service = &mockEtagService{mockApplyService: newMockApplyService(), current: current}
+	_, err = Apply(context.Background(), service, machineTypeRecommendation())
+	assert.True(t, errors.Is(err, ErrRecommendationChanged), "Changed recommendation should not be applied")
+	assert.Empty(t, service.calls)
+
+	current = machineTypeRecommendation()
+	current.Etag = "fresh"
+	current.StateInfo.State = "DISMISSED"
+	service = &mockEtagService{mockApplyService: newMockApplyService(), current: current}
+	_, err = Apply(context.Background(), service, machineTypeRecommendation())
+	assert.True(t, errors.Is(err, ErrRecommendationChanged), "Dismissed recommendation should not be applied")
+	assert.Empty(t, service.marks)
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+const (
+	computeDiscoveryURI     = "https://www.googleapis.com/discovery/v1/apis/compute/v1/rest"
+	recommenderDiscoveryURI = "https://www.googleapis.com/discovery/v1/apis/recommender/v1/rest"
+	recommendationAssetType = "recommender.googleapis.com/Recommendation"
+	computeSelfLinkPrefix   = "https://www.googleapis.com/compute/v1/"
+)
+
+// ExportedResource is the resource of ExportedAsset, Data is the resource as returned by its API.
+type ExportedResource struct {
+	Version              string      `json:"version"`
+	DiscoveryDocumentURI string      `json:"discovery_document_uri"`
+	DiscoveryName        string      `json:"discovery_name"`
+	Parent               string      `json:"parent"`
+	Data                 interface{} `json:"data"`
+}
+
+// ExportedAsset is the asset in the format of Cloud Asset Inventory exports of the resource content type.
+type ExportedAsset struct {
+	Name      string            `json:"name"`
+	AssetType string            `json:"asset_type"`
+	Resource  *ExportedResource `json:"resource"`
+	Ancestors []string          `json:"ancestors,omitempty"`
+}
+
+// computeAssetName returns the full resource name of the compute resource with selfLink.
+func computeAssetName(selfLink string) string {
+	return "//" + computeAPI + "/" + strings.TrimPrefix(selfLink, computeSelfLinkPrefix)
+}
+
+// exportAssets returns instances, disks and recommendations of the project as assets.
+func exportAssets(ctx context.Context, service GoogleService, project string, recs []*gcloudRecommendation) ([]*ExportedAsset, error) {
+	ancestors, err := service.GetProjectAncestry(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	if len(ancestors) == 0 {
+		ancestors = []string{"projects/" + project}
+	}
+	parent := "//cloudresourcemanager.googleapis.com/" + ancestors[0]
+	newAsset := func(name, assetType, discoveryURI, discoveryName string, data interface{}) *ExportedAsset {
+		return &ExportedAsset{
+			Name:      name,
+			AssetType: assetType,
+			Resource: &ExportedResource{
+				Version:              "v1",
+				DiscoveryDocumentURI: discoveryURI,
+				DiscoveryName:        discoveryName,
+				Parent:               parent,
+				Data:                 data,
+			},
+			Ancestors: ancestors,
+		}
+	}
+
+	instances, err := service.ListInstances(ctx, project, "")
+	if err != nil {
+		return nil, err
+	}
+	disks, err := service.ListDisks(ctx, project, "", "")
+	if err != nil {
+		return nil, err
+	}
+	var assets []*ExportedAsset
+	for _, instance := range instances {
+		assets = append(assets, newAsset(computeAssetName(instance.SelfLink), instanceResourceType, computeDiscoveryURI, "Instance", instance))
+	}
+	for _, disk := range disks {
+		assets = append(assets, newAsset(computeAssetName(disk.SelfLink), diskResourceType, computeDiscoveryURI, "Disk", disk))
+	}
+	for _, rec := range recs {
+		assets = append(assets, newAsset("//recommender.googleapis.com/"+rec.Name, recommendationAssetType,
+			recommenderDiscoveryURI, "GoogleCloudRecommenderV1Recommendation", rec))
+	}
+	return assets, nil
+}
+
+// ExportAssets writes instances and disks of the project and recs, its recommendations, to w
+// as newline-delimited JSON in the format of Cloud Asset Inventory exports, one asset per line.
+// Recommendations are not Cloud Asset Inventory assets, they are exported with asset type
+// recommender.googleapis.com/Recommendation. Project ancestors are identified as returned by
+// GetProjectAncestry, so the project is named by its ID instead of its number.
+// With WithAnonymizer option the assets are anonymized before writing.
+// Requires compute.instances.list, compute.disks.list and resourcemanager.projects.get permissions.
+// If the error occurred the returned error is not nil.
+func ExportAssets(ctx context.Context, service GoogleService, project string, recs []*gcloudRecommendation, w io.Writer, options ...ExportOption) error {
+	config := newExportConfig(options)
+	assets, err := exportAssets(ctx, service, project, recs)
+	if err != nil {
+		return err
+	}
+	values := make([]interface{}, len(assets))
+	for i, asset := range assets {
+		values[i] = asset
+	}
+	if config.anonymizer != nil {
+		// anonymized together, so that names are replaced also in assets before the one naming them
+		anonymized, err := anonymizeJSON(config.anonymizer, values)
+		if err != nil {
+			return err
+		}
+		values = anonymized.([]interface{})
+	}
+	encoder := json.NewEncoder(w)
+	for _, asset := range values {
+		err = encoder.Encode(asset)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockExportService struct {
+	*mockInventoryService
+}
+
+func (s *mockExportService) GetProjectAncestry(ctx context.Context, project string) ([]string, error) {
+	return []string{"projects/" + project, "organizations/456"}, nil
+}
+
+func TestExportAssets(t *testing.T) {
+	service := &mockExportService{newMockInventoryService()}
+	for _, instance := range service.instances {
+		instance.SelfLink = instance.Zone + "/instances/" + instance.Name
+	}
+	service.disks = service.disks[:1]
+	service.disks[0].SelfLink = service.disks[0].Zone + "/disks/" + service.disks[0].Name
+
+	var buffer bytes.Buffer
+	err := ExportAssets(context.Background(), service, "p", []*gcloudRecommendation{machineTypeRecommendation()}, &buffer)
+	if !assert.NoError(t, err) {
+		return
+	}
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if !assert.Equal(t, 4, len(lines), "Every asset should be written in a separate line") {
+		return
+	}
+
+	var asset map[string]interface{}
+	err = json.Unmarshal([]byte(lines[2]), &asset)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "//compute.googleapis.com/projects/p/zones/us-east1-b/disks/data", asset["name"])
+	assert.Equal(t, "compute.googleapis.com/Disk", asset["asset_type"])
+	assert.Equal(t, []interface{}{"projects/p", "organizations/456"}, asset["ancestors"])
+	resource := asset["resource"].(map[string]interface{})
+	assert.Equal(t, "Disk", resource["discovery_name"])
+	assert.Equal(t, "//cloudresourcemanager.googleapis.com/projects/p", resource["parent"])
+	assert.Equal(t, "100", resource["data"].(map[string]interface{})["sizeGb"], "Data should be in the format of the API")
+
+	err = json.Unmarshal([]byte(lines[3]), &asset)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "//recommender.googleapis.com/"+applyRecName, asset["name"])
+		assert.Equal(t, recommendationAssetType, asset["asset_type"])
+	}
+}
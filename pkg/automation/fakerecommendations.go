@@ -0,0 +1,237 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"google.golang.org/api/recommender/v1"
+)
+
+// FakeRecommendationsConfig configures GenerateFakeRecommendations.
+// Weights are relative frequencies of recommenders, recommenders without weight aren't generated,
+// if Weights is empty all supported recommenders are equally likely.
+// StateWeights are relative frequencies of recommendation states, if empty all recommendations are active.
+// Monthly savings are distributed exponentially with the mean MeanMonthlySavings, in USD.
+// Generation is deterministic for the same config.
+type FakeRecommendationsConfig struct {
+	Count              int
+	Seed               int64
+	Projects           []string
+	Zones              []string
+	Weights            map[string]float64
+	StateWeights       map[string]float64
+	MeanMonthlySavings float64
+}
+
+// DefaultFakeRecommendationsConfig returns the config generating 60 active recommendations
+// of all supported recommenders in two projects.
+func DefaultFakeRecommendationsConfig() *FakeRecommendationsConfig {
+	return &FakeRecommendationsConfig{
+		Count:              60,
+		Seed:               1,
+		Projects:           []string{"recomator-demo", "recomator-load-test"},
+		Zones:              []string{"us-central1-a", "us-east1-b", "europe-west1-d"},
+		MeanMonthlySavings: 40,
+	}
+}
+
+// fakeGenerator generates recommendations of one recommender for the resource named name.
+type fakeGenerator func(r *rand.Rand, project, zone, name string) (subtype, description string, operations []*gcloudOperation)
+
+var fakeMachineTypes = []string{"n1-standard-1", "n1-standard-2", "n1-standard-4", "n1-standard-8", "e2-standard-2", "e2-standard-4"}
+
+// fakeGenerators are generators of all supported recommenders.
+var fakeGenerators = map[string]fakeGenerator{
+	"google.compute.instance.MachineTypeRecommender": func(r *rand.Rand, project, zone, name string) (string, string, []*gcloudOperation) {
+		resource := fmt.Sprintf("//compute.googleapis.com/projects/%s/zones/%s/instances/%s", project, zone, name)
+		current := fakeMachineTypes[1+r.Intn(len(fakeMachineTypes)-1)]
+		target := fmt.Sprintf("custom-%d-%d", 1+r.Intn(2), (4+r.Intn(12))*memoryMultipleMb)
+		return "CHANGE_MACHINE_TYPE", fmt.Sprintf("Save cost by changing machine type from %s to %s.", current, target), []*gcloudOperation{
+			{Action: "test", Path: "/machineType", Resource: resource, ResourceType: instanceResourceType,
+				ValueMatcher: &gcloudValueMatcher{MatchesPattern: fmt.Sprintf(".*zones/%s/machineTypes/%s", zone, current)}},
+			{Action: "replace", Path: "/machineType", Resource: resource, ResourceType: instanceResourceType,
+				Value: fmt.Sprintf("zones/%s/machineTypes/%s", zone, target)},
+		}
+	},
+	"google.compute.instance.IdleResourceRecommender": func(r *rand.Rand, project, zone, name string) (string, string, []*gcloudOperation) {
+		resource := fmt.Sprintf("//compute.googleapis.com/projects/%s/zones/%s/instances/%s", project, zone, name)
+		return "STOP_VM", "Save cost by stopping Idle VM '" + name + "'.", []*gcloudOperation{
+			{Action: "test", Path: "/status", Resource: resource, ResourceType: instanceResourceType, Value: "RUNNING"},
+			{Action: "replace", Path: "/status", Resource: resource, ResourceType: instanceResourceType, Value: "TERMINATED"},
+		}
+	},
+	"google.compute.disk.IdleResourceRecommender": func(r *rand.Rand, project, zone, name string) (string, string, []*gcloudOperation) {
+		return "SNAPSHOT_AND_DELETE_DISK", "Save cost by snapshotting and then deleting idle persistent disk '" + name + "'.", []*gcloudOperation{
+			{Action: "add", Path: "/", Resource: fmt.Sprintf("//compute.googleapis.com/projects/%s/global/snapshots/$snapshot-name", project),
+				ResourceType: snapshotResourceType, Value: map[string]interface{}{
+					"name":              "$snapshot-name",
+					"source_disk":       fmt.Sprintf("projects/%s/zones/%s/disks/%s", project, zone, name),
+					"storage_locations": []interface{}{zone},
+				}},
+			{Action: "remove", Path: "/", Resource: fmt.Sprintf("//compute.googleapis.com/projects/%s/zones/%s/disks/%s", project, zone, name),
+				ResourceType: diskResourceType},
+		}
+	},
+	"google.compute.image.IdleResourceRecommender": func(r *rand.Rand, project, zone, name string) (string, string, []*gcloudOperation) {
+		return "DELETE_IMAGE", "Save cost by deleting idle image '" + name + "'.", []*gcloudOperation{
+			{Action: "remove", Path: "/", Resource: fmt.Sprintf("//compute.googleapis.com/projects/%s/global/images/%s", project, name),
+				ResourceType: imageResourceType},
+		}
+	},
+	"google.cloudsql.instance.IdleRecommender": func(r *rand.Rand, project, zone, name string) (string, string, []*gcloudOperation) {
+		resource := fmt.Sprintf("//sqladmin.googleapis.com/projects/%s/instances/%s", project, name)
+		return "STOP", "Save cost by stopping idle Cloud SQL instance '" + name + "'.", []*gcloudOperation{
+			{Action: "test", Path: "/state", Resource: resource, ResourceType: sqlInstanceResourceType, Value: "RUNNABLE"},
+			{Action: "replace", Path: "/settings/activationPolicy", Resource: resource, ResourceType: sqlInstanceResourceType,
+				Value: sqlStoppedActivationPolicy},
+		}
+	},
+	"google.cloudsql.instance.OverprovisionedRecommender": func(r *rand.Rand, project, zone, name string) (string, string, []*gcloudOperation) {
+		resource := fmt.Sprintf("//sqladmin.googleapis.com/projects/%s/instances/%s", project, name)
+		cpus := 2 << r.Intn(3)
+		current := fmt.Sprintf("db-custom-%d-%d", 2*cpus, 2*cpus*3840)
+		target := fmt.Sprintf("db-custom-%d-%d", cpus, cpus*3840)
+		return "DOWNSIZE", fmt.Sprintf("Save cost by changing tier of Cloud SQL instance '%s' from %s to %s.", name, current, target), []*gcloudOperation{
+			{Action: "test", Path: "/settings/tier", Resource: resource, ResourceType: sqlInstanceResourceType, Value: current},
+			{Action: "replace", Path: "/settings/tier", Resource: resource, ResourceType: sqlInstanceResourceType, Value: target},
+		}
+	},
+	iamRecommenderID: func(r *rand.Rand, project, zone, name string) (string, string, []*gcloudOperation) {
+		resource := "//cloudresourcemanager.googleapis.com/projects/" + project
+		member := fmt.Sprintf("user:%s@example.com", name)
+		filter := func(role string, withMember bool) []byte {
+			filters := fmt.Sprintf(`{"%s": "%s"`, iamRolePathFilter, role)
+			if withMember {
+				filters += fmt.Sprintf(`, "%s": "%s"`, iamMemberPath, member)
+			}
+			return []byte(filters + "}")
+		}
+		return "REPLACE_ROLE", "Replace the current role with a smaller role to cover the permissions needed.", []*gcloudOperation{
+			{Action: "add", Path: iamAddMemberPath, Resource: resource, ResourceType: projectResourceType,
+				PathFilters: filter("roles/compute.viewer", false), Value: member},
+			{Action: "remove", Path: iamMemberPath, Resource: resource, ResourceType: projectResourceType,
+				PathFilters: filter("roles/editor", true)},
+		}
+	},
+	commitmentRecommenderID: func(r *rand.Rand, project, zone, name string) (string, string, []*gcloudOperation) {
+		region := zoneRegion(zone)
+		cpus := 4 * (1 + r.Intn(8))
+		return "PURCHASE_COMMITMENT", fmt.Sprintf("Save cost by purchasing a 1 year commitment for %d vCPUs in %s.", cpus, region), []*gcloudOperation{
+			{Action: "add", Path: "/", Resource: fmt.Sprintf("//compute.googleapis.com/projects/%s/regions/%s/commitments/%s", project, region, name),
+				ResourceType: "compute.googleapis.com/Commitment", Value: map[string]interface{}{
+					"plan":      "TWELVE_MONTH",
+					"resources": []interface{}{map[string]interface{}{"type": "VCPU", "amount": fmt.Sprint(cpus)}},
+				}},
+		}
+	},
+}
+
+// pickWeighted returns the key chosen with probability proportional to its weight, keys are sorted for determinism.
+func pickWeighted(r *rand.Rand, weights map[string]float64) string {
+	var keys []string
+	total := 0.0
+	for key, weight := range weights {
+		if weight > 0 {
+			keys = append(keys, key)
+			total += weight
+		}
+	}
+	sort.Strings(keys)
+	x := r.Float64() * total
+	for _, key := range keys {
+		x -= weights[key]
+		if x < 0 {
+			return key
+		}
+	}
+	return keys[len(keys)-1]
+}
+
+// GenerateFakeRecommendations returns realistic recommendations for demos, UI development and load tests,
+// so that no real Google Cloud resources are needed. Resources and IDs are random, but operations have
+// the shapes of the real recommenders, so recommendations of supported recommenders pass ValidateRecommendation.
+// It is an error if some weight names an unsupported recommender or no recommender can be generated.
+func GenerateFakeRecommendations(config *FakeRecommendationsConfig) ([]*gcloudRecommendation, error) {
+	weights := config.Weights
+	if len(weights) == 0 {
+		weights = make(map[string]float64)
+		for recommenderName := range fakeGenerators {
+			weights[recommenderName] = 1
+		}
+	}
+	valid := false
+	for recommenderName, weight := range weights {
+		if _, ok := fakeGenerators[recommenderName]; !ok {
+			return nil, fmt.Errorf("recommender %s is not supported", recommenderName)
+		}
+		valid = valid || weight > 0
+	}
+	if !valid {
+		return nil, fmt.Errorf("at least one recommender must have a positive weight")
+	}
+	if len(config.Projects) == 0 || len(config.Zones) == 0 {
+		return nil, fmt.Errorf("projects and zones must not be empty")
+	}
+	stateWeights := config.StateWeights
+	if len(stateWeights) == 0 {
+		stateWeights = map[string]float64{"ACTIVE": 1}
+	}
+
+	r := rand.New(rand.NewSource(config.Seed))
+	refreshTime := time.Date(2020, time.July, 13, 6, 41, 17, 0, time.UTC)
+	var result []*gcloudRecommendation
+	for i := 0; i < config.Count; i++ {
+		recommenderName := pickWeighted(r, weights)
+		project := config.Projects[r.Intn(len(config.Projects))]
+		zone := config.Zones[r.Intn(len(config.Zones))]
+		id := fmt.Sprintf("%08x-%04x-%04x-%04x-%012x", r.Uint32(), r.Intn(1<<16), r.Intn(1<<16), r.Intn(1<<16), r.Int63n(1<<48))
+		subtype, description, operations := fakeGenerators[recommenderName](r, project, zone, fmt.Sprintf("fake-%d", i))
+
+		location := zone
+		if regionalRecommenders[recommenderName] {
+			location = zoneRegion(zone)
+		} else if recommenderName == iamRecommenderID || globalRecommenders[recommenderName] {
+			location = "global"
+		}
+		savings := r.ExpFloat64() * config.MeanMonthlySavings
+		units, nanos := math.Modf(-savings)
+		result = append(result, &gcloudRecommendation{
+			Name:               fmt.Sprintf("projects/%s/locations/%s/recommenders/%s/recommendations/%s", project, location, recommenderName, id),
+			Description:        description,
+			RecommenderSubtype: subtype,
+			Etag:               fmt.Sprintf("\"%016x\"", r.Uint64()),
+			LastRefreshTime:    refreshTime.Add(-time.Duration(r.Intn(7*24)) * time.Hour).Format(time.RFC3339),
+			PrimaryImpact: &recommender.GoogleCloudRecommenderV1Impact{
+				Category: "COST",
+				CostProjection: &recommender.GoogleCloudRecommenderV1CostProjection{
+					Cost:     &gcloudMoney{CurrencyCode: "USD", Units: int64(units), Nanos: int64(nanos * 1e9)},
+					Duration: fmt.Sprintf("%.0fs", month.Seconds()),
+				},
+			},
+			StateInfo: &gcloudStateInfo{State: pickWeighted(r, stateWeights)},
+			Content: &recommender.GoogleCloudRecommenderV1RecommendationContent{
+				OperationGroups: []*gcloudOperationGroup{{Operations: operations}},
+			},
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateFakeRecommendations(t *testing.T) {
+	config := DefaultFakeRecommendationsConfig()
+	config.Count = 500
+	recs, err := GenerateFakeRecommendations(config)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 500, len(recs))
+	recommenders := make(map[string]bool)
+	for _, rec := range recs {
+		name, _ := recommenderID(rec.Name)
+		recommenders[name] = true
+		if !IsReportOnly(rec) {
+			assert.NoError(t, ValidateRecommendation(rec), "Fake recommendations should have the shape of real ones")
+		}
+		_, savings, ok := recommendationSavings(rec)
+		assert.True(t, ok && savings >= 0, "Fake recommendations should save money")
+	}
+	assert.Equal(t, len(fakeGenerators), len(recommenders), "All supported recommenders should be generated")
+
+	again, err := GenerateFakeRecommendations(config)
+	if assert.NoError(t, err) {
+		assert.Equal(t, recs, again, "Generation should be deterministic")
+	}
+}
+
+func TestGenerateFakeRecommendationsWeights(t *testing.T) {
+	config := DefaultFakeRecommendationsConfig()
+	config.Weights = map[string]float64{"google.compute.instance.IdleResourceRecommender": 1}
+	config.StateWeights = map[string]float64{"SUCCEEDED": 1}
+	recs, err := GenerateFakeRecommendations(config)
+	if assert.NoError(t, err) {
+		for _, rec := range recs {
+			assert.Equal(t, "STOP_VM", rec.RecommenderSubtype)
+			assert.Equal(t, "SUCCEEDED", rec.StateInfo.State)
+		}
+	}
+
+	config.Weights = map[string]float64{"google.unknown.Recommender": 1}
+	_, err = GenerateFakeRecommendations(config)
+	assert.Error(t, err)
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/recommender/v1"
+)
+
+type gcloudMoney = recommender.GoogleTypeMoney
+
+type gcloudOperation = recommender.GoogleCloudRecommenderV1Operation
+
+// ResourceCard groups all recommendations that target the same resource.
+// Savings contains combined savings of the recommendations per currency code.
+// Conflicts contains notes about recommendations that can't be applied together.
+// Summaries contains summaries of the recommendations, in the same order.
+// SnapshotCosts are set by SubtractSnapshotCosts.
+// Insights are not grouped into cards: the Recommender API client exposes neither insights
+// nor the insights associated with recommendations, so they can't be matched to them yet.
+type ResourceCard struct {
+	Resource        string                  `json:"resource"`
+	ResourceType    string                  `json:"resourceType"`
+	Recommendations []*gcloudRecommendation `json:"recommendations"`
+	Summaries       []string                `json:"summaries"`
+	Savings         map[string]float64      `json:"savings"`
+	Conflicts       []string                `json:"conflicts"`
+	SnapshotCosts   []*SnapshotCostEstimate `json:"snapshotCosts,omitempty"`
+}
+
+// moneyToFloat returns the amount of money as a float value.
+func moneyToFloat(money *gcloudMoney) float64 {
+	return float64(money.Units) + float64(money.Nanos)/1e9
+}
+
+// recommendationSavings returns the currency code and the amount of money saved by the recommendation.
+// Recommender API returns cost projections, so savings are negated cost.
+// If the recommendation has no cost projection, ok is false.
+func recommendationSavings(rec *gcloudRecommendation) (currencyCode string, savings float64, ok bool) {
+	if rec.PrimaryImpact == nil || rec.PrimaryImpact.CostProjection == nil || rec.PrimaryImpact.CostProjection.Cost == nil {
+		return "", 0, false
+	}
+	cost := rec.PrimaryImpact.CostProjection.Cost
+	return cost.CurrencyCode, -moneyToFloat(cost), true
+}
+
+// targetResources returns the resources (with their types) modified or tested by the recommendation.
+// Resources created by the recommendation ("add" operations) are not its targets.
+func targetResources(rec *gcloudRecommendation) map[string]string {
+	targets := make(map[string]string)
+	if rec == nil || rec.Content == nil {
+		return targets
+	}
+	for _, group := range rec.Content.OperationGroups {
+		for _, operation := range group.Operations {
+			if operation.Action != "add" {
+				targets[operation.Resource] = operation.ResourceType
+			}
+		}
+	}
+	return targets
+}
+
+// findConflicts returns notes describing which recommendations modify the same part of the resource.
+// Removing the resource conflicts with any other recommendation for it.
+func findConflicts(resource string, recs []*gcloudRecommendation) []string {
+	modifiedPaths := make(map[string][]string) // key is the path, value is names of recommendations
+	var removing []string
+	for _, rec := range recs {
+		paths := make(map[string]bool)
+		for _, group := range rec.Content.OperationGroups {
+			for _, operation := range group.Operations {
+				if operation.Resource != resource || operation.Action == "test" {
+					continue
+				}
+				if operation.Action == "remove" && operation.Path == "/" {
+					removing = append(removing, rec.Name)
+				}
+				paths[operation.Path] = true
+			}
+		}
+		for path := range paths {
+			modifiedPaths[path] = append(modifiedPaths[path], rec.Name)
+		}
+	}
+
+	var conflicts []string
+	if len(recs) > 1 {
+		for _, name := range removing {
+			conflicts = append(conflicts, fmt.Sprintf("%s removes the resource, other recommendations for it can't be applied afterwards", name))
+		}
+	}
+	for path, names := range modifiedPaths {
+		if len(names) > 1 {
+			conflicts = append(conflicts, fmt.Sprintf("%s modify %s", strings.Join(names, ", "), path))
+		}
+	}
+	sort.Strings(conflicts)
+	return conflicts
+}
+
+// GroupByResource groups recommendations that target the same resource into resource cards.
+// A recommendation targeting several resources is added to the card of each of them.
+// Cards are sorted by resource.
+func GroupByResource(recs []*gcloudRecommendation) []*ResourceCard {
+	cards := make(map[string]*ResourceCard)
+	for _, rec := range recs {
+		for resource, resourceType := range targetResources(rec) {
+			card, ok := cards[resource]
+			if !ok {
+				card = &ResourceCard{Resource: resource, ResourceType: resourceType, Savings: make(map[string]float64)}
+				cards[resource] = card
+			}
+			card.Recommendations = append(card.Recommendations, rec)
+			card.Summaries = append(card.Summaries, Summarize(rec))
+			if currencyCode, savings, ok := recommendationSavings(rec); ok {
+				card.Savings[currencyCode] += savings
+			}
+		}
+	}
+
+	result := make([]*ResourceCard, 0, len(cards))
+	for _, card := range cards {
+		card.Conflicts = findConflicts(card.Resource, card.Recommendations)
+		result = append(result, card)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Resource < result[j].Resource
+	})
+	return result
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/recommender/v1"
+)
+
+const (
+	testInstance = "//compute.googleapis.com/projects/p/zones/z/instances/i"
+	testDisk     = "//compute.googleapis.com/projects/p/zones/z/disks/d"
+	testSnapshot = "//compute.googleapis.com/projects/p/global/snapshots/$snapshot-name"
+)
+
+func makeRecommendation(name string, units int64, operations ...*gcloudOperation) *gcloudRecommendation {
+	return &gcloudRecommendation{
+		Name: name,
+		Content: &recommender.GoogleCloudRecommenderV1RecommendationContent{
+			OperationGroups: []*recommender.GoogleCloudRecommenderV1OperationGroup{
+				&recommender.GoogleCloudRecommenderV1OperationGroup{Operations: operations},
+			},
+		},
+		PrimaryImpact: &recommender.GoogleCloudRecommenderV1Impact{
+			CostProjection: &recommender.GoogleCloudRecommenderV1CostProjection{
+				Cost: &gcloudMoney{CurrencyCode: "USD", Units: -units},
+			},
+		},
+	}
+}
+
+func stopInstanceRecommendation(name string, units int64) *gcloudRecommendation {
+	return makeRecommendation(name, units,
+		&gcloudOperation{Action: "test", Path: "/status", Resource: testInstance, ResourceType: "compute.googleapis.com/Instance", Value: "RUNNING"},
+		&gcloudOperation{Action: "replace", Path: "/status", Resource: testInstance, ResourceType: "compute.googleapis.com/Instance", Value: "TERMINATED"})
+}
+
+func deleteDiskRecommendation(name string, units int64) *gcloudRecommendation {
+	return makeRecommendation(name, units,
+		&gcloudOperation{Action: "add", Path: "/", Resource: testSnapshot, ResourceType: "compute.googleapis.com/Snapshot"},
+		&gcloudOperation{Action: "remove", Path: "/", Resource: testDisk, ResourceType: "compute.googleapis.com/Disk"})
+}
+
+func TestGroupByResource(t *testing.T) {
+	recs := []*gcloudRecommendation{
+		stopInstanceRecommendation("stop1", 10),
+		deleteDiskRecommendation("delete", 3),
+		stopInstanceRecommendation("stop2", 5),
+	}
+	cards := GroupByResource(recs)
+	if assert.Equal(t, 2, len(cards), "Snapshot created by the recommendation should not have a card") {
+		assert.Equal(t, testDisk, cards[0].Resource, "Cards should be sorted by resource")
+		assert.Equal(t, "compute.googleapis.com/Disk", cards[0].ResourceType)
+		assert.ElementsMatch(t, recs[1:2], cards[0].Recommendations)
+		assert.Equal(t, map[string]float64{"USD": 3}, cards[0].Savings, "Savings are negated cost")
+		assert.Empty(t, cards[0].Conflicts, "Single recommendation can't conflict")
+
+		assert.Equal(t, testInstance, cards[1].Resource)
+		assert.ElementsMatch(t, []*gcloudRecommendation{recs[0], recs[2]}, cards[1].Recommendations)
+		assert.Equal(t, map[string]float64{"USD": 15}, cards[1].Savings, "Savings should be combined")
+		assert.Equal(t, []string{"stop1, stop2 modify /status"}, cards[1].Conflicts)
+	}
+}
+
+func TestGroupByResourceRemoveConflict(t *testing.T) {
+	recs := []*gcloudRecommendation{
+		deleteDiskRecommendation("delete1", 1),
+		deleteDiskRecommendation("delete2", 1),
+	}
+	cards := GroupByResource(recs)
+	if assert.Equal(t, 1, len(cards)) {
+		assert.Equal(t, []string{
+			"delete1 removes the resource, other recommendations for it can't be applied afterwards",
+			"delete1, delete2 modify /",
+			"delete2 removes the resource, other recommendations for it can't be applied afterwards",
+		}, cards[0].Conflicts)
+	}
+}
+
+func TestGroupByResourceNoContent(t *testing.T) {
+	cards := GroupByResource([]*gcloudRecommendation{nil, &gcloudRecommendation{}})
+	assert.Empty(t, cards, "Recommendations without operations don't target any resource")
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"sort"
+)
+
+// HierarchyNode is a node of the resource hierarchy: an organization, a folder or a project.
+// Recommendations are set only for projects.
+// NumberOfRecommendations and Savings (per currency code) are totals for the whole subtree.
+type HierarchyNode struct {
+	Name                    string                  `json:"name"`
+	Recommendations         []*gcloudRecommendation `json:"recommendations,omitempty"`
+	NumberOfRecommendations int                     `json:"numberOfRecommendations"`
+	Savings                 map[string]float64      `json:"savings"`
+	Children                []*HierarchyNode        `json:"children,omitempty"`
+}
+
+func newHierarchyNode(name string) *HierarchyNode {
+	return &HierarchyNode{Name: name, Savings: make(map[string]float64)}
+}
+
+// addRecommendations adds the number of recommendations and their savings to the node totals.
+func (n *HierarchyNode) addRecommendations(recs []*gcloudRecommendation) {
+	n.NumberOfRecommendations += len(recs)
+	for _, rec := range recs {
+		if currencyCode, savings, ok := recommendationSavings(rec); ok {
+			n.Savings[currencyCode] += savings
+		}
+	}
+}
+
+// sortChildren sorts children of every node in the subtree by name.
+func (n *HierarchyNode) sortChildren() {
+	sort.Slice(n.Children, func(i, j int) bool {
+		return n.Children[i].Name < n.Children[j].Name
+	})
+	for _, child := range n.Children {
+		child.sortChildren()
+	}
+}
+
+// RollupByHierarchy aggregates recommendations per organization, folder and project.
+// projectsRecommendations maps project IDs to their recommendations, for example
+// ListResult.ProjectsRecommendations.
+// Returned values are roots of the hierarchy: organizations, and projects or folders
+// that the user can't see the parents of. Roots and children are sorted by name.
+// task structure tracks how many projects have been processed already.
+func RollupByHierarchy(ctx context.Context, service GoogleService, projectsRecommendations map[string][]*gcloudRecommendation, task *Task) ([]*HierarchyNode, error) {
+	task.SetNumberOfSubtasks(len(projectsRecommendations))
+
+	nodes := make(map[string]*HierarchyNode) // the key is the name of the node
+	var roots []*HierarchyNode
+	for project, recs := range projectsRecommendations {
+		ancestry, err := service.GetProjectAncestry(ctx, project)
+		if err != nil {
+			return nil, err
+		}
+		if len(ancestry) == 0 {
+			ancestry = []string{"projects/" + project}
+		}
+
+		var parent *HierarchyNode
+		for i := len(ancestry) - 1; i >= 0; i-- {
+			node, ok := nodes[ancestry[i]]
+			if !ok {
+				node = newHierarchyNode(ancestry[i])
+				nodes[ancestry[i]] = node
+				if parent == nil {
+					roots = append(roots, node)
+				} else {
+					parent.Children = append(parent.Children, node)
+				}
+			}
+			node.addRecommendations(recs)
+			parent = node
+		}
+		parent.Recommendations = recs
+		task.IncrementDone()
+	}
+
+	root := &HierarchyNode{Children: roots}
+	root.sortChildren()
+	task.SetAllDone()
+	return root.Children, nil
+}
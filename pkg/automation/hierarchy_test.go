@@ -0,0 +1,98 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAncestryService struct {
+	GoogleService
+	ancestry map[string][]string
+}
+
+func (s *mockAncestryService) GetProjectAncestry(ctx context.Context, project string) ([]string, error) {
+	ancestry, ok := s.ancestry[project]
+	if !ok {
+		return nil, errors.New("project not found")
+	}
+	return ancestry, nil
+}
+
+func TestRollupByHierarchy(t *testing.T) {
+	service := &mockAncestryService{ancestry: map[string][]string{
+		"a":    []string{"projects/a", "folders/1", "organizations/o"},
+		"b":    []string{"projects/b", "folders/2", "folders/1", "organizations/o"},
+		"c":    []string{"projects/c", "organizations/o"},
+		"solo": []string{},
+	}}
+	projectsRecommendations := map[string][]*gcloudRecommendation{
+		"a":    []*gcloudRecommendation{stopInstanceRecommendation("a1", 1), stopInstanceRecommendation("a2", 2)},
+		"b":    []*gcloudRecommendation{deleteDiskRecommendation("b1", 4)},
+		"c":    []*gcloudRecommendation{deleteDiskRecommendation("c1", 8)},
+		"solo": []*gcloudRecommendation{deleteDiskRecommendation("s1", 16)},
+	}
+	task := &Task{}
+	roots, err := RollupByHierarchy(context.Background(), service, projectsRecommendations, task)
+	if !assert.NoError(t, err) {
+		return
+	}
+	done, all := task.GetProgress()
+	assert.True(t, done == all, "Rollup should be done")
+
+	if !assert.Equal(t, 2, len(roots), "Organization and project without parents should be roots") {
+		return
+	}
+	org, solo := roots[0], roots[1]
+	assert.Equal(t, "organizations/o", org.Name)
+	assert.Equal(t, 4, org.NumberOfRecommendations)
+	assert.Equal(t, map[string]float64{"USD": 15}, org.Savings, "Organization savings should include the whole subtree")
+	assert.Nil(t, org.Recommendations, "Only projects contain recommendations")
+
+	assert.Equal(t, "projects/solo", solo.Name)
+	assert.Equal(t, projectsRecommendations["solo"], solo.Recommendations)
+
+	if assert.Equal(t, 2, len(org.Children)) {
+		folder, project := org.Children[0], org.Children[1]
+		assert.Equal(t, "folders/1", folder.Name)
+		assert.Equal(t, map[string]float64{"USD": 7}, folder.Savings)
+		assert.Equal(t, "projects/c", project.Name)
+		assert.Equal(t, projectsRecommendations["c"], project.Recommendations)
+
+		if assert.Equal(t, 2, len(folder.Children)) {
+			assert.Equal(t, "folders/2", folder.Children[0].Name)
+			assert.Equal(t, 1, folder.Children[0].NumberOfRecommendations)
+			assert.Equal(t, "projects/a", folder.Children[1].Name)
+			assert.Equal(t, map[string]float64{"USD": 3}, folder.Children[1].Savings)
+		}
+	}
+}
+
+func TestRollupByHierarchyError(t *testing.T) {
+	service := &mockAncestryService{}
+	task := &Task{}
+	roots, err := RollupByHierarchy(context.Background(), service, map[string][]*gcloudRecommendation{"unknown": nil}, task)
+	if assert.Error(t, err) {
+		assert.Nil(t, roots, "Only one of returned values should be non-nil")
+		done, all := task.GetProgress()
+		assert.True(t, done < all, "Rollup should not be done because of error")
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"google.golang.org/api/googleapi"
+)
+
+// Categories of failures with remediation hints.
+const (
+	PermissionCategory     = "PERMISSION"
+	APIDisabledCategory    = "API_DISABLED"
+	QuotaCategory          = "QUOTA"
+	RateLimitCategory      = "RATE_LIMIT"
+	ResourceChangeCategory = "RESOURCE_CHANGED"
+	StaleCategory          = "STALE_RECOMMENDATION"
+)
+
+// Remediation is the hint for the operator how to fix the failure of Category.
+type Remediation struct {
+	Category string `json:"category"`
+	Hint     string `json:"hint"`
+}
+
+// permissionRoles are predefined roles granting permissions with the prefix, the first matching prefix is used.
+var permissionRoles = []struct {
+	prefix string
+	role   string
+}{
+	{"compute.instances.", "roles/compute.instanceAdmin.v1"},
+	{"compute.disks.", "roles/compute.storageAdmin"},
+	{"compute.snapshots.", "roles/compute.storageAdmin"},
+	{"compute.", "roles/compute.viewer"},
+	{"recommender.", "roles/recommender.computeAdmin"},
+	{"resourcemanager.", "roles/browser"},
+	{"serviceusage.", "roles/serviceusage.serviceUsageConsumer"},
+}
+
+// permissionRole returns the predefined role granting the permission.
+func permissionRole(permission string) (string, bool) {
+	for _, item := range permissionRoles {
+		if strings.HasPrefix(permission, item.prefix) {
+			return item.role, true
+		}
+	}
+	return "", false
+}
+
+// grantHint returns the hint with the gcloud command granting the permission in the project.
+func grantHint(project, permission string) string {
+	role, ok := permissionRole(permission)
+	if !ok {
+		return fmt.Sprintf("Grant permission %s in project %s to the user.", permission, project)
+	}
+	return fmt.Sprintf("Grant permission %s to the user: gcloud projects add-iam-policy-binding %s --member=user:EMAIL --role=%s",
+		permission, project, role)
+}
+
+var (
+	requiredPermissionRegexp = regexp.MustCompile(`Required '([a-zA-Z.]+)' permission for '(?://[^/]+/)?projects/([^/']+)`)
+	quotaRegexp              = regexp.MustCompile(`Quota '([A-Z0-9_]+)' exceeded(?:\.\s*Limit: [^ ]+ in region ([a-z0-9-]+))?`)
+	disabledAPIRegexp        = regexp.MustCompile(`apis/api/([a-z.]+)/overview\?project=([a-z0-9-]+)`)
+)
+
+// googleError returns the googleapi error wrapped by err.
+func googleError(err error) (*googleapi.Error, bool) {
+	var googleErr *googleapi.Error
+	ok := errors.As(err, &googleErr)
+	return googleErr, ok
+}
+
+// hasReason checks if the googleapi error has an item with one of reasons.
+func hasReason(googleErr *googleapi.Error, reasons ...string) bool {
+	for _, item := range googleErr.Errors {
+		for _, reason := range reasons {
+			if item.Reason == reason {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// remediationHints is the table of failure categories, the first matching row is used.
+// hint returns the hint for the error if it belongs to the category.
+var remediationHints = []struct {
+	category string
+	hint     func(err error) (string, bool)
+}{
+	{APIDisabledCategory, func(err error) (string, bool) {
+		googleErr, ok := googleError(err)
+		if !ok || !hasReason(googleErr, "accessNotConfigured") {
+			return "", false
+		}
+		if match := disabledAPIRegexp.FindStringSubmatch(googleErr.Message); match != nil {
+			return fmt.Sprintf("Enable the API: gcloud services enable %s --project=%s", match[1], match[2]), true
+		}
+		return "Enable the API named in the error: gcloud services enable API --project=PROJECT", true
+	}},
+	{PermissionCategory, func(err error) (string, bool) {
+		googleErr, ok := googleError(err)
+		if !ok || googleErr.Code != http.StatusForbidden || hasReason(googleErr, "quotaExceeded", "rateLimitExceeded", "userRateLimitExceeded") {
+			return "", false
+		}
+		if match := requiredPermissionRegexp.FindStringSubmatch(googleErr.Message); match != nil {
+			return grantHint(match[2], match[1]), true
+		}
+		return "The user lacks a permission, check the requirements with ListProjectRequirements.", true
+	}},
+	{QuotaCategory, func(err error) (string, bool) {
+		match := quotaRegexp.FindStringSubmatch(err.Error())
+		if match == nil {
+			return "", false
+		}
+		if match[2] != "" {
+			return fmt.Sprintf("Request an increase of quota %s in region %s at https://console.cloud.google.com/iam-admin/quotas", match[1], match[2]), true
+		}
+		return fmt.Sprintf("Request an increase of quota %s at https://console.cloud.google.com/iam-admin/quotas", match[1]), true
+	}},
+	{RateLimitCategory, func(err error) (string, bool) {
+		googleErr, ok := googleError(err)
+		if !ok || (googleErr.Code != http.StatusTooManyRequests && !hasReason(googleErr, "rateLimitExceeded", "userRateLimitExceeded")) {
+			return "", false
+		}
+		return "API requests are rate limited, retry later or use NewRetryingService.", true
+	}},
+	{ResourceChangeCategory, func(err error) (string, bool) {
+		var testErr *ErrTestFailed
+		if !errors.As(err, &testErr) {
+			return "", false
+		}
+		return fmt.Sprintf("%s changed since the recommendation was generated, wait for a new recommendation or apply it with WithForce option.",
+			testErr.Resource), true
+	}},
+	{StaleCategory, func(err error) (string, bool) {
+		if !errors.Is(err, ErrRecommendationChanged) && !errors.Is(err, ErrNotActive) {
+			return "", false
+		}
+		return "The recommendation is outdated, list recommendations again.", true
+	}},
+}
+
+// RemediationFor returns the hint how to fix the failure err, e.g. returned by Apply, or nil if it is unknown.
+func RemediationFor(err error) *Remediation {
+	if err == nil {
+		return nil
+	}
+	for _, row := range remediationHints {
+		if hint, ok := row.hint(err); ok {
+			return &Remediation{Category: row.category, Hint: hint}
+		}
+	}
+	return nil
+}
+
+// RequirementRemediation returns the hint how to complete the failed requirement of the project
+// returned by ListProjectRequirements, or nil if the requirement is completed or the hint is unknown.
+func RequirementRemediation(project string, requirement *Requirement) *Remediation {
+	if requirement.Status != RequirementFailed {
+		return nil
+	}
+	if match := disabledAPIRegexp.FindStringSubmatch(requirement.ErrorMessage); match != nil {
+		return &Remediation{Category: APIDisabledCategory, Hint: fmt.Sprintf("Enable the API: gcloud services enable %s --project=%s", match[1], match[2])}
+	}
+	permissions := strings.Split(requirement.Name, ", ")
+	for _, permission := range permissions {
+		if strings.Contains(permission, " ") {
+			return nil
+		}
+	}
+	return &Remediation{Category: PermissionCategory, Hint: grantHint(project, permissions[0])}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+func TestRemediationFor(t *testing.T) {
+	permissionErr := &googleapi.Error{
+		Code:    http.StatusForbidden,
+		Message: "Required 'compute.instances.stop' permission for 'projects/rightsizer-test/zones/us-east1-b/instances/alicja-test'",
+		Errors:  []googleapi.ErrorItem{{Reason: "forbidden"}},
+	}
+	quotaErr := &OperationError{Operation: "operation-1", Errors: []*compute.OperationErrorErrors{
+		{Code: "QUOTA_EXCEEDED", Message: "Quota 'CPUS' exceeded.  Limit: 24.0 in region us-east1."},
+	}}
+	disabledErr := &googleapi.Error{
+		Code: http.StatusForbidden,
+		Message: "Compute Engine API has not been used in project p before or it is disabled. " +
+			"Enable it by visiting https://console.developers.google.com/apis/api/compute.googleapis.com/overview?project=p then retry.",
+		Errors: []googleapi.ErrorItem{{Reason: "accessNotConfigured"}},
+	}
+	for _, test := range []struct {
+		err      error
+		category string
+		hint     string
+	}{
+		{fmt.Errorf("stopping instance alicja-test: %w", permissionErr), PermissionCategory,
+			"Grant permission compute.instances.stop to the user: gcloud projects add-iam-policy-binding rightsizer-test --member=user:EMAIL --role=roles/compute.instanceAdmin.v1"},
+		{quotaErr, QuotaCategory, "Request an increase of quota CPUS in region us-east1 at https://console.cloud.google.com/iam-admin/quotas"},
+		{disabledErr, APIDisabledCategory, "Enable the API: gcloud services enable compute.googleapis.com --project=p"},
+		{&googleapi.Error{Code: http.StatusTooManyRequests}, RateLimitCategory, "API requests are rate limited, retry later or use NewRetryingService."},
+		{fmt.Errorf("%w: r", ErrNotActive), StaleCategory, "The recommendation is outdated, list recommendations again."},
+	} {
+		remediation := RemediationFor(test.err)
+		if assert.NotNil(t, remediation, "Hint for %v should be known", test.err) {
+			assert.Equal(t, test.category, remediation.Category)
+			assert.Equal(t, test.hint, remediation.Hint)
+		}
+	}
+	assert.Nil(t, RemediationFor(errors.New("unknown")))
+	assert.Nil(t, RemediationFor(nil))
+}
+
+func TestRequirementRemediation(t *testing.T) {
+	requirement := &Requirement{Name: "compute.disks.createSnapshot, compute.snapshots.create", Status: RequirementFailed}
+	remediation := RequirementRemediation("p", requirement)
+	if assert.NotNil(t, remediation) {
+		assert.Equal(t, "Grant permission compute.disks.createSnapshot to the user: gcloud projects add-iam-policy-binding p --member=user:EMAIL --role=roles/compute.storageAdmin",
+			remediation.Hint)
+	}
+	assert.Nil(t, RequirementRemediation("p", &Requirement{Name: "compute.disks.get", Status: RequirementCompleted}))
+}
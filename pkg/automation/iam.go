@@ -0,0 +1,287 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/iam/v1"
+)
+
+const (
+	iamRecommenderID = "google.iam.policy.Recommender"
+
+	// iamPolicyVersion is requested when reading IAM policies, so that conditional bindings are preserved
+	iamPolicyVersion = 3
+
+	// paths of operations of IAM recommendations and their filters
+	iamAddMemberPath       = "/iamPolicy/bindings/*/members/-"
+	iamMemberPath          = "/iamPolicy/bindings/*/members/*"
+	iamRolePathFilter      = "/iamPolicy/bindings/*/role"
+	iamConditionPathFilter = "/iamPolicy/bindings/*/condition/expression"
+)
+
+var projectResourceRegexp = regexp.MustCompile("^//cloudresourcemanager.googleapis.com/projects/([^/]+)$")
+
+// GetProjectIAMPolicy calls the projects.getIamPolicy method of Resource Manager API, requesting policy version 3.
+// Requires resourcemanager.projects.getIamPolicy permission.
+// At most one of returned values will be non-nil.
+func (s *googleService) GetProjectIAMPolicy(ctx context.Context, project string) (*cloudresourcemanager.Policy, error) {
+	projectsService := cloudresourcemanager.NewProjectsService(s.resourceManagerService)
+	request := &cloudresourcemanager.GetIamPolicyRequest{
+		Options: &cloudresourcemanager.GetPolicyOptions{RequestedPolicyVersion: iamPolicyVersion},
+	}
+	return projectsService.GetIamPolicy(project, request).Context(ctx).Do()
+}
+
+// SetProjectIAMPolicy calls the projects.setIamPolicy method of Resource Manager API.
+// The call fails if the policy was changed since it was read, because the etag of the policy doesn't match.
+// Requires resourcemanager.projects.setIamPolicy permission.
+func (s *googleService) SetProjectIAMPolicy(ctx context.Context, project string, policy *cloudresourcemanager.Policy) error {
+	projectsService := cloudresourcemanager.NewProjectsService(s.resourceManagerService)
+	request := &cloudresourcemanager.SetIamPolicyRequest{Policy: policy}
+	_, err := projectsService.SetIamPolicy(project, request).Context(ctx).Do()
+	return err
+}
+
+// GetRolePermissions returns the permissions included in the predefined role, e.g. "roles/viewer",
+// or the custom role, e.g. "projects/p/roles/r" or "organizations/o/roles/r". Uses roles.get methods of IAM API.
+// Requires iam.roles.get permission for custom roles.
+func (s *googleService) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	var result *iam.Role
+	var err error
+	switch {
+	case strings.HasPrefix(role, "projects/"):
+		result, err = iam.NewProjectsRolesService(s.iamService).Get(role).Context(ctx).Do()
+	case strings.HasPrefix(role, "organizations/"):
+		result, err = iam.NewOrganizationsRolesService(s.iamService).Get(role).Context(ctx).Do()
+	default:
+		result, err = iam.NewRolesService(s.iamService).Get(role).Context(ctx).Do()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result.IncludedPermissions, nil
+}
+
+// iamBinding describes the member of the unconditional role binding changed by the operation.
+type iamBinding struct {
+	project string
+	member  string
+	role    string
+}
+
+// parseIAMOperation returns the binding added or removed by the operation of the IAM recommendation.
+// Only unconditional bindings of projects are supported.
+func parseIAMOperation(operation *gcloudOperation) (*iamBinding, error) {
+	match := projectResourceRegexp.FindStringSubmatch(operation.Resource)
+	if match == nil {
+		return nil, fmt.Errorf("%w: resource %s is not a project", ErrOperationNotSupported, operation.Resource)
+	}
+	filters := make(map[string]interface{})
+	if len(operation.PathFilters) != 0 {
+		err := json.Unmarshal(operation.PathFilters, &filters)
+		if err != nil {
+			return nil, fmt.Errorf("malformed path filters: %v", err)
+		}
+	}
+	if condition, _ := filters[iamConditionPathFilter].(string); condition != "" {
+		return nil, fmt.Errorf("%w: conditional role binding with condition %s", ErrOperationNotSupported, condition)
+	}
+	binding := &iamBinding{project: match[1]}
+	binding.role, _ = filters[iamRolePathFilter].(string)
+	if binding.role == "" {
+		return nil, fmt.Errorf("path filter %s must be a non-empty string", iamRolePathFilter)
+	}
+	switch {
+	case operation.Action == "add" && operation.Path == iamAddMemberPath:
+		binding.member, _ = operation.Value.(string)
+	case operation.Action == "remove" && operation.Path == iamMemberPath:
+		binding.member, _ = filters[iamMemberPath].(string)
+	default:
+		return nil, fmt.Errorf("%w: %s %s of %s", ErrOperationNotSupported, operation.Action, operation.Path, operation.ResourceType)
+	}
+	if binding.member == "" {
+		return nil, fmt.Errorf("member of %s %s must be a non-empty string", operation.Action, operation.Path)
+	}
+	return binding, nil
+}
+
+// planIAMOperation returns the call applying the operation of the IAM recommendation:
+// AddIAMPolicyMember or RemoveIAMPolicyMember with the member as Resource and the role as Argument.
+func planIAMOperation(operation *gcloudOperation) (*OperationCall, error) {
+	binding, err := parseIAMOperation(operation)
+	if err != nil {
+		return nil, err
+	}
+	method := addIAMPolicyMemberMethod
+	if operation.Action == "remove" {
+		method = removeIAMPolicyMemberMethod
+	}
+	return &OperationCall{method, binding.project, "", binding.member, binding.role}, nil
+}
+
+// isIAMCall returns whether the call modifies the IAM policy.
+func isIAMCall(call *OperationCall) bool {
+	return call.Method == addIAMPolicyMemberMethod || call.Method == removeIAMPolicyMemberMethod
+}
+
+// unconditionalBinding returns the binding of the role without condition, or nil if there is none.
+func unconditionalBinding(policy *cloudresourcemanager.Policy, role string) *cloudresourcemanager.Binding {
+	for _, binding := range policy.Bindings {
+		if binding.Role == role && binding.Condition == nil {
+			return binding
+		}
+	}
+	return nil
+}
+
+// hasIAMPolicyMember returns whether the member has the role granted without condition.
+func hasIAMPolicyMember(policy *cloudresourcemanager.Policy, member, role string) bool {
+	binding := unconditionalBinding(policy, role)
+	if binding == nil {
+		return false
+	}
+	for _, current := range binding.Members {
+		if current == member {
+			return true
+		}
+	}
+	return false
+}
+
+// updateIAMPolicyMember grants the role to the member without condition if add is true,
+// otherwise removes the member from the unconditional binding of the role.
+// The policy is read, modified and written back with its etag, so concurrent changes are not overwritten.
+func updateIAMPolicyMember(ctx context.Context, service GoogleService, project, member, role string, add bool) error {
+	policy, err := service.GetProjectIAMPolicy(ctx, project)
+	if err != nil {
+		return err
+	}
+	if hasIAMPolicyMember(policy, member, role) == add {
+		return nil
+	}
+	binding := unconditionalBinding(policy, role)
+	if add {
+		if binding == nil {
+			binding = &cloudresourcemanager.Binding{Role: role}
+			policy.Bindings = append(policy.Bindings, binding)
+		}
+		binding.Members = append(binding.Members, member)
+	} else {
+		var members []string
+		for _, current := range binding.Members {
+			if current != member {
+				members = append(members, current)
+			}
+		}
+		binding.Members = members
+		if len(members) == 0 {
+			var bindings []*cloudresourcemanager.Binding
+			for _, current := range policy.Bindings {
+				if current != binding {
+					bindings = append(bindings, current)
+				}
+			}
+			policy.Bindings = bindings
+		}
+	}
+	return service.SetProjectIAMPolicy(ctx, project, policy)
+}
+
+// ListIAMRecommendations returns the recommendations of google.iam.policy.Recommender for the project,
+// which reduce roles granted in the project IAM policy.
+// Requires recommender.iamPolicyRecommendations.list permission.
+func ListIAMRecommendations(ctx context.Context, service GoogleService, project string) ([]*gcloudRecommendation, error) {
+	return service.ListRecommendations(ctx, project, "global", iamRecommenderID)
+}
+
+// IAMRoleChange describes the change of roles of the member proposed by the IAM recommendation.
+// RemovedPermissions are the permissions of RemovedRoles that none of AddedRoles includes, sorted.
+type IAMRoleChange struct {
+	Recommendation     string   `json:"recommendation"`
+	Project            string   `json:"project"`
+	Member             string   `json:"member"`
+	RemovedRoles       []string `json:"removedRoles"`
+	AddedRoles         []string `json:"addedRoles"`
+	RemovedPermissions []string `json:"removedPermissions"`
+}
+
+// DescribeIAMRecommendation returns the change of roles proposed by the IAM recommendation.
+// Requires iam.roles.get permission if custom roles are changed.
+// At most one of returned values will be non-nil.
+func DescribeIAMRecommendation(ctx context.Context, service GoogleService, rec *gcloudRecommendation) (*IAMRoleChange, error) {
+	change := &IAMRoleChange{Recommendation: rec.Name}
+	for _, group := range rec.Content.OperationGroups {
+		for _, operation := range group.Operations {
+			binding, err := parseIAMOperation(operation)
+			if err != nil {
+				return nil, err
+			}
+			if change.Member != "" && (change.Member != binding.member || change.Project != binding.project) {
+				return nil, fmt.Errorf("%w: recommendation %s changes roles of several members", ErrOperationNotSupported, rec.Name)
+			}
+			change.Project, change.Member = binding.project, binding.member
+			if operation.Action == "add" {
+				change.AddedRoles = append(change.AddedRoles, binding.role)
+			} else {
+				change.RemovedRoles = append(change.RemovedRoles, binding.role)
+			}
+		}
+	}
+
+	kept := make(map[string]bool)
+	for _, role := range change.AddedRoles {
+		permissions, err := service.GetRolePermissions(ctx, role)
+		if err != nil {
+			return nil, err
+		}
+		for _, permission := range permissions {
+			kept[permission] = true
+		}
+	}
+	removed := make(map[string]bool)
+	for _, role := range change.RemovedRoles {
+		permissions, err := service.GetRolePermissions(ctx, role)
+		if err != nil {
+			return nil, err
+		}
+		for _, permission := range permissions {
+			if !kept[permission] && !removed[permission] {
+				removed[permission] = true
+				change.RemovedPermissions = append(change.RemovedPermissions, permission)
+			}
+		}
+	}
+	sort.Strings(change.RemovedPermissions)
+	return change, nil
+}
+
+// WithIAMPolicyChanges confirms that Apply may change IAM policies of projects, applying recommendations
+// of google.iam.policy.Recommender. Without it, Apply wraps ErrConfirmationRequired for such recommendations,
+// unless in dry run, and DoOperation always does. The change of roles can be reviewed with DescribeIAMRecommendation first.
+func WithIAMPolicyChanges() ApplyOption {
+	return func(c *applyConfig) {
+		c.iamPolicyChanges = true
+	}
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	testProject = "//cloudresourcemanager.googleapis.com/projects/p"
+	testMember  = "user:alice@example.com"
+)
+
+// mockIAMService is mockApplyService with an IAM policy of the project and permissions of roles.
+type mockIAMService struct {
+	*mockApplyService
+	policy *cloudresourcemanager.Policy
+	roles  map[string][]string
+}
+
+func (s *mockIAMService) GetProjectIAMPolicy(ctx context.Context, project string) (*cloudresourcemanager.Policy, error) {
+	return s.policy, nil
+}
+
+func (s *mockIAMService) SetProjectIAMPolicy(ctx context.Context, project string, policy *cloudresourcemanager.Policy) error {
+	s.calls = append(s.calls, "SetProjectIAMPolicy "+project)
+	s.policy = policy
+	return nil
+}
+
+func (s *mockIAMService) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	return s.roles[role], nil
+}
+
+func newMockIAMService() *mockIAMService {
+	return &mockIAMService{
+		mockApplyService: newMockApplyService(),
+		policy: &cloudresourcemanager.Policy{
+			Bindings: []*cloudresourcemanager.Binding{
+				{Role: "roles/editor", Members: []string{testMember}},
+				{Role: "roles/owner", Members: []string{"user:bob@example.com"}},
+			},
+			Etag: "etag",
+		},
+		roles: map[string][]string{
+			"roles/editor":         {"compute.instances.delete", "compute.instances.get", "storage.buckets.get"},
+			"roles/compute.viewer": {"compute.instances.get"},
+		},
+	}
+}
+
+func iamFilters(role, member string) googleapi.RawMessage {
+	filters := `{"` + iamRolePathFilter + `": "` + role + `"`
+	if member != "" {
+		filters += `, "` + iamMemberPath + `": "` + member + `"`
+	}
+	return googleapi.RawMessage(filters + "}")
+}
+
+func iamRecommendation() *gcloudRecommendation {
+	rec := makeRecommendation("projects/p/locations/global/recommenders/google.iam.policy.Recommender/recommendations/r", 1,
+		&gcloudOperation{Action: "add", Path: iamAddMemberPath, Resource: testProject, ResourceType: projectResourceType,
+			PathFilters: iamFilters("roles/compute.viewer", ""), Value: testMember},
+		&gcloudOperation{Action: "remove", Path: iamMemberPath, Resource: testProject, ResourceType: projectResourceType,
+			PathFilters: iamFilters("roles/editor", testMember)})
+	rec.StateInfo = &gcloudStateInfo{State: "ACTIVE"}
+	return rec
+}
+
+func TestApplyIAMRecommendation(t *testing.T) {
+	service := newMockIAMService()
+	_, err := Apply(context.Background(), service, iamRecommendation(), WithIAMPolicyChanges())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"SetProjectIAMPolicy p", "SetProjectIAMPolicy p"}, service.calls)
+	assert.Equal(t, []*cloudresourcemanager.Binding{
+		{Role: "roles/owner", Members: []string{"user:bob@example.com"}},
+		{Role: "roles/compute.viewer", Members: []string{testMember}},
+	}, service.policy.Bindings, "Empty binding should be removed")
+	assert.Equal(t, []string{"CLAIMED", "SUCCEEDED"}, service.marks)
+
+	progress := &OperationProgress{Operation: iamRecommendation().Content.OperationGroups[0].Operations[1]}
+	assert.Equal(t, "revoking role in project p", progress.Description())
+}
+
+func TestApplyIAMRecommendationRequiresConfirmation(t *testing.T) {
+	service := newMockIAMService()
+	_, err := Apply(context.Background(), service, iamRecommendation())
+	assert.True(t, errors.Is(err, ErrConfirmationRequired), "IAM policy shouldn't be changed without the option")
+	assert.Empty(t, service.calls)
+	assert.Empty(t, service.marks, "Recommendation shouldn't be claimed")
+
+	_, err = Apply(context.Background(), service, iamRecommendation(), WithDryRun())
+	assert.NoError(t, err, "Dry run should not require confirmation")
+	assert.Empty(t, service.calls)
+}
+
+func TestDoIAMOperationRequiresConfirmation(t *testing.T) {
+	service := newMockIAMService()
+	for _, operation := range iamRecommendation().Content.OperationGroups[0].Operations {
+		err := DoOperation(context.Background(), service, operation)
+		assert.True(t, errors.Is(err, ErrConfirmationRequired), "DoOperation shouldn't change IAM policy")
+	}
+	assert.Empty(t, service.calls)
+}
+
+func TestPlanConditionalIAMOperation(t *testing.T) {
+	operation := &gcloudOperation{Action: "remove", Path: iamMemberPath, Resource: testProject, ResourceType: projectResourceType,
+		PathFilters: googleapi.RawMessage(`{"` + iamRolePathFilter + `": "roles/editor", "` + iamMemberPath + `": "` + testMember +
+			`", "` + iamConditionPathFilter + `": "request.time < timestamp('2021-01-01T00:00:00Z')"}`)}
+	_, err := planIAMOperation(operation)
+	assert.True(t, errors.Is(err, ErrOperationNotSupported), "Conditional bindings should not be supported")
+}
+
+func TestDescribeIAMRecommendation(t *testing.T) {
+	change, err := DescribeIAMRecommendation(context.Background(), newMockIAMService(), iamRecommendation())
+	if assert.NoError(t, err) {
+		assert.Equal(t, &IAMRoleChange{
+			Recommendation:     iamRecommendation().Name,
+			Project:            "p",
+			Member:             testMember,
+			RemovedRoles:       []string{"roles/editor"},
+			AddedRoles:         []string{"roles/compute.viewer"},
+			RemovedPermissions: []string{"compute.instances.delete", "storage.buckets.get"},
+		}, change)
+	}
+}
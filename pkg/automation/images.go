@@ -0,0 +1,90 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/googleinterns/recomator/pkg/resourcename"
+	"google.golang.org/api/compute/v1"
+)
+
+// DeleteImage calls the images.delete method and waits for the operation to finish.
+// Requires compute.images.delete permission.
+func (s *googleService) DeleteImage(ctx context.Context, project, image string) error {
+	imagesService := compute.NewImagesService(s.computeService)
+	operation, err := imagesService.Delete(project, image).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return s.waitForOperation(ctx, project, "", operation)
+}
+
+// GetImage calls the images.get method.
+// Requires compute.images.get permission.
+// At most one of returned values will be non-nil.
+func (s *googleService) GetImage(ctx context.Context, project, image string) (*compute.Image, error) {
+	imagesService := compute.NewImagesService(s.computeService)
+	return imagesService.Get(project, image).Context(ctx).Do()
+}
+
+// ListImages returns the list of custom images in the project matching the filter, e.g. created by LabelsFilter.
+// Uses images.list method, all pages are fetched.
+// Requires compute.images.list permission.
+func (s *googleService) ListImages(ctx context.Context, project, filter string) ([]*compute.Image, error) {
+	imagesService := compute.NewImagesService(s.computeService)
+	var images []*compute.Image
+	addImages := func(imageList *compute.ImageList) error {
+		images = append(images, imageList.Items...)
+		return nil
+	}
+	err := imagesService.List(project).Filter(filter).Pages(ctx, addImages)
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// parseGlobalImage returns the project and the name of the image,
+// e.g. "//compute.googleapis.com/projects/p/global/images/i".
+func parseGlobalImage(resource string) (project, name string, err error) {
+	parsed, err := resourcename.Parse(resource)
+	if err != nil {
+		return "", "", err
+	}
+	if parsed.Scope != resourcename.GlobalScope || parsed.ResourceType != "images" {
+		return "", "", fmt.Errorf("%w: resource %s is not an image", ErrOperationNotSupported, resource)
+	}
+	return parsed.Project, parsed.Name, nil
+}
+
+// ImageExporter exports images to Cloud Storage before Apply deletes them, see WithImageExport.
+// It can, for example, run the Cloud Build workflow used by "gcloud compute images export".
+type ImageExporter interface {
+	// exports the image, returns nil only if the export has finished
+	ExportImage(ctx context.Context, project, image string) error
+}
+
+// WithImageExport makes Apply export images with exporter before deleting them.
+// If the export fails, the image is not deleted and the recommendation is marked as failed.
+// The export is not performed in dry run.
+func WithImageExport(exporter ImageExporter) ApplyOption {
+	return func(c *applyConfig) {
+		c.imageExporter = exporter
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testImage = "//compute.googleapis.com/projects/p/global/images/old-image"
+
+// mockImageService is mockApplyService recording deleted images.
+type mockImageService struct {
+	*mockApplyService
+}
+
+func (s *mockImageService) DeleteImage(ctx context.Context, project, image string) error {
+	s.calls = append(s.calls, "DeleteImage "+project+" "+image)
+	return nil
+}
+
+// mockImageExporter records exported images in calls of the service, failing if err is set.
+type mockImageExporter struct {
+	service *mockImageService
+	err     error
+}
+
+func (e *mockImageExporter) ExportImage(ctx context.Context, project, image string) error {
+	e.service.calls = append(e.service.calls, "ExportImage "+project+" "+image)
+	return e.err
+}
+
+func imageRecommendation() *gcloudRecommendation {
+	rec := makeRecommendation("projects/p/locations/global/recommenders/google.compute.image.IdleResourceRecommender/recommendations/r", 1,
+		&gcloudOperation{Action: "remove", Path: "/", Resource: testImage, ResourceType: imageResourceType})
+	rec.StateInfo = &gcloudStateInfo{State: "ACTIVE"}
+	return rec
+}
+
+func TestApplyImageRecommendation(t *testing.T) {
+	service := &mockImageService{newMockApplyService()}
+	report, err := Apply(context.Background(), service, imageRecommendation())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "DeleteImage(p, , old-image)", report.Calls[0].String())
+	}
+	assert.Equal(t, []string{"DeleteImage p old-image"}, service.calls)
+	assert.Equal(t, []string{"CLAIMED", "SUCCEEDED"}, service.marks)
+
+	progress := &OperationProgress{Operation: imageRecommendation().Content.OperationGroups[0].Operations[0]}
+	assert.Equal(t, "deleting image old-image", progress.Description())
+}
+
+func TestApplyImageExport(t *testing.T) {
+	service := &mockImageService{newMockApplyService()}
+	exporter := &mockImageExporter{service: service}
+	_, err := Apply(context.Background(), service, imageRecommendation(), WithImageExport(exporter))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ExportImage p old-image", "DeleteImage p old-image"}, service.calls, "Image should be exported first")
+
+	service = &mockImageService{newMockApplyService()}
+	exportErr := errors.New("bucket not found")
+	exporter = &mockImageExporter{service: service, err: exportErr}
+	_, err = Apply(context.Background(), service, imageRecommendation(), WithImageExport(exporter))
+	assert.True(t, errors.Is(err, exportErr), "Export error should be wrapped")
+	assert.Equal(t, []string{"ExportImage p old-image"}, service.calls, "Image should not be deleted if the export failed")
+	assert.Equal(t, []string{"CLAIMED", "FAILED"}, service.marks)
+
+	service = &mockImageService{newMockApplyService()}
+	exporter = &mockImageExporter{service: service}
+	_, err = Apply(context.Background(), service, imageRecommendation(), WithImageExport(exporter), WithDryRun())
+	assert.NoError(t, err)
+	assert.Empty(t, service.calls, "Image should not be exported in dry run")
+}
+
+func TestParseGlobalImage(t *testing.T) {
+	project, image, err := parseGlobalImage(testImage)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "p", project)
+		assert.Equal(t, "old-image", image)
+	}
+	_, _, err = parseGlobalImage("//compute.googleapis.com/projects/p/global/snapshots/s")
+	assert.True(t, errors.Is(err, ErrOperationNotSupported), "Snapshots are not images")
+}
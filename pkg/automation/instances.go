@@ -17,29 +17,91 @@ limitations under the License.
 package automation
 
 import (
+	"context"
 	"fmt"
 
 	"google.golang.org/api/compute/v1"
 )
 
 // ChangeMachineType changes machine type using instances.setMachineType method
-func (s *googleService) ChangeMachineType(project string, zone string, instance string, machineType string) error {
+// and waits for the operation to finish.
+func (s *googleService) ChangeMachineType(ctx context.Context, project string, zone string, instance string, machineType string) error {
 	machineType = fmt.Sprintf("zones/%s/machineTypes/%s", zone, machineType)
 	request := &compute.InstancesSetMachineTypeRequest{MachineType: machineType}
 	instancesService := compute.NewInstancesService(s.computeService)
-	_, err := instancesService.SetMachineType(project, zone, instance, request).Do()
-	return err
+	operation, err := instancesService.SetMachineType(project, zone, instance, request).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return s.waitForOperation(ctx, project, zone, operation)
+}
+
+// DeleteInstance deletes instance using instances.delete method
+// and waits for the operation to finish. Attached disks marked for auto-delete are deleted with it.
+func (s *googleService) DeleteInstance(ctx context.Context, project string, zone string, instance string) error {
+	instancesService := compute.NewInstancesService(s.computeService)
+	operation, err := instancesService.Delete(project, zone, instance).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return s.waitForOperation(ctx, project, zone, operation)
 }
 
 // GetInstance gets instance using instances.get method
-func (s *googleService) GetInstance(project string, zone string, instance string) (*compute.Instance, error) {
+func (s *googleService) GetInstance(ctx context.Context, project string, zone string, instance string) (*compute.Instance, error) {
+	instancesService := compute.NewInstancesService(s.computeService)
+	return instancesService.Get(project, zone, instance).Context(ctx).Do()
+}
+
+// StartInstance starts instance using instances.start method
+// and waits for the operation to finish.
+func (s *googleService) StartInstance(ctx context.Context, project string, zone string, instance string) error {
 	instancesService := compute.NewInstancesService(s.computeService)
-	return instancesService.Get(project, zone, instance).Do()
+	operation, err := instancesService.Start(project, zone, instance).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return s.waitForOperation(ctx, project, zone, operation)
 }
 
 // StopInstance stops instance using instances.stop method
-func (s *googleService) StopInstance(project string, zone string, instance string) error {
+// and waits for the operation to finish.
+func (s *googleService) StopInstance(ctx context.Context, project string, zone string, instance string) error {
 	instancesService := compute.NewInstancesService(s.computeService)
-	_, err := instancesService.Stop(project, zone, instance).Do()
-	return err
+	operation, err := instancesService.Stop(project, zone, instance).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+	return s.waitForOperation(ctx, project, zone, operation)
+}
+
+// ListInstances returns the list of instances in the zone, or in all zones if zone is empty.
+// Uses instances.list or instances.aggregatedList methods, all pages are fetched.
+// Requires compute.instances.list permission.
+func (s *googleService) ListInstances(ctx context.Context, project, zone string) ([]*compute.Instance, error) {
+	instancesService := compute.NewInstancesService(s.computeService)
+	var instances []*compute.Instance
+	if zone != "" {
+		addInstances := func(instanceList *compute.InstanceList) error {
+			instances = append(instances, instanceList.Items...)
+			return nil
+		}
+		err := instancesService.List(project, zone).Pages(ctx, addInstances)
+		if err != nil {
+			return nil, err
+		}
+		return instances, nil
+	}
+
+	addInstances := func(instanceList *compute.InstanceAggregatedList) error {
+		for _, scopedList := range instanceList.Items {
+			instances = append(instances, scopedList.Instances...)
+		}
+		return nil
+	}
+	err := instancesService.AggregatedList(project).Pages(ctx, addInstances)
+	if err != nil {
+		return nil, err
+	}
+	return instances, nil
 }
@@ -0,0 +1,276 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// InventoryInstance is the instance as recorded in the Inventory.
+// MonthlyCost is set only if the price of the machine type is known, it is 0 for instances that are not running.
+type InventoryInstance struct {
+	Name        string   `json:"name"`
+	Zone        string   `json:"zone"`
+	MachineType string   `json:"machineType"`
+	Status      string   `json:"status"`
+	MonthlyCost *float64 `json:"monthlyCost,omitempty"`
+}
+
+// InventoryDisk is the persistent disk as recorded in the Inventory.
+// MonthlyCost is set only if the price of the disk type is known.
+type InventoryDisk struct {
+	Name        string   `json:"name"`
+	Zone        string   `json:"zone"`
+	Type        string   `json:"type"`
+	SizeGb      int64    `json:"sizeGb"`
+	MonthlyCost *float64 `json:"monthlyCost,omitempty"`
+}
+
+// Inventory is the snapshot of instances and disks of the project taken at Time.
+// MonthlyCost is the sum of known costs of resources, in CurrencyCode.
+type Inventory struct {
+	Project      string               `json:"project"`
+	Time         time.Time            `json:"time"`
+	Instances    []*InventoryInstance `json:"instances"`
+	Disks        []*InventoryDisk     `json:"disks"`
+	MonthlyCost  float64              `json:"monthlyCost"`
+	CurrencyCode string               `json:"currencyCode,omitempty"`
+}
+
+// addCost adds the cost to the total cost of the inventory, returning false if the currency doesn't match.
+func (inv *Inventory) addCost(cost float64, currencyCode string) bool {
+	if inv.CurrencyCode == "" {
+		inv.CurrencyCode = currencyCode
+	}
+	if inv.CurrencyCode != currencyCode {
+		return false
+	}
+	inv.MonthlyCost += cost
+	return true
+}
+
+// instanceCost returns the monthly cost of the instance, caching machine types of its zone in machineTypes.
+func instanceCost(ctx context.Context, service GoogleService, catalog PriceCatalog, project string,
+	instance *InventoryInstance, machineTypes map[string]map[string]*compute.MachineType) (float64, string, error) {
+	zoneTypes, ok := machineTypes[instance.Zone]
+	if !ok {
+		list, err := service.ListMachineTypes(ctx, project, instance.Zone)
+		if err != nil {
+			return 0, "", err
+		}
+		zoneTypes = make(map[string]*compute.MachineType)
+		for _, machineType := range list {
+			zoneTypes[machineType.Name] = machineType
+		}
+		machineTypes[instance.Zone] = zoneTypes
+	}
+	machineType, ok := zoneTypes[instance.MachineType]
+	if !ok {
+		return 0, "", fmt.Errorf("machine type %s is not listed in zone %s", instance.MachineType, instance.Zone)
+	}
+	price, currencyCode, err := MachineTypePrice(catalog, zoneRegion(instance.Zone), machineType)
+	if err != nil {
+		return 0, "", err
+	}
+	if instance.Status != "RUNNING" {
+		price = 0
+	}
+	return price, currencyCode, nil
+}
+
+// TakeInventory lists instances and disks of the project and records them as of now.
+// If catalog is not nil, costs of resources are computed from it, resources with unknown prices are left without them.
+// Requires compute.instances.list, compute.disks.list and, if catalog is not nil, compute.machineTypes.list permissions.
+// If the error occurred the returned error is not nil.
+func TakeInventory(ctx context.Context, service GoogleService, catalog PriceCatalog, project string, now time.Time) (*Inventory, error) {
+	instances, err := service.ListInstances(ctx, project, "")
+	if err != nil {
+		return nil, err
+	}
+	disks, err := service.ListDisks(ctx, project, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	inv := &Inventory{Project: project, Time: now}
+	machineTypes := make(map[string]map[string]*compute.MachineType)
+	for _, instance := range instances {
+		item := &InventoryInstance{
+			Name:        instance.Name,
+			Zone:        lastPathElement(instance.Zone),
+			MachineType: lastPathElement(instance.MachineType),
+			Status:      instance.Status,
+		}
+		if catalog != nil {
+			cost, currencyCode, err := instanceCost(ctx, service, catalog, project, item, machineTypes)
+			if err == nil && inv.addCost(cost, currencyCode) {
+				item.MonthlyCost = &cost
+			}
+		}
+		inv.Instances = append(inv.Instances, item)
+	}
+	for _, disk := range disks {
+		item := &InventoryDisk{
+			Name:   disk.Name,
+			Zone:   lastPathElement(disk.Zone),
+			Type:   lastPathElement(disk.Type),
+			SizeGb: disk.SizeGb,
+		}
+		if catalog != nil {
+			gbPrice, currencyCode, err := catalog.StoragePrice(item.Type, zoneRegion(item.Zone))
+			cost := gbPrice * float64(item.SizeGb)
+			if err == nil && inv.addCost(cost, currencyCode) {
+				item.MonthlyCost = &cost
+			}
+		}
+		inv.Disks = append(inv.Disks, item)
+	}
+	return inv, nil
+}
+
+// InventoryStore is the interface for storing inventories taken by TakeInventory, e.g. periodically.
+// Implementations must be thread-safe.
+type InventoryStore interface {
+	// stores the inventory
+	Store(inv *Inventory)
+
+	// returns inventories of the project taken between from and to, sorted by time
+	Load(project string, from, to time.Time) []*Inventory
+}
+
+// memoryInventoryStore implements InventoryStore interface storing the inventories in memory.
+type memoryInventoryStore struct {
+	data  map[string][]*Inventory
+	mutex sync.Mutex
+}
+
+// NewMemoryInventoryStore creates new InventoryStore storing the inventories in memory.
+func NewMemoryInventoryStore() InventoryStore {
+	return &memoryInventoryStore{data: make(map[string][]*Inventory)}
+}
+
+func (s *memoryInventoryStore) Store(inv *Inventory) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.data[inv.Project] = append(s.data[inv.Project], inv)
+}
+
+func (s *memoryInventoryStore) Load(project string, from, to time.Time) []*Inventory {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var result []*Inventory
+	for _, inv := range s.data[project] {
+		if !inv.Time.Before(from) && !inv.Time.After(to) {
+			result = append(result, inv)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].Time.Before(result[j].Time) })
+	return result
+}
+
+// MachineTypeChange is the change of the machine type of the instance between two inventories.
+type MachineTypeChange struct {
+	Name   string `json:"name"`
+	Zone   string `json:"zone"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// InventoryDiff lists changes between two inventories of the project.
+// Stopped instances are instances that were running before and are not running after.
+type InventoryDiff struct {
+	AddedInstances   []*InventoryInstance `json:"addedInstances"`
+	RemovedInstances []*InventoryInstance `json:"removedInstances"`
+	StoppedInstances []*InventoryInstance `json:"stoppedInstances"`
+	ResizedInstances []*MachineTypeChange `json:"resizedInstances"`
+	AddedDisks       []*InventoryDisk     `json:"addedDisks"`
+	RemovedDisks     []*InventoryDisk     `json:"removedDisks"`
+	MonthlyCostDelta float64              `json:"monthlyCostDelta"`
+	CurrencyCode     string               `json:"currencyCode,omitempty"`
+}
+
+// DiffInventories returns changes of the project from before to after.
+// The cost delta is computed from total costs of inventories, so it includes resources not related to recomator.
+// If the inventories are of different projects or costs are in different currencies the returned error is not nil.
+func DiffInventories(before, after *Inventory) (*InventoryDiff, error) {
+	if before.Project != after.Project {
+		return nil, fmt.Errorf("inventories of different projects %s and %s", before.Project, after.Project)
+	}
+	if before.CurrencyCode != "" && after.CurrencyCode != "" && before.CurrencyCode != after.CurrencyCode {
+		return nil, fmt.Errorf("inventories with costs in different currencies %s and %s", before.CurrencyCode, after.CurrencyCode)
+	}
+
+	diff := &InventoryDiff{MonthlyCostDelta: after.MonthlyCost - before.MonthlyCost, CurrencyCode: after.CurrencyCode}
+	if diff.CurrencyCode == "" {
+		diff.CurrencyCode = before.CurrencyCode
+	}
+
+	beforeInstances := make(map[string]*InventoryInstance)
+	for _, instance := range before.Instances {
+		beforeInstances[instance.Zone+"/"+instance.Name] = instance
+	}
+	afterInstances := make(map[string]bool)
+	for _, instance := range after.Instances {
+		key := instance.Zone + "/" + instance.Name
+		afterInstances[key] = true
+		old, ok := beforeInstances[key]
+		if !ok {
+			diff.AddedInstances = append(diff.AddedInstances, instance)
+			continue
+		}
+		if old.Status == "RUNNING" && instance.Status != "RUNNING" {
+			diff.StoppedInstances = append(diff.StoppedInstances, instance)
+		}
+		if old.MachineType != instance.MachineType {
+			diff.ResizedInstances = append(diff.ResizedInstances, &MachineTypeChange{
+				Name:   instance.Name,
+				Zone:   instance.Zone,
+				Before: old.MachineType,
+				After:  instance.MachineType,
+			})
+		}
+	}
+	for _, instance := range before.Instances {
+		if !afterInstances[instance.Zone+"/"+instance.Name] {
+			diff.RemovedInstances = append(diff.RemovedInstances, instance)
+		}
+	}
+
+	beforeDisks := make(map[string]bool)
+	for _, disk := range before.Disks {
+		beforeDisks[disk.Zone+"/"+disk.Name] = true
+	}
+	afterDisks := make(map[string]bool)
+	for _, disk := range after.Disks {
+		afterDisks[disk.Zone+"/"+disk.Name] = true
+		if !beforeDisks[disk.Zone+"/"+disk.Name] {
+			diff.AddedDisks = append(diff.AddedDisks, disk)
+		}
+	}
+	for _, disk := range before.Disks {
+		if !afterDisks[disk.Zone+"/"+disk.Name] {
+			diff.RemovedDisks = append(diff.RemovedDisks, disk)
+		}
+	}
+	return diff, nil
+}
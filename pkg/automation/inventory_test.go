@@ -0,0 +1,114 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/cloudbilling/v1"
+	"google.golang.org/api/compute/v1"
+)
+
+type mockInventoryService struct {
+	GoogleService
+	instances []*compute.Instance
+	disks     []*compute.Disk
+}
+
+func (s *mockInventoryService) ListInstances(ctx context.Context, project, zone string) ([]*compute.Instance, error) {
+	return s.instances, nil
+}
+
+func (s *mockInventoryService) ListDisks(ctx context.Context, project, zone, filter string) ([]*compute.Disk, error) {
+	return s.disks, nil
+}
+
+func (s *mockInventoryService) ListMachineTypes(ctx context.Context, project, zone string) ([]*compute.MachineType, error) {
+	return testMachineTypes, nil
+}
+
+func newMockInventoryService() *mockInventoryService {
+	zone := "https://www.googleapis.com/compute/v1/projects/p/zones/us-east1-b"
+	return &mockInventoryService{
+		instances: []*compute.Instance{
+			&compute.Instance{Name: "big", Zone: zone, MachineType: zone + "/machineTypes/n1-standard-4", Status: "RUNNING"},
+			&compute.Instance{Name: "idle", Zone: zone, MachineType: zone + "/machineTypes/n1-standard-2", Status: "RUNNING"},
+		},
+		disks: []*compute.Disk{
+			&compute.Disk{Name: "data", Zone: zone, Type: zone + "/diskTypes/pd-standard", SizeGb: 100},
+			&compute.Disk{Name: "unused", Zone: zone, Type: zone + "/diskTypes/pd-standard", SizeGb: 500},
+		},
+	}
+}
+
+func TestInventoryDiff(t *testing.T) {
+	catalog := &skuPriceCatalog{
+		listSkus: func() ([]*cloudbilling.Sku, error) {
+			return append(testSkus, makeSku("Storage PD Capacity", "Storage", "GiBy.mo", 40000000, "us-east1")), nil
+		},
+		ttl: time.Hour,
+	}
+	service := newMockInventoryService()
+	start := time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)
+	before, err := TakeInventory(context.Background(), service, catalog, "p", start)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if assert.NotNil(t, before.Instances[0].MonthlyCost) {
+		assert.InDelta(t, 4*73+15*7.3, *before.Instances[0].MonthlyCost, 1e-9)
+	}
+	assert.InDelta(t, 4*73+15*7.3+2*73+7.5*7.3+600*0.04, before.MonthlyCost, 1e-9)
+	assert.Equal(t, "USD", before.CurrencyCode)
+
+	service.instances[0].MachineType = "zones/us-east1-b/machineTypes/n1-standard-2"
+	service.instances[1].Status = "TERMINATED"
+	service.disks = service.disks[:1]
+	after, err := TakeInventory(context.Background(), service, catalog, "p", start.AddDate(0, 3, 0))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.InDelta(t, 0, *after.Instances[1].MonthlyCost, 1e-9, "Stopped instance doesn't cost anything")
+
+	diff, err := DiffInventories(before, after)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []*MachineTypeChange{&MachineTypeChange{"big", "us-east1-b", "n1-standard-4", "n1-standard-2"}}, diff.ResizedInstances)
+	if assert.Equal(t, 1, len(diff.StoppedInstances)) {
+		assert.Equal(t, "idle", diff.StoppedInstances[0].Name)
+	}
+	if assert.Equal(t, 1, len(diff.RemovedDisks)) {
+		assert.Equal(t, "unused", diff.RemovedDisks[0].Name)
+	}
+	assert.Empty(t, diff.AddedInstances)
+	assert.Empty(t, diff.RemovedInstances)
+	assert.Empty(t, diff.AddedDisks)
+	assert.InDelta(t, -2*73-7.5*7.3-2*73-7.5*7.3-500*0.04, diff.MonthlyCostDelta, 1e-9)
+
+	store := NewMemoryInventoryStore()
+	store.Store(after)
+	store.Store(before)
+	loaded := store.Load("p", start, start.AddDate(1, 0, 0))
+	assert.Equal(t, []*Inventory{before, after}, loaded, "Inventories should be sorted by time")
+	assert.Empty(t, store.Load("p", start.AddDate(0, 0, 1), start.AddDate(0, 1, 0)))
+
+	_, err = DiffInventories(before, &Inventory{Project: "other"})
+	assert.Error(t, err, "Inventories of different projects can't be compared")
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// jsonStreamBufferSize is the size of the buffer WriteRecommendationsJSON writes through.
+const jsonStreamBufferSize = 64 * 1024
+
+// WriteRecommendationsJSON writes recs to w as a JSON array, equivalent to json.Marshal(recs).
+// Recommendations are encoded one at a time by the same encoder into a fixed size buffer,
+// so that responses with many recommendations are never held in memory as a whole.
+// With WithAnonymizer option each recommendation is anonymized before encoding.
+// If the error occurred the returned error is not nil and w may contain part of the array.
+func WriteRecommendationsJSON(w io.Writer, recs []*gcloudRecommendation, options ...ExportOption) error {
+	config := newExportConfig(options)
+	buffered := bufio.NewWriterSize(w, jsonStreamBufferSize)
+	encoder := json.NewEncoder(buffered)
+	buffered.WriteByte('[')
+	for i, rec := range recs {
+		if i > 0 {
+			buffered.WriteByte(',')
+		}
+		// Encode appends a newline, which is valid whitespace inside the array
+		var value interface{} = rec
+		if config.anonymizer != nil {
+			var err error
+			value, err = anonymizeJSON(config.anonymizer, rec)
+			if err != nil {
+				return err
+			}
+		}
+		err := encoder.Encode(value)
+		if err != nil {
+			return err
+		}
+	}
+	buffered.WriteByte(']')
+	// errors of WriteByte are returned by Flush
+	return buffered.Flush()
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// manyRecommendations returns n copies of the disk recommendation.
+func manyRecommendations(n int) []*gcloudRecommendation {
+	var recs []*gcloudRecommendation
+	for i := 0; i < n; i++ {
+		rec, _ := ParseRecommendation([]byte(diskRecommendationJSON))
+		recs = append(recs, rec)
+	}
+	return recs
+}
+
+func TestWriteRecommendationsJSON(t *testing.T) {
+	for _, n := range []int{0, 1, 3} {
+		recs := manyRecommendations(n)
+		var buffer bytes.Buffer
+		if !assert.NoError(t, WriteRecommendationsJSON(&buffer, recs)) {
+			continue
+		}
+		expected, err := json.Marshal(recs)
+		if n == 0 {
+			expected = []byte("[]")
+		}
+		if assert.NoError(t, err) {
+			assert.JSONEq(t, string(expected), buffer.String(), "Result should be equivalent to json.Marshal")
+		}
+	}
+}
+
+func BenchmarkWriteRecommendationsJSON(b *testing.B) {
+	recs := manyRecommendations(10000)
+	b.Run("Marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			data, _ := json.Marshal(recs)
+			ioutil.Discard.Write(data)
+		}
+	})
+	b.Run("WriteRecommendationsJSON", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			WriteRecommendationsJSON(ioutil.Discard, recs)
+		}
+	})
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"fmt"
+
+	"google.golang.org/api/recommender/v1"
+)
+
+type gcloudOperationGroup = recommender.GoogleCloudRecommenderV1OperationGroup
+
+// OperationProgress describes the operation being applied by Apply.
+// Group and Index are positions of the operation, Done and Total count operations of the whole recommendation.
+type OperationProgress struct {
+	Recommendation string
+	Group          int
+	Index          int
+	Done           int
+	Total          int
+	Operation      *gcloudOperation
+}
+
+// Description returns the human readable description of the operation, e.g. "stopping instance alicja-test".
+func (p *OperationProgress) Description() string {
+	name := lastPathElement(p.Operation.Resource)
+	switch {
+	case p.Operation.Action == "test":
+		return fmt.Sprintf("checking %s of %s", p.Operation.Path, name)
+	case p.Operation.ResourceType == projectResourceType && p.Operation.Path == "/":
+		return "deleting project " + name
+	case p.Operation.ResourceType == projectResourceType && p.Operation.Action == "add":
+		return "granting role in project " + name
+	case p.Operation.ResourceType == projectResourceType:
+		return "revoking role in project " + name
+	case p.Operation.ResourceType == sqlInstanceResourceType && p.Operation.Path == "/settings/tier":
+		return "changing tier of Cloud SQL instance " + name
+	case p.Operation.ResourceType == sqlInstanceResourceType:
+		return "stopping Cloud SQL instance " + name
+	case p.Operation.Action == "replace" && p.Operation.Path == "/machineType":
+		return "changing machine type of instance " + name
+	case isStartOperation(p.Operation):
+		return "starting instance " + name
+	case p.Operation.Action == "replace" && p.Operation.Path == "/status":
+		return "stopping instance " + name
+	case p.Operation.Action == "add" && p.Operation.ResourceType == snapshotResourceType:
+		return "creating snapshot"
+	case p.Operation.Action == "remove" && p.Operation.ResourceType == diskResourceType:
+		return "deleting disk " + name
+	case p.Operation.Action == "remove" && p.Operation.ResourceType == instanceResourceType:
+		return "deleting instance " + name
+	case p.Operation.Action == "remove" && p.Operation.ResourceType == imageResourceType:
+		return "deleting image " + name
+	default:
+		return fmt.Sprintf("%s %s of %s", p.Operation.Action, p.Operation.Path, name)
+	}
+}
+
+func (p *OperationProgress) String() string {
+	return fmt.Sprintf("%d/%d operations done: %s", p.Done, p.Total, p.Description())
+}
+
+// ProgressListener is the interface for receiving the progress of Apply, see WithProgressListener.
+// Methods are called synchronously, so they should return quickly.
+type ProgressListener interface {
+	// called before applying the operation group
+	OnGroupStart(recommendation string, group, numberOfGroups int)
+
+	// called after applying the operation group, err is not nil if it failed
+	OnGroupDone(recommendation string, group int, err error)
+
+	// called before applying the operation
+	OnOperationStart(progress *OperationProgress)
+
+	// called after applying the operation, err is not nil if it failed
+	OnOperationDone(progress *OperationProgress, err error)
+}
+
+// noopListener implements ProgressListener interface ignoring the progress.
+type noopListener struct{}
+
+func (noopListener) OnGroupStart(recommendation string, group, numberOfGroups int) {}
+
+func (noopListener) OnGroupDone(recommendation string, group int, err error) {}
+
+func (noopListener) OnOperationStart(progress *OperationProgress) {}
+
+func (noopListener) OnOperationDone(progress *OperationProgress, err error) {}
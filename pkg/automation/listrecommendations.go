@@ -17,8 +17,11 @@ limitations under the License.
 package automation
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
 
 	"google.golang.org/api/compute/v1"
 	"google.golang.org/api/recommender/v1"
@@ -30,7 +33,7 @@ type gcloudRecommendation = recommender.GoogleCloudRecommenderV1Recommendation
 // ListRecommendations returns the list of recommendations for specified project, zone, recommender.
 // projects.locations.recommenders.recommendations/list method from Recommender API is used.
 // If the error occurred the returned error is not nil.
-func (s *googleService) ListRecommendations(project, location, recommenderID string) ([]*gcloudRecommendation, error) {
+func (s *googleService) ListRecommendations(ctx context.Context, project, location, recommenderID string) ([]*gcloudRecommendation, error) {
 	recommendationsService := recommender.NewProjectsLocationsRecommendersRecommendationsService(s.recommenderService)
 	listCall := recommendationsService.List(fmt.Sprintf("projects/%s/locations/%s/recommenders/%s", project, location, recommenderID))
 	var recommendations []*gcloudRecommendation
@@ -39,7 +42,7 @@ func (s *googleService) ListRecommendations(project, location, recommenderID str
 		return nil
 	}
 
-	err := listCall.Pages(s.ctx, addRecommendations)
+	err := listCall.Pages(ctx, addRecommendations)
 	if err != nil {
 		return nil, err
 	}
@@ -49,7 +52,7 @@ func (s *googleService) ListRecommendations(project, location, recommenderID str
 // ListZonesNames returns list of zone names for the specified project.
 // Uses zones/list method from Compute API.
 // If the error occurred the returned error is not nil.
-func (s *googleService) ListZonesNames(project string) ([]string, error) {
+func (s *googleService) ListZonesNames(ctx context.Context, project string) ([]string, error) {
 	zonesService := compute.NewZonesService(s.computeService)
 	listCall := zonesService.List(project)
 
@@ -60,7 +63,7 @@ func (s *googleService) ListZonesNames(project string) ([]string, error) {
 		}
 		return nil
 	}
-	err := listCall.Pages(s.ctx, addZones)
+	err := listCall.Pages(ctx, addZones)
 	if err != nil {
 		return nil, err
 	}
@@ -70,7 +73,7 @@ func (s *googleService) ListZonesNames(project string) ([]string, error) {
 // ListRegionsNames returns list of region names for the specified project.
 // Uses regions/list method from Compute API.
 // If the error occurred the returned error is not nil.
-func (s *googleService) ListRegionsNames(project string) ([]string, error) {
+func (s *googleService) ListRegionsNames(ctx context.Context, project string) ([]string, error) {
 	regionsService := compute.NewRegionsService(s.computeService)
 	listCall := regionsService.List(project)
 
@@ -81,7 +84,7 @@ func (s *googleService) ListRegionsNames(project string) ([]string, error) {
 		}
 		return nil
 	}
-	err := listCall.Pages(s.ctx, addRegions)
+	err := listCall.Pages(ctx, addRegions)
 	if err != nil {
 		return []string{}, err
 	}
@@ -90,13 +93,13 @@ func (s *googleService) ListRegionsNames(project string) ([]string, error) {
 
 // ListLocations return the list of all locations per project(zones and regions).
 // Exactly one of returned values will be non-nil.
-func ListLocations(service GoogleService, project string) ([]string, error) {
-	zones, err := service.ListZonesNames(project)
+func ListLocations(ctx context.Context, service GoogleService, project string) ([]string, error) {
+	zones, err := service.ListZonesNames(ctx, project)
 	if err != nil {
 		return nil, err
 	}
 
-	regions, err := service.ListRegionsNames(project)
+	regions, err := service.ListRegionsNames(ctx, project)
 	if err != nil {
 		return nil, err
 	}
@@ -105,48 +108,140 @@ func ListLocations(service GoogleService, project string) ([]string, error) {
 	return locations, nil
 }
 
+// googleRecommenders are recommenders listed by ListRecommendations, sorted.
+// Recommendations of reportOnlyRecommenders among them are listed, but not applied.
 var googleRecommenders = []string{
+	"google.cloudsql.instance.IdleRecommender",
+	"google.cloudsql.instance.OverprovisionedRecommender",
+	commitmentRecommenderID,
 	"google.compute.disk.IdleResourceRecommender",
+	"google.compute.image.IdleResourceRecommender",
 	"google.compute.instance.IdleResourceRecommender",
 	"google.compute.instance.MachineTypeRecommender",
 }
 
+// regionalRecommenders are recommenders whose recommendations exist only in regions,
+// listing them in zones fails, so ListRecommendations lists them only in regions.
+var regionalRecommenders = map[string]bool{
+	"google.cloudsql.instance.IdleRecommender":            true,
+	"google.cloudsql.instance.OverprovisionedRecommender": true,
+	commitmentRecommenderID:                               true,
+}
+
+// globalLocation is the location of recommendations for global resources, e.g. images.
+const globalLocation = "global"
+
+// globalRecommenders are recommenders of global resources, listed by ListRecommendations only in globalLocation.
+var globalRecommenders = map[string]bool{
+	"google.compute.image.IdleResourceRecommender": true,
+}
+
 type recommendationsResult struct {
+	location        string
+	recommenderID   string
 	recommendations []*gcloudRecommendation
 	err             error
 }
 
+// LocationError is the error of listing recommendations of the recommender in the location.
+type LocationError struct {
+	Location      string
+	RecommenderID string
+	Err           error
+}
+
+func (e *LocationError) Error() string {
+	return fmt.Sprintf("listing %s in %s: %v", e.RecommenderID, e.Location, e.Err)
+}
+
+func (e *LocationError) Unwrap() error {
+	return e.Err
+}
+
+// ListErrors are the errors of all failed calls made by ListRecommendations,
+// sorted by location and recommender. Unwrap returns the first of them,
+// so the errors can be checked with errors.Is and errors.As.
+type ListErrors []*LocationError
+
+func (e ListErrors) Error() string {
+	var messages []string
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e ListErrors) Unwrap() error {
+	return e[0]
+}
+
 // concatResults receives numberOfResults values from results channel.
-// Returns concatenated slice of all recommendations. If one of results contains error, returns error.
+// Returns concatenated slice of all recommendations. If some of results contain errors, returns ListErrors.
 // At most one of returned values will be non-nil.
 func concatResults(results <-chan recommendationsResult, numberOfResults int) ([]*gcloudRecommendation, error) {
-	var err error
+	var errs ListErrors
 	var recommendations []*gcloudRecommendation
 	for i := 0; i < numberOfResults; i++ {
 		result := <-results
 		if result.err != nil {
-			err = result.err
+			errs = append(errs, &LocationError{Location: result.location, RecommenderID: result.recommenderID, Err: result.err})
 		} else {
 			recommendations = append(recommendations, result.recommendations...)
 		}
 	}
 
-	if err != nil {
-		return nil, err
+	if len(errs) != 0 {
+		sort.Slice(errs, func(i, j int) bool {
+			if errs[i].Location != errs[j].Location {
+				return errs[i].Location < errs[j].Location
+			}
+			return errs[i].RecommenderID < errs[j].RecommenderID
+		})
+		return nil, errs
 	}
 	return recommendations, nil
 }
 
 // ListRecommendations returns the list of recommendations for a Cloud project from googleRecommenders.
+// regionalRecommenders are listed only in regions, globalRecommenders only in globalLocation,
+// the others in all zones and regions.
 // Requires the recommender.*.list IAM permissions for the recommenders.
 // numConcurrentCalls specifies the maximum number of concurrent calls to ListRecommendations method,
 // non-positive values are ignored, instead the default value is used.
+// Failure of some calls doesn't stop the others, if any of them failed ListErrors is returned.
 // task structure tracks the progress of the function.
-func ListRecommendations(service GoogleService, project string, numConcurrentCalls int, task *Task) ([]*gcloudRecommendation, error) {
-	locations, err := ListLocations(service, project)
+func ListRecommendations(ctx context.Context, service GoogleService, project string, numConcurrentCalls int, task *Task) ([]*gcloudRecommendation, error) {
+	return listRecommendations(ctx, service, project, googleRecommenders, numConcurrentCalls, task)
+}
+
+// listRecommendations is ListRecommendations listing only recommendations of recommenderIDs.
+func listRecommendations(ctx context.Context, service GoogleService, project string, recommenderIDs []string, numConcurrentCalls int, task *Task) ([]*gcloudRecommendation, error) {
+	type query struct {
+		location      string
+		recommenderID string
+	}
+
+	zones, err := service.ListZonesNames(ctx, project)
 	if err != nil {
 		return nil, err
 	}
+	regions, err := service.ListRegionsNames(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	var queries []query
+	for _, recommenderID := range recommenderIDs {
+		locations := append(append([]string(nil), zones...), regions...)
+		if regionalRecommenders[recommenderID] {
+			locations = regions
+		}
+		if globalRecommenders[recommenderID] {
+			locations = []string{globalLocation}
+		}
+		for _, location := range locations {
+			queries = append(queries, query{location: location, recommenderID: recommenderID})
+		}
+	}
 
 	numWorkers := numConcurrentCalls
 	const defaultNumWorkers = 16
@@ -154,34 +249,27 @@ func ListRecommendations(service GoogleService, project string, numConcurrentCal
 		numWorkers = defaultNumWorkers
 	}
 
-	type query struct {
-		location      string
-		recommenderID string
-	}
-
-	numberOfQueries := len(locations) * len(googleRecommenders)
+	numberOfQueries := len(queries)
 	task.SetNumberOfSubtasks(numberOfQueries)
 
 	results := make(chan recommendationsResult, numberOfQueries)
-	queries := make(chan query, numberOfQueries)
+	queriesChan := make(chan query, numberOfQueries)
 
 	for i := 0; i < numWorkers; i++ {
 		go func() {
-			for query := range queries {
-				recs, err := service.ListRecommendations(project, query.location, query.recommenderID)
-				results <- recommendationsResult{recs, err}
+			for query := range queriesChan {
+				recs, err := service.ListRecommendations(ctx, project, query.location, query.recommenderID)
+				results <- recommendationsResult{query.location, query.recommenderID, recs, err}
 				task.IncrementDone()
 			}
 		}()
 	}
 
-	for _, recommenderID := range googleRecommenders {
-		for _, location := range locations {
-			queries <- query{location: location, recommenderID: recommenderID}
-		}
+	for _, query := range queries {
+		queriesChan <- query
 	}
 
-	close(queries)
+	close(queriesChan)
 
 	recommendations, err := concatResults(results, numberOfQueries)
 	if err == nil {
@@ -192,30 +280,39 @@ func ListRecommendations(service GoogleService, project string, numConcurrentCal
 
 // ListResult contains information about listing recommendations for all projects.
 // If user doesn't have enough permissions for the project, the requirements, including failed ones, are listed in failedProjects.
-// Otherwise, recommendations for the project are appended to recommendations.
+// Otherwise, recommendations for the project are appended to recommendations,
+// except recommendations of the recommenders skipped for the project, see ProjectRequirements.SkippedRecommenders.
+// ResourceCards contains the same recommendations grouped by the resource they target.
+// ProjectsRecommendations contains the same recommendations per project ID.
 type ListResult struct {
-	Recommendations []*gcloudRecommendation
-	FailedProjects  []*ProjectRequirements
+	Recommendations         []*gcloudRecommendation
+	FailedProjects          []*ProjectRequirements
+	ResourceCards           []*ResourceCard
+	ProjectsRecommendations map[string][]*gcloudRecommendation
 }
 
-func listRecommendationsIfRequirementsCompleted(service GoogleService, projectsRequirements []*ProjectRequirements, numConcurrentCalls int, task *Task) (*ListResult, error) {
+func listRecommendationsIfRequirementsCompleted(ctx context.Context, service GoogleService, projectsRequirements []*ProjectRequirements, numConcurrentCalls int, task *Task) (*ListResult, error) {
 	task.SetNumberOfSubtasks(len(projectsRequirements))
 
-	var listResult ListResult
+	listResult := ListResult{ProjectsRecommendations: make(map[string][]*gcloudRecommendation)}
 	for _, projectRequirements := range projectsRequirements {
-		ok := true
-		for _, req := range projectRequirements.Requirements {
-			if req.Status == RequirementFailed {
-				ok = false
-				break
+		if requirementsCompleted(projectRequirements.Requirements) {
+			skipped := make(map[string]bool)
+			for _, recommenderID := range projectRequirements.SkippedRecommenders {
+				skipped[recommenderID] = true
 			}
-		}
-		if ok {
-			newRecs, err := ListRecommendations(service, projectRequirements.Project, numConcurrentCalls, task.GetNextSubtask())
+			var recommenderIDs []string
+			for _, recommenderID := range googleRecommenders {
+				if !skipped[recommenderID] {
+					recommenderIDs = append(recommenderIDs, recommenderID)
+				}
+			}
+			newRecs, err := listRecommendations(ctx, service, projectRequirements.Project, recommenderIDs, numConcurrentCalls, task.GetNextSubtask())
 			if err != nil {
 				return nil, err
 			}
 			listResult.Recommendations = append(listResult.Recommendations, newRecs...)
+			listResult.ProjectsRecommendations[projectRequirements.Project] = newRecs
 		} else {
 			listResult.FailedProjects = append(listResult.FailedProjects, projectRequirements)
 		}
@@ -223,16 +320,18 @@ func listRecommendationsIfRequirementsCompleted(service GoogleService, projectsR
 		task.IncrementDone()
 	}
 
+	listResult.ResourceCards = GroupByResource(listResult.Recommendations)
 	task.SetAllDone()
 	return &listResult, nil
 }
 
 // ListAllProjectsRecommendations gets all projects for which user has projects.get permission.
-// If the user has enough permissions to apply and list recommendations, recommendations for projects are listed.
+// If the user has enough permissions to apply and list recommendations, recommendations for projects are listed,
+// skipping optional recommenders the user has no permissions for.
 // Otherwise, projects requirements, including failed ones, are added to `failedProjects` to help show warnings to the user.
 // task structure tracks how many subtasks have been done already.
-func ListAllProjectsRecommendations(service GoogleService, numConcurrentCalls int, task *Task) (*ListResult, error) {
-	projects, err := service.ListProjects()
+func ListAllProjectsRecommendations(ctx context.Context, service GoogleService, numConcurrentCalls int, task *Task) (*ListResult, error) {
+	projects, err := service.ListProjects(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -241,7 +340,7 @@ func ListAllProjectsRecommendations(service GoogleService, numConcurrentCalls in
 
 	task.SetNumberOfSubtasks(2) // 2 subtasks are calls to ListRequirements and listRecommendationsIfRequirementsCompleted
 
-	projectsRequirements, err := ListRequirements(service, projects, task.GetNextSubtask())
+	projectsRequirements, err := ListRequirements(ctx, service, projects, task.GetNextSubtask())
 	if err != nil {
 		return nil, err
 	}
@@ -250,7 +349,7 @@ func ListAllProjectsRecommendations(service GoogleService, numConcurrentCalls in
 
 	task.IncrementDone()
 
-	listResult, err := listRecommendationsIfRequirementsCompleted(service, projectsRequirements, numConcurrentCalls, task.GetNextSubtask())
+	listResult, err := listRecommendationsIfRequirementsCompleted(ctx, service, projectsRequirements, numConcurrentCalls, task.GetNextSubtask())
 
 	if err != nil {
 		return nil, err
@@ -17,7 +17,10 @@ limitations under the License.
 package automation
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -39,7 +42,7 @@ type query struct {
 	recommenderID string
 }
 
-func (s *MockService) ListRecommendations(project, location, recommenderID string) ([]*gcloudRecommendation, error) {
+func (s *MockService) ListRecommendations(ctx context.Context, project, location, recommenderID string) ([]*gcloudRecommendation, error) {
 	s.mutex.Lock()
 	s.numberOfTimesListRecommendationsCalls++
 	s.callsToList = append(s.callsToList, query{location, recommenderID})
@@ -47,18 +50,41 @@ func (s *MockService) ListRecommendations(project, location, recommenderID strin
 	return []*gcloudRecommendation{nil}, nil
 }
 
-func (s *MockService) ListZonesNames(project string) ([]string, error) {
+func (s *MockService) ListZonesNames(ctx context.Context, project string) ([]string, error) {
 	return s.zones, nil
 }
 
-func (s *MockService) ListRegionsNames(project string) ([]string, error) {
+func (s *MockService) ListRegionsNames(ctx context.Context, project string) ([]string, error) {
 	return s.regions, nil
 }
 
-func makeQueries(locations []string) []query {
-	var queries []query
+// locationRecommenders returns recommenders listed in the location.
+func locationRecommenders(location string, regions []string) []string {
+	var result []string
 	for _, rec := range googleRecommenders {
-		for _, loc := range locations {
+		if globalRecommenders[rec] || location == globalLocation {
+			if globalRecommenders[rec] && location == globalLocation {
+				result = append(result, rec)
+			}
+			continue
+		}
+		if !regionalRecommenders[rec] {
+			result = append(result, rec)
+			continue
+		}
+		for _, region := range regions {
+			if region == location {
+				result = append(result, rec)
+			}
+		}
+	}
+	return result
+}
+
+func makeQueries(zones, regions []string) []query {
+	var queries []query
+	for _, loc := range append(append(append([]string(nil), zones...), regions...), globalLocation) {
+		for _, rec := range locationRecommenders(loc, regions) {
 			queries = append(queries, query{loc, rec})
 		}
 	}
@@ -71,11 +97,10 @@ func TestListRecommendations(t *testing.T) {
 		regions := []string{"region1", "region2", "region3"}
 		mock := &MockService{zones: zones, regions: regions}
 		task := &Task{}
-		result, err := ListRecommendations(mock, "", numConcurrentCalls, task)
+		result, err := ListRecommendations(context.Background(), mock, "", numConcurrentCalls, task)
 
 		if assert.NoError(t, err, "Unexpected error from ListRecommendations") {
-			locations := append(mock.zones, mock.regions...)
-			queries := makeQueries(locations)
+			queries := makeQueries(mock.zones, mock.regions)
 			assert.Equal(t, len(queries), len(result), "One recommendation from each query was expected")
 			assert.Equal(t, len(queries), mock.numberOfTimesListRecommendationsCalls, "Wrong number of ListRecommendations calls")
 			assert.ElementsMatch(t, queries, mock.callsToList, "ListRecommendations was called for different locations and recommenders")
@@ -95,20 +120,41 @@ type ErrorZonesService struct {
 	regions []string
 }
 
-func (s *ErrorZonesService) ListZonesNames(project string) ([]string, error) {
+func (s *ErrorZonesService) ListZonesNames(ctx context.Context, project string) ([]string, error) {
 	return []string{}, s.err
 }
 
-func (s *ErrorZonesService) ListRegionsNames(project string) ([]string, error) {
+func (s *ErrorZonesService) ListRegionsNames(ctx context.Context, project string) ([]string, error) {
 	return s.regions, nil
 }
 
+// mockRegionalService fails listing regional recommenders in zones.
+type mockRegionalService struct {
+	MockService
+}
+
+func (s *mockRegionalService) ListRecommendations(ctx context.Context, project, location, recommenderID string) ([]*gcloudRecommendation, error) {
+	for _, zone := range s.zones {
+		if regionalRecommenders[recommenderID] && location == zone {
+			return nil, fmt.Errorf("%s is not available in zone %s", recommenderID, zone)
+		}
+	}
+	return s.MockService.ListRecommendations(ctx, project, location, recommenderID)
+}
+
+func TestListRegionalRecommenders(t *testing.T) {
+	mock := &mockRegionalService{MockService{zones: []string{"us-east1-b", "us-east1-c"}, regions: []string{"us-east1"}}}
+	_, err := ListRecommendations(context.Background(), mock, "", 2, &Task{})
+	assert.NoError(t, err, "Regional recommenders should not be listed in zones")
+	assert.Contains(t, mock.callsToList, query{"us-east1", commitmentRecommenderID})
+}
+
 func TestErrorInListZones(t *testing.T) {
 	errorMessage := "error listing zones"
 	regions := []string{"region1", "region2", "region3"}
 
 	task := &Task{}
-	_, err := ListRecommendations(&ErrorZonesService{err: fmt.Errorf(errorMessage), regions: regions}, "", 2, task)
+	_, err := ListRecommendations(context.Background(), &ErrorZonesService{err: fmt.Errorf(errorMessage), regions: regions}, "", 2, task)
 	assert.EqualError(t, err, errorMessage, "Expected error calling ListZones")
 
 	done, all := task.GetProgress()
@@ -121,11 +167,11 @@ type ErrorRegionsService struct {
 	zones []string
 }
 
-func (s *ErrorRegionsService) ListZonesNames(project string) ([]string, error) {
+func (s *ErrorRegionsService) ListZonesNames(ctx context.Context, project string) ([]string, error) {
 	return s.zones, nil
 }
 
-func (s *ErrorRegionsService) ListRegionsNames(project string) ([]string, error) {
+func (s *ErrorRegionsService) ListRegionsNames(ctx context.Context, project string) ([]string, error) {
 	return []string{}, s.err
 }
 
@@ -134,7 +180,7 @@ func TestErrorInListRegions(t *testing.T) {
 	zones := []string{"zone1", "zone2", "zone3"}
 
 	task := &Task{}
-	_, err := ListRecommendations(&ErrorRegionsService{err: fmt.Errorf(errorMessage), zones: zones}, "", 2, task)
+	_, err := ListRecommendations(context.Background(), &ErrorRegionsService{err: fmt.Errorf(errorMessage), zones: zones}, "", 2, task)
 	assert.EqualError(t, err, errorMessage, "Expected error calling ListRegions")
 
 	done, all := task.GetProgress()
@@ -151,15 +197,15 @@ type ErrorRecommendationService struct {
 	regions             []string
 }
 
-func (s *ErrorRecommendationService) ListZonesNames(project string) ([]string, error) {
+func (s *ErrorRecommendationService) ListZonesNames(ctx context.Context, project string) ([]string, error) {
 	return s.zones, nil
 }
 
-func (s *ErrorRecommendationService) ListRegionsNames(project string) ([]string, error) {
+func (s *ErrorRecommendationService) ListRegionsNames(ctx context.Context, project string) ([]string, error) {
 	return s.regions, nil
 }
 
-func (s *ErrorRecommendationService) ListRecommendations(project, location, recommenderID string) ([]*gcloudRecommendation, error) {
+func (s *ErrorRecommendationService) ListRecommendations(ctx context.Context, project, location, recommenderID string) ([]*gcloudRecommendation, error) {
 	s.mutex.Lock()
 	s.numberOfTimesCalled++
 	s.mutex.Unlock()
@@ -194,9 +240,18 @@ func TestErrorInRecommendations(t *testing.T) {
 			}
 
 			task := &Task{}
-			_, err := ListRecommendations(service, "", numConcurrentCalls, task)
-			assert.EqualError(t, err, errorMessage, "Expected error calling ListRecommendations")
-			numQueries := len(locations) * len(googleRecommenders)
+			_, err := ListRecommendations(context.Background(), service, "", numConcurrentCalls, task)
+			var listErrors ListErrors
+			if assert.True(t, errors.As(err, &listErrors), "Expected error calling ListRecommendations") {
+				recommenders := locationRecommenders(location, regions)
+				assert.Equal(t, len(recommenders), len(listErrors), "Errors of all recommenders should be returned")
+				for i, locationErr := range listErrors {
+					assert.Equal(t, location, locationErr.Location)
+					assert.Equal(t, recommenders[i], locationErr.RecommenderID, "Errors should be sorted")
+				}
+			}
+			assert.True(t, errors.Is(err, service.err), "Original error should be wrapped")
+			numQueries := len(makeQueries(zones, regions))
 			assert.Equal(t, numQueries, service.numberOfTimesCalled, "ListRecommendations called wrong number of times")
 
 			done, all := task.GetProgress()
@@ -209,12 +264,12 @@ type BenchmarkService struct {
 	GoogleService
 }
 
-func (s *BenchmarkService) ListRecommendations(project, location, recommenderID string) ([]*gcloudRecommendation, error) {
+func (s *BenchmarkService) ListRecommendations(ctx context.Context, project, location, recommenderID string) ([]*gcloudRecommendation, error) {
 	time.Sleep(time.Millisecond * 100)
 	return []*gcloudRecommendation{}, nil
 }
 
-func (s *BenchmarkService) ListZonesNames(project string) ([]string, error) {
+func (s *BenchmarkService) ListZonesNames(ctx context.Context, project string) ([]string, error) {
 	zones := []string{}
 	for i := 0; i < 100; i++ {
 		zones = append(zones, fmt.Sprintf("zone %d", i))
@@ -222,7 +277,7 @@ func (s *BenchmarkService) ListZonesNames(project string) ([]string, error) {
 	return zones, nil
 }
 
-func (s *BenchmarkService) ListRegionsNames(project string) ([]string, error) {
+func (s *BenchmarkService) ListRegionsNames(ctx context.Context, project string) ([]string, error) {
 	regions := []string{}
 	for i := 0; i < 25; i++ {
 		regions = append(regions, fmt.Sprintf("region %d", i))
@@ -234,7 +289,7 @@ func BenchmarkGoroutines(b *testing.B) {
 	for _, numConcurrentCalls := range []int{4, 8, 16, 32, 64, 128} {
 		b.Run(fmt.Sprintf("%d goroutines:", numConcurrentCalls), func(b *testing.B) {
 			s := &BenchmarkService{}
-			ListRecommendations(s, "", numConcurrentCalls, &Task{})
+			ListRecommendations(context.Background(), s, "", numConcurrentCalls, &Task{})
 		})
 	}
 }
@@ -252,21 +307,22 @@ type MockProjectsService struct {
 	permissionCalls                  []string
 	mutex                            sync.Mutex
 	projects                         []string
+	missingPermission                string
 }
 
-func (s *MockProjectsService) ListProjects() ([]string, error) {
+func (s *MockProjectsService) ListProjects(ctx context.Context) ([]string, error) {
 	return s.projects, nil
 }
 
-func (s *MockProjectsService) ListZonesNames(project string) ([]string, error) {
+func (s *MockProjectsService) ListZonesNames(ctx context.Context, project string) ([]string, error) {
 	return []string{"one zone"}, nil
 }
 
-func (s *MockProjectsService) ListRegionsNames(project string) ([]string, error) {
+func (s *MockProjectsService) ListRegionsNames(ctx context.Context, project string) ([]string, error) {
 	return nil, nil
 }
 
-func (s *MockProjectsService) ListRecommendations(project, location, recommenderID string) ([]*gcloudRecommendation, error) {
+func (s *MockProjectsService) ListRecommendations(ctx context.Context, project, location, recommenderID string) ([]*gcloudRecommendation, error) {
 	s.mutex.Lock()
 	s.numberOfListRecommendationsCalls++
 	s.queries = append(s.queries, projectRecommender{project, recommenderID})
@@ -277,8 +333,8 @@ func (s *MockProjectsService) ListRecommendations(project, location, recommender
 func makeProjectsQueries(projects []string) []projectRecommender {
 	var result []projectRecommender
 	for _, pr := range projects {
-		for _, rec := range googleRecommenders {
-			result = append(result, projectRecommender{pr, rec})
+		for _, query := range makeQueries([]string{"one zone"}, nil) {
+			result = append(result, projectRecommender{pr, query.recommenderID})
 		}
 	}
 	return result
@@ -286,7 +342,7 @@ func makeProjectsQueries(projects []string) []projectRecommender {
 
 var okRequirements = []*Requirement{&Requirement{Status: RequirementCompleted}}
 
-func (s *MockProjectsService) ListAPIRequirements(project string, apis []string) ([]*Requirement, error) {
+func (s *MockProjectsService) ListAPIRequirements(ctx context.Context, project string, apis []string) ([]*Requirement, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.apiCalls = append(s.apiCalls, project)
@@ -296,13 +352,18 @@ func (s *MockProjectsService) ListAPIRequirements(project string, apis []string)
 	return okRequirements, nil
 }
 
-func (s *MockProjectsService) ListPermissionRequirements(project string, permissions [][]string) ([]*Requirement, error) {
+func (s *MockProjectsService) ListPermissionRequirements(ctx context.Context, project string, permissions [][]string) ([]*Requirement, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 	s.permissionCalls = append(s.permissionCalls, project)
 	if project == failedProject {
 		return failedRequirements, nil
 	}
+	for _, group := range permissions {
+		if group[0] == s.missingPermission {
+			return failedRequirements, nil
+		}
+	}
 	return okRequirements, nil
 }
 
@@ -321,7 +382,7 @@ func TestListAllProjectsRecommendations(t *testing.T) {
 				projects := append(okProjects, failedProjects...)
 				task := &Task{}
 				mock := &MockProjectsService{projects: projects}
-				res, err := ListAllProjectsRecommendations(mock, numConcurrentCalls, task)
+				res, err := ListAllProjectsRecommendations(context.Background(), mock, numConcurrentCalls, task)
 				if assert.NoError(t, err) {
 					done, all := task.GetProgress()
 					assert.True(t, done == all, "Task List all recommendations should be finished already")
@@ -334,7 +395,14 @@ func TestListAllProjectsRecommendations(t *testing.T) {
 					assert.ElementsMatch(t, queries, mock.queries, "List Recommendations was called with wrong parameters")
 
 					assert.ElementsMatch(t, projects, mock.apiCalls, "List api requirements was called for different projects")
-					assert.ElementsMatch(t, okProjects, mock.permissionCalls, "List permission requirements was called for different projects")
+					var permissionProjects []string
+					for _, project := range okProjects {
+						for i := 0; i <= len(optionalPermissions); i++ {
+							permissionProjects = append(permissionProjects, project)
+						}
+					}
+					assert.ElementsMatch(t, permissionProjects, mock.permissionCalls,
+						"List permission requirements should be called for required and optional permissions of ok projects")
 
 					assert.Equal(t, len(queries), len(res.Recommendations), "Wrong number of overall recommendations")
 					var failedProjectsRequirements []*ProjectRequirements
@@ -347,3 +415,27 @@ func TestListAllProjectsRecommendations(t *testing.T) {
 		}
 	}
 }
+
+func TestListAllProjectsRecommendationsOptionalPermissions(t *testing.T) {
+	mock := &MockProjectsService{projects: []string{"project"}, missingPermission: "cloudsql.instances.get"}
+	res, err := ListAllProjectsRecommendations(context.Background(), mock, 0, &Task{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Empty(t, res.FailedProjects, "Project without optional permissions should not fail")
+	var queries []projectRecommender
+	for _, query := range makeProjectsQueries([]string{"project"}) {
+		if !strings.HasPrefix(query.recommenderID, "google.cloudsql.") {
+			queries = append(queries, query)
+		}
+	}
+	assert.ElementsMatch(t, queries, mock.queries, "Cloud SQL recommenders should be skipped")
+}
+
+func TestListErrorsMessage(t *testing.T) {
+	err := ListErrors{
+		&LocationError{Location: "zone 1", RecommenderID: "r1", Err: fmt.Errorf("quota exceeded")},
+		&LocationError{Location: "zone 2", RecommenderID: "r2", Err: fmt.Errorf("not found")},
+	}
+	assert.EqualError(t, err, "listing r1 in zone 1: quota exceeded; listing r2 in zone 2: not found")
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// Formatter formats counts and amounts of money according to the locale,
+// e.g. "1.234,50" for de-DE instead of "1,234.50" for en-US.
+// Each report or notification target can use its own Formatter.
+type Formatter struct {
+	tag     language.Tag
+	printer *message.Printer
+}
+
+// NewFormatter creates new Formatter for the BCP 47 locale, e.g. "de-DE" or "pl".
+// If the locale is not well-formed the returned error is not nil.
+func NewFormatter(locale string) (*Formatter, error) {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return nil, err
+	}
+	return &Formatter{tag: tag, printer: message.NewPrinter(tag)}, nil
+}
+
+// Locale returns the locale of the formatter.
+func (f *Formatter) Locale() string {
+	return f.tag.String()
+}
+
+// Count returns n with digits grouped according to the locale, e.g. "1,234".
+func (f *Formatter) Count(n int) string {
+	return f.printer.Sprintf("%d", n)
+}
+
+// Money returns the amount with the currency symbol used in the locale,
+// rounded to the standard number of decimal places of the currency, e.g. "€1.234,50".
+func (f *Formatter) Money(amount float64, currencyCode string) string {
+	unit, err := currency.ParseISO(currencyCode)
+	if err != nil {
+		return f.printer.Sprintf("%.2f %s", amount, currencyCode)
+	}
+	scale, _ := currency.Standard.Rounding(unit)
+	return f.withSymbol(unit, f.printer.Sprintf("%.*f", scale, amount))
+}
+
+// RoundedMoney returns the amount rounded to whole units with the currency symbol used in the locale, e.g. "€23".
+func (f *Formatter) RoundedMoney(amount float64, currencyCode string) string {
+	unit, err := currency.ParseISO(currencyCode)
+	if err != nil {
+		return f.printer.Sprintf("%.0f %s", amount, currencyCode)
+	}
+	return f.withSymbol(unit, f.printer.Sprintf("%.0f", amount))
+}
+
+// withSymbol prefixes the formatted amount with the symbol of the currency.
+// As in CLDR currency spacing, symbols ending with a letter, e.g. "zł" or "PLN", are separated by a space.
+func (f *Formatter) withSymbol(unit currency.Unit, amount string) string {
+	symbol := f.printer.Sprint(currency.Symbol(unit))
+	last, _ := utf8.DecodeLastRuneInString(symbol)
+	if unicode.IsLetter(last) {
+		return symbol + " " + amount
+	}
+	return symbol + amount
+}
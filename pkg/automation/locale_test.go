@@ -0,0 +1,54 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatter(t *testing.T) {
+	for _, test := range []struct {
+		locale       string
+		count        string
+		money        string
+		roundedMoney string
+	}{
+		{"en-US", "1,234,567", "$1,234.50", "€23"},
+		{"de-DE", "1.234.567", "$1.234,50", "€23"},
+		{"pl", "1\u00a0234\u00a0567", "USD 1\u00a0234,50", "€23"},
+	} {
+		formatter, err := NewFormatter(test.locale)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.Equal(t, test.locale, formatter.Locale())
+		assert.Equal(t, test.count, formatter.Count(1234567))
+		assert.Equal(t, test.money, formatter.Money(1234.5, "USD"))
+		assert.Equal(t, test.roundedMoney, formatter.RoundedMoney(23.2, "EUR"))
+	}
+
+	formatter, err := NewFormatter("pl")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "zł 23", formatter.RoundedMoney(23, "PLN"), "Symbol ending with a letter should be separated")
+		assert.Equal(t, "JPY 1\u00a0234", formatter.Money(1234.4, "JPY"), "JPY has no decimal places")
+		assert.Equal(t, "1,50 XYZ", formatter.Money(1.5, "XYZ"), "Unknown currency should be formatted with its code")
+	}
+	_, err = NewFormatter("not a locale")
+	assert.Error(t, err)
+}
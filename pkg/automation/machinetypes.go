@@ -0,0 +1,229 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// ListMachineTypes returns the list of machine types available in the zone.
+// Uses machineTypes/list method from Compute API.
+// If the error occurred the returned error is not nil.
+func (s *googleService) ListMachineTypes(ctx context.Context, project, zone string) ([]*compute.MachineType, error) {
+	machineTypesService := compute.NewMachineTypesService(s.computeService)
+	listCall := machineTypesService.List(project, zone)
+
+	var machineTypes []*compute.MachineType
+	addMachineTypes := func(machineTypeList *compute.MachineTypeList) error {
+		machineTypes = append(machineTypes, machineTypeList.Items...)
+		return nil
+	}
+	err := listCall.Pages(ctx, addMachineTypes)
+	if err != nil {
+		return nil, err
+	}
+	return machineTypes, nil
+}
+
+// MachineTypeAlternative describes a machine type the instance can be changed to.
+// Deltas are relative to the current machine type of the instance.
+// If Incompatibilities is empty, the instance can be changed to this machine type.
+// Prices are set only by ListPricedMachineTypeAlternatives, if the price of the machine type is known.
+type MachineTypeAlternative struct {
+	MachineType       string   `json:"machineType"`
+	GuestCpus         int64    `json:"guestCpus"`
+	MemoryMb          int64    `json:"memoryMb"`
+	GuestCpusDelta    int64    `json:"guestCpusDelta"`
+	MemoryMbDelta     int64    `json:"memoryMbDelta"`
+	SameFamily        bool     `json:"sameFamily"`
+	SharedCpu         bool     `json:"sharedCpu"`
+	Incompatibilities []string `json:"incompatibilities"`
+	MonthlyPrice      *float64 `json:"monthlyPrice,omitempty"`
+	MonthlyPriceDelta *float64 `json:"monthlyPriceDelta,omitempty"`
+	CurrencyCode      string   `json:"currencyCode,omitempty"`
+}
+
+// families of machine types supporting GPUs
+var acceleratorFamilies = []string{"n1", "a2"}
+
+// lastPathElement returns the part of the path after the last "/".
+func lastPathElement(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// machineTypeFamily returns the family of the machine type, e.g. "n1" for "n1-standard-4".
+// Custom machine types without a family prefix belong to "n1".
+func machineTypeFamily(machineType string) string {
+	family := strings.Split(machineType, "-")[0]
+	if family == "custom" {
+		return "n1"
+	}
+	return family
+}
+
+// incompatibilities returns reasons why the instance can't be changed to the machine type.
+func incompatibilities(instance *compute.Instance, machineType *compute.MachineType) []string {
+	var result []string
+	if machineType.Deprecated != nil && machineType.Deprecated.State != "" {
+		result = append(result, "machine type is "+strings.ToLower(machineType.Deprecated.State))
+	}
+	if machineType.MaximumPersistentDisks > 0 && int64(len(instance.Disks)) > machineType.MaximumPersistentDisks {
+		result = append(result, fmt.Sprintf("at most %d persistent disks are supported, instance has %d",
+			machineType.MaximumPersistentDisks, len(instance.Disks)))
+	}
+	if len(instance.GuestAccelerators) > 0 {
+		supported := false
+		for _, family := range acceleratorFamilies {
+			supported = supported || family == machineTypeFamily(machineType.Name)
+		}
+		if !supported {
+			result = append(result, "instance has accelerators, they are supported only by "+
+				strings.Join(acceleratorFamilies, ", ")+" machine types")
+		}
+	}
+	return result
+}
+
+// setPrices sets prices of the alternatives from catalog, leaving them unset if the price is unknown.
+func setPrices(alternatives []*MachineTypeAlternative, machineTypes map[string]*compute.MachineType,
+	current *compute.MachineType, catalog PriceCatalog, region string) {
+	currentPrice, currentCurrency, currentErr := MachineTypePrice(catalog, region, current)
+	for _, alternative := range alternatives {
+		price, currencyCode, err := MachineTypePrice(catalog, region, machineTypes[alternative.MachineType])
+		if err != nil {
+			continue
+		}
+		alternative.MonthlyPrice = &price
+		alternative.CurrencyCode = currencyCode
+		if currentErr == nil && currentCurrency == currencyCode {
+			delta := price - currentPrice
+			alternative.MonthlyPriceDelta = &delta
+		}
+	}
+}
+
+// listMachineTypeAlternatives returns alternatives of the instance, priced from catalog if it is not nil.
+func listMachineTypeAlternatives(ctx context.Context, service GoogleService, catalog PriceCatalog, project, zone, instance string) ([]*MachineTypeAlternative, error) {
+	machineInstance, err := service.GetInstance(ctx, project, zone, instance)
+	if err != nil {
+		return nil, err
+	}
+	machineTypes, err := service.ListMachineTypes(ctx, project, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	currentName := lastPathElement(machineInstance.MachineType)
+	byName := make(map[string]*compute.MachineType)
+	for _, machineType := range machineTypes {
+		byName[machineType.Name] = machineType
+	}
+	current, ok := byName[currentName]
+	if !ok {
+		if !isCustomMachineType(currentName) {
+			return nil, fmt.Errorf("machine type %s of the instance is not listed in zone %s", currentName, zone)
+		}
+		// custom machine types are not listed, their specs are encoded in the name
+		custom, err := ParseCustomMachineType(currentName)
+		if err != nil {
+			return nil, err
+		}
+		current = &compute.MachineType{Name: currentName, GuestCpus: custom.GuestCpus, MemoryMb: custom.MemoryMb}
+	}
+
+	var result []*MachineTypeAlternative
+	for _, machineType := range machineTypes {
+		if machineType.Name == currentName {
+			continue
+		}
+		result = append(result, &MachineTypeAlternative{
+			MachineType:       machineType.Name,
+			GuestCpus:         machineType.GuestCpus,
+			MemoryMb:          machineType.MemoryMb,
+			GuestCpusDelta:    machineType.GuestCpus - current.GuestCpus,
+			MemoryMbDelta:     machineType.MemoryMb - current.MemoryMb,
+			SameFamily:        machineTypeFamily(machineType.Name) == machineTypeFamily(currentName),
+			SharedCpu:         machineType.IsSharedCpu,
+			Incompatibilities: incompatibilities(machineInstance, machineType),
+		})
+	}
+	if catalog != nil {
+		setPrices(result, byName, current, catalog, zoneRegion(zone))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].GuestCpus != result[j].GuestCpus {
+			return result[i].GuestCpus < result[j].GuestCpus
+		}
+		return result[i].MemoryMb < result[j].MemoryMb
+	})
+	return result, nil
+}
+
+// ListMachineTypeAlternatives returns machine types available for the instance, except the current one,
+// sorted by the number of CPUs and memory. The current machine type can be a custom one.
+// Requires compute.instances.get and compute.machineTypes.list permissions.
+func ListMachineTypeAlternatives(ctx context.Context, service GoogleService, project, zone, instance string) ([]*MachineTypeAlternative, error) {
+	return listMachineTypeAlternatives(ctx, service, nil, project, zone, instance)
+}
+
+// ListPricedMachineTypeAlternatives returns the same as ListMachineTypeAlternatives,
+// with monthly prices from catalog and price deltas relative to the current machine type.
+// Alternatives with unknown prices are left without them, deltas are set only if the current price is known.
+func ListPricedMachineTypeAlternatives(ctx context.Context, service GoogleService, catalog PriceCatalog, project, zone, instance string) ([]*MachineTypeAlternative, error) {
+	return listMachineTypeAlternatives(ctx, service, catalog, project, zone, instance)
+}
+
+// ReplaceMachineType returns a copy of the recommendation
+// that changes the machine type of the instance to machineType instead of the recommended one.
+// The original recommendation is not modified.
+func ReplaceMachineType(rec *gcloudRecommendation, machineType string) (*gcloudRecommendation, error) {
+	if rec.Content == nil {
+		return nil, errors.New("recommendation has no content")
+	}
+	result := *rec
+	content := *rec.Content
+	content.OperationGroups = nil
+	replaced := false
+	for _, group := range rec.Content.OperationGroups {
+		newGroup := *group
+		newGroup.Operations = nil
+		for _, operation := range group.Operations {
+			newOperation := *operation
+			if operation.Action == "replace" && operation.Path == "/machineType" {
+				value, ok := operation.Value.(string)
+				if !ok {
+					return nil, errors.New("value of machine type replace operation must be of type string")
+				}
+				newOperation.Value = value[:strings.LastIndex(value, "/")+1] + machineType
+				replaced = true
+			}
+			newGroup.Operations = append(newGroup.Operations, &newOperation)
+		}
+		content.OperationGroups = append(content.OperationGroups, &newGroup)
+	}
+	if !replaced {
+		return nil, errors.New("recommendation doesn't change the machine type")
+	}
+	result.Content = &content
+	return &result, nil
+}
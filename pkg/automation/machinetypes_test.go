@@ -0,0 +1,133 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/compute/v1"
+)
+
+type mockMachineTypesService struct {
+	GoogleService
+	instance     *compute.Instance
+	machineTypes []*compute.MachineType
+}
+
+func (s *mockMachineTypesService) GetInstance(ctx context.Context, project, zone, instance string) (*compute.Instance, error) {
+	return s.instance, nil
+}
+
+func (s *mockMachineTypesService) ListMachineTypes(ctx context.Context, project, zone string) ([]*compute.MachineType, error) {
+	return s.machineTypes, nil
+}
+
+var testMachineTypes = []*compute.MachineType{
+	&compute.MachineType{Name: "n1-standard-4", GuestCpus: 4, MemoryMb: 15360, MaximumPersistentDisks: 128},
+	&compute.MachineType{Name: "e2-medium", GuestCpus: 2, MemoryMb: 4096, IsSharedCpu: true, MaximumPersistentDisks: 128},
+	&compute.MachineType{Name: "n1-standard-2", GuestCpus: 2, MemoryMb: 7680, MaximumPersistentDisks: 1},
+	&compute.MachineType{Name: "n1-old", GuestCpus: 1, Deprecated: &compute.DeprecationStatus{State: "DEPRECATED"}},
+}
+
+func TestListMachineTypeAlternatives(t *testing.T) {
+	service := &mockMachineTypesService{
+		instance: &compute.Instance{
+			MachineType: "https://www.googleapis.com/compute/v1/projects/p/zones/z/machineTypes/n1-standard-4",
+			Disks:       []*compute.AttachedDisk{&compute.AttachedDisk{}, &compute.AttachedDisk{}},
+		},
+		machineTypes: testMachineTypes,
+	}
+	alternatives, err := ListMachineTypeAlternatives(context.Background(), service, "p", "z", "i")
+	if !assert.NoError(t, err) || !assert.Equal(t, 3, len(alternatives), "Current machine type is not an alternative") {
+		return
+	}
+	old, e2, n1 := alternatives[0], alternatives[1], alternatives[2]
+	assert.Equal(t, "n1-old", old.MachineType, "Alternatives should be sorted by CPUs")
+	assert.Equal(t, []string{"machine type is deprecated"}, old.Incompatibilities)
+
+	assert.Equal(t, "e2-medium", e2.MachineType, "Alternatives should be sorted by memory")
+	assert.Equal(t, int64(-2), e2.GuestCpusDelta)
+	assert.Equal(t, int64(4096-15360), e2.MemoryMbDelta)
+	assert.False(t, e2.SameFamily)
+	assert.True(t, e2.SharedCpu)
+	assert.Empty(t, e2.Incompatibilities)
+
+	assert.Equal(t, "n1-standard-2", n1.MachineType)
+	assert.True(t, n1.SameFamily)
+	assert.Equal(t, []string{"at most 1 persistent disks are supported, instance has 2"}, n1.Incompatibilities)
+}
+
+func TestListMachineTypeAlternativesAccelerators(t *testing.T) {
+	service := &mockMachineTypesService{
+		instance: &compute.Instance{
+			MachineType:       "zones/z/machineTypes/n1-standard-4",
+			GuestAccelerators: []*compute.AcceleratorConfig{&compute.AcceleratorConfig{}},
+		},
+		machineTypes: testMachineTypes,
+	}
+	alternatives, err := ListMachineTypeAlternatives(context.Background(), service, "p", "z", "i")
+	if assert.NoError(t, err) && assert.Equal(t, 3, len(alternatives)) {
+		assert.Equal(t, "e2-medium", alternatives[1].MachineType)
+		assert.Equal(t, []string{"instance has accelerators, they are supported only by n1, a2 machine types"},
+			alternatives[1].Incompatibilities)
+		assert.Empty(t, alternatives[2].Incompatibilities)
+	}
+}
+
+func TestListMachineTypeAlternativesCustomType(t *testing.T) {
+	service := &mockMachineTypesService{
+		instance:     &compute.Instance{MachineType: "zones/z/machineTypes/custom-2-7680"},
+		machineTypes: testMachineTypes,
+	}
+	alternatives, err := ListMachineTypeAlternatives(context.Background(), service, "p", "z", "i")
+	if assert.NoError(t, err, "Custom machine types are not listed, but should be supported") &&
+		assert.Equal(t, 4, len(alternatives)) {
+		n1 := alternatives[3]
+		assert.Equal(t, "n1-standard-4", n1.MachineType)
+		assert.Equal(t, int64(2), n1.GuestCpusDelta)
+		assert.Equal(t, int64(15360-7680), n1.MemoryMbDelta)
+		assert.True(t, n1.SameFamily)
+	}
+}
+
+func TestListMachineTypeAlternativesUnknownType(t *testing.T) {
+	service := &mockMachineTypesService{
+		instance:     &compute.Instance{MachineType: "zones/z/machineTypes/unknown"},
+		machineTypes: testMachineTypes,
+	}
+	alternatives, err := ListMachineTypeAlternatives(context.Background(), service, "p", "z", "i")
+	assert.Error(t, err, "Machine type of the instance should be listed")
+	assert.Nil(t, alternatives, "Only one of returned values should be non-nil")
+}
+
+func TestReplaceMachineType(t *testing.T) {
+	rec := makeRecommendation("resize", 1,
+		&gcloudOperation{Action: "test", Path: "/machineType", Resource: testInstance},
+		&gcloudOperation{Action: "replace", Path: "/machineType", Resource: testInstance, Value: "zones/z/machineTypes/custom-2-5120"})
+	result, err := ReplaceMachineType(rec, "e2-medium")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "zones/z/machineTypes/e2-medium", result.Content.OperationGroups[0].Operations[1].Value)
+		assert.Equal(t, "zones/z/machineTypes/custom-2-5120", rec.Content.OperationGroups[0].Operations[1].Value,
+			"Original recommendation should not be modified")
+		assert.Equal(t, rec.Name, result.Name)
+	}
+
+	_, err = ReplaceMachineType(stopInstanceRecommendation("stop", 1), "e2-medium")
+	assert.Error(t, err, "Recommendation not changing machine type can't be modified")
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"fmt"
+)
+
+// checkNotManaged returns the error wrapping ErrManagedInstance if the recommendation changes
+// the machine type of an instance created by a managed instance group, which would revert the change
+// when recreating the instance from its template.
+func checkNotManaged(ctx context.Context, service GoogleService, rec *gcloudRecommendation) error {
+	for _, group := range rec.Content.OperationGroups {
+		for _, operation := range group.Operations {
+			if operation.Action != "replace" || operation.Path != "/machineType" {
+				continue
+			}
+			project, zone, name, err := parseZonalResource(operation.Resource)
+			if err != nil {
+				return err
+			}
+			instance, err := service.GetInstance(ctx, project, zone, name)
+			if err != nil {
+				return err
+			}
+			if group := instanceGroup(instance); group != "" {
+				return fmt.Errorf("%w: instance %s is managed by %s, change the machine type in its instance template instead",
+					ErrManagedInstance, name, group)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestApplyManagedInstance(t *testing.T) {
+	group := "projects/123/zones/us-east1-b/instanceGroupManagers/web"
+	service := newMockApplyService()
+	service.instance.Metadata = &compute.Metadata{Items: []*compute.MetadataItems{{Key: createdByMetadataKey, Value: &group}}}
+
+	_, err := Apply(context.Background(), service, machineTypeRecommendation())
+	if assert.True(t, errors.Is(err, ErrManagedInstance), "Machine type of a managed instance shouldn't be changed") {
+		assert.Contains(t, err.Error(), group, "Error should name the owning group")
+	}
+	assert.Empty(t, service.calls)
+	assert.Empty(t, service.marks, "Recommendation shouldn't be claimed")
+
+	applicability, err := CheckApplicability(context.Background(), service, machineTypeRecommendation())
+	if assert.NoError(t, err) {
+		assert.False(t, applicability.Applicable())
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// MultiProjectService lists and applies recommendations across a set of projects,
+// isolating errors of each project, see NewMultiProjectService.
+type MultiProjectService struct {
+	service            GoogleService
+	projects           []string
+	numConcurrentCalls int
+}
+
+// NewMultiProjectService creates new MultiProjectService for projects, identified by their IDs,
+// using service to call the APIs. numConcurrentCalls is passed to ListRecommendations for each project.
+func NewMultiProjectService(service GoogleService, projects []string, numConcurrentCalls int) *MultiProjectService {
+	return &MultiProjectService{service: service, projects: projects, numConcurrentCalls: numConcurrentCalls}
+}
+
+// ProjectListResult is the result of listing recommendations of one project of MultiProjectService.
+// At most one of Recommendations and Err is non-nil.
+type ProjectListResult struct {
+	Project         string                  `json:"project"`
+	Recommendations []*gcloudRecommendation `json:"recommendations"`
+	Err             error                   `json:"-"`
+}
+
+// numConcurrentProjects is the maximum number of projects listed concurrently by MultiProjectService.
+const numConcurrentProjects = 8
+
+// ListRecommendations lists recommendations of all projects concurrently, at most numConcurrentProjects at a time.
+// Failure of one project doesn't stop the others, results are in the order of projects.
+// task structure tracks how many projects have been processed already.
+func (m *MultiProjectService) ListRecommendations(ctx context.Context, task *Task) []*ProjectListResult {
+	task.SetNumberOfSubtasks(len(m.projects))
+	subtasks := make([]*Task, len(m.projects))
+	for i := range m.projects {
+		subtasks[i] = task.GetNextSubtask()
+	}
+
+	results := make([]*ProjectListResult, len(m.projects))
+	indices := make(chan int, len(m.projects))
+	done := make(chan struct{}, len(m.projects))
+	for i := 0; i < numConcurrentProjects; i++ {
+		go func() {
+			for index := range indices {
+				project := m.projects[index]
+				recs, err := ListRecommendations(ctx, m.service, project, m.numConcurrentCalls, subtasks[index])
+				results[index] = &ProjectListResult{Project: project, Recommendations: recs, Err: err}
+				task.IncrementDone()
+				done <- struct{}{}
+			}
+		}()
+	}
+
+	for i := range m.projects {
+		indices <- i
+	}
+	close(indices)
+	for range m.projects {
+		<-done
+	}
+	task.SetAllDone()
+	return results
+}
+
+// ProjectApplyResult contains results of applying recommendations of one project of MultiProjectService.
+// Succeeded and Failed count the results.
+type ProjectApplyResult struct {
+	Project   string         `json:"project"`
+	Results   []*ApplyResult `json:"results"`
+	Succeeded int            `json:"succeeded"`
+	Failed    int            `json:"failed"`
+}
+
+var resourceProjectRegexp = regexp.MustCompile("^//[^/]+/projects/([^/]+)(/|$)")
+
+// recommendationProject returns the ID of the project of resources the recommendation modifies,
+// the name of the recommendation usually contains the project number instead.
+func recommendationProject(rec *gcloudRecommendation) (string, error) {
+	for _, group := range rec.Content.OperationGroups {
+		for _, operation := range group.Operations {
+			if match := resourceProjectRegexp.FindStringSubmatch(operation.Resource); match != nil {
+				return match[1], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("recommendation %s doesn't modify resources of any project", rec.Name)
+}
+
+// ApplyAll applies the recommendations of all projects concurrently, as ApplyAll with options does.
+// Recommendations are matched to projects by resources they modify. Results are grouped per project
+// in the order of projects, within a project in the order of recs. Recommendations of projects outside
+// of the set are not applied, their failed results are in the additional last result with empty Project.
+// task structure tracks how many recommendations have been processed already.
+func (m *MultiProjectService) ApplyAll(ctx context.Context, recs []*gcloudRecommendation, task *Task, options ...ApplyOption) []*ProjectApplyResult {
+	byProject := make(map[string]*ProjectApplyResult)
+	var results []*ProjectApplyResult
+	for _, project := range m.projects {
+		result := &ProjectApplyResult{Project: project}
+		byProject[project] = result
+		results = append(results, result)
+	}
+
+	var applied []*gcloudRecommendation
+	var appliedProjects []string
+	var notApplied []*ApplyResult
+	for _, rec := range recs {
+		project, err := recommendationProject(rec)
+		if err == nil && byProject[project] == nil {
+			err = fmt.Errorf("project %s of recommendation %s is not in the project set", project, rec.Name)
+		}
+		if err != nil {
+			notApplied = append(notApplied, newApplyResult(rec, nil, err))
+			continue
+		}
+		applied = append(applied, rec)
+		appliedProjects = append(appliedProjects, project)
+	}
+
+	for i, result := range ApplyAll(ctx, m.service, applied, task, options...) {
+		byProject[appliedProjects[i]].Results = append(byProject[appliedProjects[i]].Results, result)
+	}
+	if len(notApplied) != 0 {
+		results = append(results, &ProjectApplyResult{Results: notApplied})
+	}
+	for _, result := range results {
+		for _, applyResult := range result.Results {
+			if applyResult.Err == nil {
+				result.Succeeded++
+			} else {
+				result.Failed++
+			}
+		}
+	}
+	return results
+}
@@ -0,0 +1,122 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mockMultiProjectService is mockApplyService listing one recommendation per location, failing for the project "broken".
+type mockMultiProjectService struct {
+	*mockApplyService
+}
+
+func (s *mockMultiProjectService) ListZonesNames(ctx context.Context, project string) ([]string, error) {
+	if project == "broken" {
+		return nil, errors.New("permission denied")
+	}
+	return []string{"us-east1-b"}, nil
+}
+
+func (s *mockMultiProjectService) ListRegionsNames(ctx context.Context, project string) ([]string, error) {
+	return nil, nil
+}
+
+func (s *mockMultiProjectService) ListRecommendations(ctx context.Context, project, location, recommenderID string) ([]*gcloudRecommendation, error) {
+	return []*gcloudRecommendation{{Name: "projects/" + project + "/locations/" + location + "/recommenders/" + recommenderID + "/recommendations/r"}}, nil
+}
+
+func TestMultiProjectListRecommendations(t *testing.T) {
+	service := NewMultiProjectService(&mockMultiProjectService{newMockApplyService()}, []string{"a", "broken", "b"}, 1)
+	task := &Task{}
+	results := service.ListRecommendations(context.Background(), task)
+	if assert.Equal(t, 3, len(results)) {
+		assert.Equal(t, "a", results[0].Project)
+		numListed := len(googleRecommenders) - len(regionalRecommenders)
+		assert.Equal(t, numListed, len(results[0].Recommendations))
+		assert.EqualError(t, results[1].Err, "permission denied", "Error of one project should be isolated")
+		assert.Equal(t, numListed, len(results[2].Recommendations))
+	}
+	assert.Equal(t, len(task.subtasks), task.subtasksDone, "All subtasks should be done")
+}
+
+// mockSlowProjectsService is mockMultiProjectService counting projects listed concurrently.
+type mockSlowProjectsService struct {
+	*mockMultiProjectService
+	mutex     sync.Mutex
+	active    int
+	maxActive int
+}
+
+func (s *mockSlowProjectsService) ListZonesNames(ctx context.Context, project string) ([]string, error) {
+	s.mutex.Lock()
+	s.active++
+	if s.active > s.maxActive {
+		s.maxActive = s.active
+	}
+	s.mutex.Unlock()
+
+	time.Sleep(5 * time.Millisecond)
+
+	s.mutex.Lock()
+	s.active--
+	s.mutex.Unlock()
+	return s.mockMultiProjectService.ListZonesNames(ctx, project)
+}
+
+func TestMultiProjectListRecommendationsConcurrently(t *testing.T) {
+	var projects []string
+	for i := 0; i < 3*numConcurrentProjects; i++ {
+		projects = append(projects, fmt.Sprintf("project-%d", i))
+	}
+	mock := &mockSlowProjectsService{mockMultiProjectService: &mockMultiProjectService{newMockApplyService()}}
+	results := NewMultiProjectService(mock, projects, 1).ListRecommendations(context.Background(), &Task{})
+	if assert.Equal(t, len(projects), len(results)) {
+		for i, result := range results {
+			assert.Equal(t, projects[i], result.Project, "Results should be in the order of projects")
+			assert.NoError(t, result.Err)
+		}
+	}
+	assert.True(t, mock.maxActive > 1, "Projects should be listed concurrently")
+	assert.True(t, mock.maxActive <= numConcurrentProjects, "At most %d projects should be listed concurrently", numConcurrentProjects)
+}
+
+func TestMultiProjectApplyAll(t *testing.T) {
+	service := newMockApplyService()
+	other := machineTypeRecommendation()
+	other.Name += "-other"
+	for _, operation := range other.Content.OperationGroups[0].Operations {
+		operation.Resource = "//compute.googleapis.com/projects/other/zones/us-east1-b/instances/alicja-test"
+	}
+	multi := NewMultiProjectService(service, []string{"rightsizer-test", "empty"}, 0)
+	results := multi.ApplyAll(context.Background(), []*gcloudRecommendation{machineTypeRecommendation(), other}, &Task{}, WithParallelism(1))
+	if assert.Equal(t, 3, len(results)) {
+		assert.Equal(t, "rightsizer-test", results[0].Project)
+		assert.Equal(t, 1, results[0].Succeeded)
+		assert.Equal(t, &ProjectApplyResult{Project: "empty"}, results[1])
+		assert.Equal(t, "", results[2].Project, "Recommendations outside of the set should be reported separately")
+		assert.Equal(t, 1, results[2].Failed)
+	}
+	assert.Equal(t, []string{"CLAIMED", "SUCCEEDED"}, service.marks, "Only recommendations of the set should be applied")
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// defaultOperationTimeout is the time googleService waits for zone operations if WithOperationTimeout is not used.
+const defaultOperationTimeout = 10 * time.Minute
+
+// OperationError is returned when the compute operation has finished with errors.
+type OperationError struct {
+	Operation string
+	Errors    []*compute.OperationErrorErrors
+}
+
+func (e *OperationError) Error() string {
+	var messages []string
+	for _, item := range e.Errors {
+		messages = append(messages, fmt.Sprintf("%s: %s", item.Code, item.Message))
+	}
+	return fmt.Sprintf("operation %s failed: %s", e.Operation, strings.Join(messages, "; "))
+}
+
+// waitForOperation waits until the zone operation is done, using zoneOperations.wait method,
+// or the global operation if zone is empty, using globalOperations.wait method.
+// Returns OperationError if the operation failed, or an error wrapping the context error
+// if it wasn't done before the operation timeout.
+func (s *googleService) waitForOperation(ctx context.Context, project, zone string, operation *compute.Operation) error {
+	return s.waitUntilDone(ctx, operation, func(ctx context.Context) (*compute.Operation, error) {
+		if zone == "" {
+			return compute.NewGlobalOperationsService(s.computeService).Wait(project, operation.Name).Context(ctx).Do()
+		}
+		return compute.NewZoneOperationsService(s.computeService).Wait(project, zone, operation.Name).Context(ctx).Do()
+	})
+}
+
+// waitForRegionOperation waits until the region operation is done, using regionOperations.wait method.
+// Errors are returned like by waitForOperation.
+func (s *googleService) waitForRegionOperation(ctx context.Context, project, region string, operation *compute.Operation) error {
+	return s.waitUntilDone(ctx, operation, func(ctx context.Context) (*compute.Operation, error) {
+		return compute.NewRegionOperationsService(s.computeService).Wait(project, region, operation.Name).Context(ctx).Do()
+	})
+}
+
+// waitUntilDone calls wait until the operation is done or the operation timeout passes.
+func (s *googleService) waitUntilDone(ctx context.Context, operation *compute.Operation, wait func(ctx context.Context) (*compute.Operation, error)) error {
+	timeout := s.operationTimeout
+	if timeout <= 0 {
+		timeout = defaultOperationTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for operation.Status != "DONE" {
+		current, err := wait(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("waiting for operation %s: %w", operation.Name, ctx.Err())
+			}
+			return err
+		}
+		operation = current
+	}
+	if operation.Error != nil && len(operation.Error.Errors) != 0 {
+		return &OperationError{Operation: operation.Name, Errors: operation.Error.Errors}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+// newOperationsServer returns the server of Compute API whose operations are done after waiting for them waits times.
+// Done operations fail with operationError, if it is not empty.
+func newOperationsServer(waits int, operationError string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if !strings.HasSuffix(r.URL.Path, "/wait") {
+			fmt.Fprint(w, `{"name": "operation-1", "status": "PENDING"}`)
+			return
+		}
+		waits--
+		switch {
+		case waits > 0:
+			fmt.Fprint(w, `{"name": "operation-1", "status": "RUNNING"}`)
+		case operationError != "":
+			fmt.Fprintf(w, `{"name": "operation-1", "status": "DONE", "error": {"errors": [{"code": "QUOTA_EXCEEDED", "message": "%s"}]}}`, operationError)
+		default:
+			fmt.Fprint(w, `{"name": "operation-1", "status": "DONE"}`)
+		}
+	}))
+}
+
+func TestWaitForOperation(t *testing.T) {
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	server := newOperationsServer(3, "")
+	defer server.Close()
+	service, err := NewGoogleServiceFromTokenSource(context.Background(), tokenSource,
+		WithEndpoint(computeAPI, server.URL+"/compute/v1/projects/"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = service.StopInstance(context.Background(), "project", "zone", "instance")
+	assert.NoError(t, err, "Call should succeed after the operation is done")
+
+	failingServer := newOperationsServer(1, "CPUS quota exceeded")
+	defer failingServer.Close()
+	service, err = NewGoogleServiceFromTokenSource(context.Background(), tokenSource,
+		WithEndpoint(computeAPI, failingServer.URL+"/compute/v1/projects/"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = service.ChangeMachineType(context.Background(), "project", "zone", "instance", "n1-standard-1")
+	var operationErr *OperationError
+	if assert.True(t, errors.As(err, &operationErr), "Errors of the operation should be returned") {
+		assert.Equal(t, "operation operation-1 failed: QUOTA_EXCEEDED: CPUS quota exceeded", operationErr.Error())
+	}
+}
+
+func TestWaitForOperationTimeout(t *testing.T) {
+	server := newOperationsServer(1000000, "")
+	defer server.Close()
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	service, err := NewGoogleServiceFromTokenSource(context.Background(), tokenSource,
+		WithEndpoint(computeAPI, server.URL+"/compute/v1/projects/"), WithOperationTimeout(50*time.Millisecond))
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = service.DeleteDisk(context.Background(), "project", "zone", "disk")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "Waiting should stop after the timeout")
+}
+
+func TestWaitForGlobalOperation(t *testing.T) {
+	server := newOperationsServer(2, "")
+	defer server.Close()
+	var paths []string
+	recorder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer recorder.Close()
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	service, err := NewGoogleServiceFromTokenSource(context.Background(), tokenSource,
+		WithEndpoint(computeAPI, recorder.URL+"/compute/v1/projects/"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = service.DeleteSnapshot(context.Background(), "project", "snapshot")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"/compute/v1/projects/project/global/snapshots/snapshot",
+		"/compute/v1/projects/project/global/operations/operation-1/wait",
+		"/compute/v1/projects/project/global/operations/operation-1/wait",
+	}, paths)
+}
+
+func TestWaitForRegionOperation(t *testing.T) {
+	server := newOperationsServer(1, "")
+	defer server.Close()
+	var paths []string
+	recorder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		server.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer recorder.Close()
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	service, err := NewGoogleServiceFromTokenSource(context.Background(), tokenSource,
+		WithEndpoint(computeAPI, recorder.URL+"/compute/v1/projects/"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	err = service.DeleteRegionalDisk(context.Background(), "project", "region", "disk")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		"/compute/v1/projects/project/regions/region/disks/disk",
+		"/compute/v1/projects/project/regions/region/operations/operation-1/wait",
+	}, paths)
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+)
+
+const (
+	// PrivateGoogleAPIsVIP is the host of the virtual IP for Private Google Access
+	PrivateGoogleAPIsVIP = "private.googleapis.com"
+	// RestrictedGoogleAPIsVIP is the host of the virtual IP for VPC Service Controls
+	RestrictedGoogleAPIsVIP = "restricted.googleapis.com"
+)
+
+const googleAPIsDomain = ".googleapis.com"
+
+// Version is the version of recomator reported in User-Agent of API calls.
+const Version = "0.1.0"
+
+// serviceConfig contains the configuration of the clients used by googleService.
+type serviceConfig struct {
+	proxy     *url.URL
+	vipHost   string
+	endpoints map[string]string // the key is the API name, e.g. "compute.googleapis.com"
+
+	operationTimeout time.Duration
+	userAgentSuffix  string
+}
+
+// ServiceOption configures googleService created by NewGoogleService and similar functions.
+type ServiceOption func(*serviceConfig)
+
+// WithProxy makes all API calls, including token refreshes, go through the proxy.
+// Without this option the proxy is taken from HTTPS_PROXY and NO_PROXY environment variables.
+func WithProxy(proxy *url.URL) ServiceOption {
+	return func(c *serviceConfig) {
+		c.proxy = proxy
+	}
+}
+
+// WithGoogleAPIsVIP makes all connections to *.googleapis.com hosts go to vipHost instead,
+// e.g. PrivateGoogleAPIsVIP or RestrictedGoogleAPIsVIP, for networks where DNS is not
+// configured to resolve googleapis.com to these virtual IPs.
+// Requests keep the original host names, so TLS certificates are verified as usual.
+// Connections going through a proxy are not affected, the proxy resolves the hosts itself.
+func WithGoogleAPIsVIP(vipHost string) ServiceOption {
+	return func(c *serviceConfig) {
+		c.vipHost = vipHost
+	}
+}
+
+// WithEndpoint overrides the base URL of the API, e.g. "compute.googleapis.com",
+// for using emulators, fake servers in tests and region-restricted endpoints.
+// The endpoint must include the path, e.g. "http://localhost:8080/compute/v1/".
+func WithEndpoint(api, endpoint string) ServiceOption {
+	return func(c *serviceConfig) {
+		c.endpoints[api] = endpoint
+	}
+}
+
+// WithOperationTimeout sets how long methods modifying compute resources wait for their operations to finish.
+// Non-positive values are ignored, instead the default of 10 minutes is used.
+func WithOperationTimeout(timeout time.Duration) ServiceOption {
+	return func(c *serviceConfig) {
+		c.operationTimeout = timeout
+	}
+}
+
+// WithUserAgentSuffix appends suffix, e.g. the name of the organization, to User-Agent
+// sent on all API calls, which starts with recomator and its version.
+func WithUserAgentSuffix(suffix string) ServiceOption {
+	return func(c *serviceConfig) {
+		c.userAgentSuffix = suffix
+	}
+}
+
+func newServiceConfig(options []ServiceOption) *serviceConfig {
+	config := &serviceConfig{endpoints: make(map[string]string)}
+	for _, option := range options {
+		option(config)
+	}
+	return config
+}
+
+// clientOptions returns options for creating the client of the API.
+func (c *serviceConfig) clientOptions(api string, client *http.Client) []option.ClientOption {
+	options := []option.ClientOption{option.WithHTTPClient(client)}
+	if endpoint, ok := c.endpoints[api]; ok {
+		options = append(options, option.WithEndpoint(endpoint))
+	}
+	return options
+}
+
+// checkEndpoints returns error if some of overridden endpoints doesn't belong to any of apis.
+func (c *serviceConfig) checkEndpoints(apis []string) error {
+	for api := range c.endpoints {
+		known := false
+		for _, knownAPI := range apis {
+			known = known || api == knownAPI
+		}
+		if !known {
+			return fmt.Errorf("endpoint can't be overridden for unknown API %s", api)
+		}
+	}
+	return nil
+}
+
+// dialAddress returns the address to connect to instead of addr.
+func (c *serviceConfig) dialAddress(addr string) string {
+	if c.vipHost == "" {
+		return addr
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || !strings.HasSuffix(host, googleAPIsDomain) {
+		return addr
+	}
+	return net.JoinHostPort(c.vipHost, port)
+}
+
+// transport returns the http transport using the configured proxy and virtual IP.
+func (c *serviceConfig) transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if c.proxy != nil {
+		transport.Proxy = http.ProxyURL(c.proxy)
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second} // same as in http.DefaultTransport
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, c.dialAddress(addr))
+	}
+	return transport
+}
+
+// userAgent returns User-Agent of the calls: recomator, its version, used features and the suffix,
+// e.g. "recomator/0.1.0 (proxy; vip) example-org".
+func (c *serviceConfig) userAgent() string {
+	var features []string
+	if c.proxy != nil {
+		features = append(features, "proxy")
+	}
+	if c.vipHost != "" {
+		features = append(features, "vip")
+	}
+	if len(c.endpoints) != 0 {
+		features = append(features, "endpoints")
+	}
+	userAgent := "recomator/" + Version
+	if len(features) != 0 {
+		userAgent += " (" + strings.Join(features, "; ") + ")"
+	}
+	if c.userAgentSuffix != "" {
+		userAgent += " " + c.userAgentSuffix
+	}
+	return userAgent
+}
+
+// userAgentTransport prefixes User-Agent of the requests with userAgent.
+type userAgentTransport struct {
+	userAgent string
+	base      http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	userAgent := t.userAgent
+	if current := req.Header.Get("User-Agent"); current != "" {
+		userAgent += " " + current
+	}
+	req.Header.Set("User-Agent", userAgent)
+	return t.base.RoundTrip(req)
+}
+
+// withHTTPClient returns the context making oauth2 package use the configured transport,
+// both for API calls and for token refreshes. The calls carry the configured User-Agent
+// and correlation IDs of request contexts.
+func (c *serviceConfig) withHTTPClient(ctx context.Context) context.Context {
+	transport := &userAgentTransport{userAgent: c.userAgent(), base: &correlationTransport{base: c.transport()}}
+	return context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Transport: transport})
+}
@@ -0,0 +1,52 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialAddress(t *testing.T) {
+	config := newServiceConfig(nil)
+	assert.Equal(t, "compute.googleapis.com:443", config.dialAddress("compute.googleapis.com:443"), "Address should not change without VIP")
+
+	config = newServiceConfig([]ServiceOption{WithGoogleAPIsVIP(RestrictedGoogleAPIsVIP)})
+	assert.Equal(t, "restricted.googleapis.com:443", config.dialAddress("compute.googleapis.com:443"))
+	assert.Equal(t, "restricted.googleapis.com:443", config.dialAddress("oauth2.googleapis.com:443"), "Token refreshes should use VIP too")
+	assert.Equal(t, "example.com:443", config.dialAddress("example.com:443"), "Only googleapis.com hosts should use VIP")
+	assert.Equal(t, "malformed", config.dialAddress("malformed"))
+}
+
+func TestProxy(t *testing.T) {
+	proxy, _ := url.Parse("http://proxy.example.com:3128")
+	transport := newServiceConfig([]ServiceOption{WithProxy(proxy)}).transport()
+	request, _ := http.NewRequest("GET", "https://compute.googleapis.com/compute/v1/", nil)
+	actual, err := transport.Proxy(request)
+	if assert.NoError(t, err) {
+		assert.Equal(t, proxy, actual, "Configured proxy should be used")
+	}
+}
+
+func TestUserAgent(t *testing.T) {
+	assert.Equal(t, "recomator/"+Version, newServiceConfig(nil).userAgent())
+	config := newServiceConfig([]ServiceOption{WithGoogleAPIsVIP(PrivateGoogleAPIsVIP), WithUserAgentSuffix("example-org")})
+	assert.Equal(t, "recomator/"+Version+" (vip) example-org", config.userAgent())
+}
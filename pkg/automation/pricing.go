@@ -0,0 +1,248 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/cloudbilling/v1"
+	"google.golang.org/api/compute/v1"
+)
+
+const cloudBillingAPI = "cloudbilling.googleapis.com"
+
+// computeEngineService is the name of Compute Engine in Cloud Billing Catalog API
+const computeEngineService = "services/6F81-5844-456A"
+
+const hoursPerMonth = 730
+
+const (
+	// StandardDiskStorage is the storage type of standard persistent disks
+	StandardDiskStorage = "pd-standard"
+	// SSDDiskStorage is the storage type of SSD persistent disks
+	SSDDiskStorage = "pd-ssd"
+	// BalancedDiskStorage is the storage type of balanced persistent disks
+	BalancedDiskStorage = "pd-balanced"
+	// SnapshotStorage is the storage type of disk snapshots
+	SnapshotStorage = "snapshot"
+)
+
+// PriceCatalog is the interface for getting on-demand monthly prices of Compute Engine resources.
+// Implementations must be thread-safe.
+type PriceCatalog interface {
+	// returns prices of a vCPU and of a GB of memory of the machine type family in the region
+	MachineFamilyPrice(family, region string) (cpuPrice, memoryGbPrice float64, currencyCode string, err error)
+
+	// returns price of a GB of the storage type in the region, e.g. SnapshotStorage
+	StoragePrice(storageType, region string) (gbPrice float64, currencyCode string, err error)
+}
+
+// skuPrice is the monthly price of a unit of the resource.
+type skuPrice struct {
+	amount       float64
+	currencyCode string
+}
+
+// skuPriceCatalog implements PriceCatalog interface using SKUs from Cloud Billing Catalog API.
+type skuPriceCatalog struct {
+	listSkus func() ([]*cloudbilling.Sku, error)
+	ttl      time.Duration
+	prices   map[string]*skuPrice // the key is the region and the resource, e.g. "us-east1/n1/cpu"
+	loadedAt time.Time
+	mutex    sync.Mutex
+}
+
+// NewBillingPriceCatalog creates new PriceCatalog using Cloud Billing Catalog API.
+// All Compute Engine SKUs are downloaded on the first use and cached for ttl.
+// Requires cloud-billing.readonly or cloud-platform scope, no permissions are needed.
+// If creation failed the error will be non-nil.
+func NewBillingPriceCatalog(ctx context.Context, tokenSource oauth2.TokenSource, ttl time.Duration, options ...ServiceOption) (PriceCatalog, error) {
+	config := newServiceConfig(options)
+	err := config.checkEndpoints([]string{cloudBillingAPI})
+	if err != nil {
+		return nil, err
+	}
+	ctx = config.withHTTPClient(ctx)
+	billingService, err := cloudbilling.NewService(ctx, config.clientOptions(cloudBillingAPI, oauth2.NewClient(ctx, tokenSource))...)
+	if err != nil {
+		return nil, err
+	}
+
+	listSkus := func() ([]*cloudbilling.Sku, error) {
+		var skus []*cloudbilling.Sku
+		listCall := cloudbilling.NewServicesSkusService(billingService).List(computeEngineService)
+		err := listCall.Pages(ctx, func(response *cloudbilling.ListSkusResponse) error {
+			skus = append(skus, response.Skus...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return skus, nil
+	}
+	return &skuPriceCatalog{listSkus: listSkus, ttl: ttl}, nil
+}
+
+var coreRAMSkuRegexp = regexp.MustCompile(`^(\w+) (?:Predefined )?Instance (Core|Ram) running in `)
+
+// storageSkuPrefixes are prefixes of descriptions of storage SKUs
+var storageSkuPrefixes = map[string]string{
+	"Storage PD Capacity":    StandardDiskStorage,
+	"SSD backed PD Capacity": SSDDiskStorage,
+	"Balanced PD Capacity":   BalancedDiskStorage,
+	"Storage PD Snapshot":    SnapshotStorage,
+}
+
+// skuResource returns the resource priced by the SKU, e.g. "n1/cpu" or "pd-ssd".
+// If the SKU is not an on-demand price of a supported resource, ok is false.
+func skuResource(sku *cloudbilling.Sku) (resource string, ok bool) {
+	if sku.Category == nil || sku.Category.UsageType != "OnDemand" {
+		return "", false
+	}
+	switch sku.Category.ResourceFamily {
+	case "Compute":
+		match := coreRAMSkuRegexp.FindStringSubmatch(sku.Description)
+		if match == nil {
+			return "", false
+		}
+		if match[2] == "Core" {
+			return strings.ToLower(match[1]) + "/cpu", true
+		}
+		return strings.ToLower(match[1]) + "/memory", true
+	case "Storage":
+		for prefix, storageType := range storageSkuPrefixes {
+			if strings.HasPrefix(sku.Description, prefix) {
+				return storageType, true
+			}
+		}
+	}
+	return "", false
+}
+
+// monthlySkuPrice returns the current monthly price of a unit of the SKU, using its highest tier.
+func monthlySkuPrice(sku *cloudbilling.Sku) (*skuPrice, bool) {
+	if len(sku.PricingInfo) == 0 {
+		return nil, false
+	}
+	expression := sku.PricingInfo[len(sku.PricingInfo)-1].PricingExpression
+	if expression == nil || len(expression.TieredRates) == 0 {
+		return nil, false
+	}
+	unitPrice := expression.TieredRates[len(expression.TieredRates)-1].UnitPrice
+	if unitPrice == nil {
+		return nil, false
+	}
+	amount := float64(unitPrice.Units) + float64(unitPrice.Nanos)/1e9
+	if expression.UsageUnit == "h" || strings.HasSuffix(expression.UsageUnit, ".h") {
+		amount *= hoursPerMonth
+	}
+	return &skuPrice{amount: amount, currencyCode: unitPrice.CurrencyCode}, true
+}
+
+// load downloads the SKUs if they haven't been downloaded or ttl has passed.
+// Must be called with the mutex locked.
+func (c *skuPriceCatalog) load() error {
+	if c.prices != nil && time.Since(c.loadedAt) < c.ttl {
+		return nil
+	}
+	skus, err := c.listSkus()
+	if err != nil {
+		return err
+	}
+	prices := make(map[string]*skuPrice)
+	for _, sku := range skus {
+		resource, ok := skuResource(sku)
+		if !ok {
+			continue
+		}
+		price, ok := monthlySkuPrice(sku)
+		if !ok {
+			continue
+		}
+		for _, region := range sku.ServiceRegions {
+			prices[region+"/"+resource] = price
+		}
+	}
+	c.prices = prices
+	c.loadedAt = time.Now()
+	return nil
+}
+
+// price returns the price of the resource in the region.
+func (c *skuPriceCatalog) price(region, resource string) (*skuPrice, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	price, ok := c.prices[region+"/"+resource]
+	if !ok {
+		return nil, fmt.Errorf("price of %s in %s is unknown", resource, region)
+	}
+	return price, nil
+}
+
+func (c *skuPriceCatalog) MachineFamilyPrice(family, region string) (float64, float64, string, error) {
+	cpuPrice, err := c.price(region, family+"/cpu")
+	if err != nil {
+		return 0, 0, "", err
+	}
+	memoryPrice, err := c.price(region, family+"/memory")
+	if err != nil {
+		return 0, 0, "", err
+	}
+	return cpuPrice.amount, memoryPrice.amount, cpuPrice.currencyCode, nil
+}
+
+func (c *skuPriceCatalog) StoragePrice(storageType, region string) (float64, string, error) {
+	price, err := c.price(region, storageType)
+	if err != nil {
+		return 0, "", err
+	}
+	return price.amount, price.currencyCode, nil
+}
+
+// zoneRegion returns the region of the zone, e.g. "us-east1" for "us-east1-b".
+func zoneRegion(zone string) string {
+	index := strings.LastIndex(zone, "-")
+	if index < 0 {
+		return zone
+	}
+	return zone[:index]
+}
+
+// MachineTypePrice returns the monthly on-demand price of the machine type in the region,
+// without discounts and licenses. Shared-core machine types are not supported.
+// If the error occurred the returned error is not nil.
+func MachineTypePrice(catalog PriceCatalog, region string, machineType *compute.MachineType) (float64, string, error) {
+	if machineType.IsSharedCpu {
+		return 0, "", fmt.Errorf("pricing shared-core machine type %s is not supported", machineType.Name)
+	}
+	cpuPrice, memoryGbPrice, currencyCode, err := catalog.MachineFamilyPrice(machineTypeFamily(machineType.Name), region)
+	if err != nil {
+		return 0, "", err
+	}
+	price := float64(machineType.GuestCpus)*cpuPrice + float64(machineType.MemoryMb)/1024*memoryGbPrice
+	return price, currencyCode, nil
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/cloudbilling/v1"
+	"google.golang.org/api/compute/v1"
+)
+
+func makeSku(description, resourceFamily, usageUnit string, nanos int64, regions ...string) *cloudbilling.Sku {
+	return &cloudbilling.Sku{
+		Description:    description,
+		Category:       &cloudbilling.Category{ResourceFamily: resourceFamily, UsageType: "OnDemand"},
+		ServiceRegions: regions,
+		PricingInfo: []*cloudbilling.PricingInfo{&cloudbilling.PricingInfo{
+			PricingExpression: &cloudbilling.PricingExpression{
+				UsageUnit: usageUnit,
+				TieredRates: []*cloudbilling.TierRate{
+					&cloudbilling.TierRate{UnitPrice: &cloudbilling.Money{CurrencyCode: "USD"}},
+					&cloudbilling.TierRate{UnitPrice: &cloudbilling.Money{CurrencyCode: "USD", Nanos: nanos}},
+				},
+			},
+		}},
+	}
+}
+
+var testSkus = []*cloudbilling.Sku{
+	makeSku("N1 Predefined Instance Core running in Americas", "Compute", "h", 100000000, "us-east1", "us-west1"),
+	makeSku("N1 Predefined Instance Ram running in Americas", "Compute", "GiBy.h", 10000000, "us-east1", "us-west1"),
+	makeSku("N1 Custom Instance Core running in Americas", "Compute", "h", 200000000, "us-east1"),
+	makeSku("Storage PD Snapshot", "Storage", "GiBy.mo", 26000000, "us-east1"),
+	makeSku("Regional Storage PD Capacity", "Storage", "GiBy.mo", 80000000, "us-east1"),
+}
+
+func newTestCatalog(calls *int) *skuPriceCatalog {
+	return &skuPriceCatalog{
+		listSkus: func() ([]*cloudbilling.Sku, error) {
+			*calls++
+			return testSkus, nil
+		},
+		ttl: time.Hour,
+	}
+}
+
+func TestSkuPriceCatalog(t *testing.T) {
+	calls := 0
+	catalog := newTestCatalog(&calls)
+	cpuPrice, memoryGbPrice, currencyCode, err := catalog.MachineFamilyPrice("n1", "us-west1")
+	if assert.NoError(t, err) {
+		assert.InDelta(t, 73, cpuPrice, 1e-9, "Hourly prices should be converted to monthly")
+		assert.InDelta(t, 7.3, memoryGbPrice, 1e-9)
+		assert.Equal(t, "USD", currencyCode)
+	}
+	snapshotPrice, _, err := catalog.StoragePrice(SnapshotStorage, "us-east1")
+	if assert.NoError(t, err) {
+		assert.InDelta(t, 0.026, snapshotPrice, 1e-9, "Highest tier should be used")
+	}
+	_, _, err = catalog.StoragePrice(StandardDiskStorage, "us-east1")
+	assert.Error(t, err, "Regional disks are not zonal disks")
+	assert.Equal(t, 1, calls, "SKUs should be cached")
+
+	catalog.loadedAt = catalog.loadedAt.Add(-2 * time.Hour)
+	_, _, _, err = catalog.MachineFamilyPrice("n1", "us-east1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls, "SKUs should be reloaded after ttl")
+}
+
+func TestSkuPriceCatalogError(t *testing.T) {
+	catalog := &skuPriceCatalog{listSkus: func() ([]*cloudbilling.Sku, error) {
+		return nil, errors.New("billing API is disabled")
+	}}
+	_, _, err := catalog.StoragePrice(SnapshotStorage, "us-east1")
+	assert.Error(t, err)
+}
+
+func TestListPricedMachineTypeAlternatives(t *testing.T) {
+	calls := 0
+	service := &mockMachineTypesService{
+		instance:     &compute.Instance{MachineType: "zones/us-east1-b/machineTypes/n1-standard-4"},
+		machineTypes: testMachineTypes,
+	}
+	alternatives, err := ListPricedMachineTypeAlternatives(context.Background(), service, newTestCatalog(&calls), "p", "us-east1-b", "i")
+	if !assert.NoError(t, err) || !assert.Equal(t, 3, len(alternatives)) {
+		return
+	}
+	e2, n1 := alternatives[1], alternatives[2]
+	assert.Nil(t, e2.MonthlyPrice, "Shared-core machine types are not priced")
+	if assert.NotNil(t, n1.MonthlyPrice) && assert.NotNil(t, n1.MonthlyPriceDelta) {
+		assert.InDelta(t, 2*73+7.5*7.3, *n1.MonthlyPrice, 1e-9)
+		assert.InDelta(t, -2*73-7.5*7.3, *n1.MonthlyPriceDelta, 1e-9)
+		assert.Equal(t, "USD", n1.CurrencyCode)
+	}
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package automation
 
 import (
+	"sync"
 	"sync/atomic"
 	"testing"
 
@@ -123,12 +124,15 @@ func TestThreadsGetProgress(t *testing.T) {
 		for numSubtasks := 0; numSubtasks < 10; numSubtasks++ {
 			task := &Task{}
 			task.SetNumberOfSubtasks(numSubtasks)
+			var wg sync.WaitGroup
 			for i := 0; i < numGoroutines; i++ {
+				wg.Add(1)
 				go func() {
+					defer wg.Done()
 					var progress []float64
-					done, all := 0, 1
+					var done, all int32 = 0, 1
 					for done < all {
-						done, all := task.GetProgress()
+						done, all = task.GetProgress()
 						progress = append(progress, float64(done)/float64(all))
 					}
 					assert.IsNonDecreasing(t, progress, "Progress should not decrease")
@@ -137,6 +141,8 @@ func TestThreadsGetProgress(t *testing.T) {
 			for i := 0; i < numSubtasks; i++ {
 				task.IncrementDone()
 			}
+			task.SetAllDone()
+			wg.Wait()
 		}
 
 	}
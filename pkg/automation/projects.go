@@ -17,14 +17,16 @@ limitations under the License.
 package automation
 
 import (
+	"context"
+
 	"google.golang.org/api/cloudresourcemanager/v1"
 )
 
 // ListProjects lists the projects IDs for projects user has resourcemanager.projects.get permission
-func (s *googleService) ListProjects() ([]string, error) {
+func (s *googleService) ListProjects(ctx context.Context) ([]string, error) {
 	projectsService := cloudresourcemanager.NewProjectsService(s.resourceManagerService)
 	var projects []string
-	err := projectsService.List().Pages(s.ctx, func(r *cloudresourcemanager.ListProjectsResponse) error {
+	err := projectsService.List().Pages(ctx, func(r *cloudresourcemanager.ListProjectsResponse) error {
 		for _, project := range r.Projects {
 			projects = append(projects, project.ProjectId)
 		}
@@ -35,3 +37,20 @@ func (s *googleService) ListProjects() ([]string, error) {
 	}
 	return projects, nil
 }
+
+// GetProjectAncestry returns names of the project and its ancestors in the resource hierarchy,
+// starting from the project itself and ending with the organization, if the project has one.
+// For example, ["projects/my-project", "folders/123", "organizations/456"].
+// Uses projects.getAncestry method, requires resourcemanager.projects.get permission.
+func (s *googleService) GetProjectAncestry(ctx context.Context, project string) ([]string, error) {
+	projectsService := cloudresourcemanager.NewProjectsService(s.resourceManagerService)
+	response, err := projectsService.GetAncestry(project, &cloudresourcemanager.GetAncestryRequest{}).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	var ancestry []string
+	for _, ancestor := range response.Ancestor {
+		ancestry = append(ancestry, ancestor.ResourceId.Type+"s/"+ancestor.ResourceId.Id)
+	}
+	return ancestry, nil
+}
@@ -0,0 +1,118 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"sync"
+
+	"github.com/segmentio/ksuid"
+	"google.golang.org/api/recommender/v1"
+)
+
+const (
+	// ClaimedByMetadataKey is the key of the state metadata set by recomator when marking recommendations.
+	ClaimedByMetadataKey = "claimed-by"
+	// ClaimedByMetadataValue is the value of ClaimedByMetadataKey set by recomator.
+	ClaimedByMetadataValue = "recomator"
+	// ClaimTokenMetadataKey is the key of the state metadata with the token unique to the run of recomator.
+	ClaimTokenMetadataKey = "claim-token"
+)
+
+// claimToken is the token identifying recommendations marked by this run of recomator,
+// so that recommendations claimed by other instances of recomator are not applied.
+var claimToken = ksuid.New().String()
+
+// stateMetadata is the state metadata set when marking recommendations,
+// it allows recognizing recommendations claimed by this run of recomator.
+var stateMetadata = map[string]string{ClaimedByMetadataKey: ClaimedByMetadataValue, ClaimTokenMetadataKey: claimToken}
+
+// claims are etags of recommendations claimed by this run of recomator, by their names.
+var claims = struct {
+	sync.Mutex
+	etags map[string]string
+}{etags: make(map[string]string)}
+
+// recordClaim records the etag of the recommendation claimed by this run of recomator.
+func recordClaim(claimed *gcloudRecommendation) {
+	claims.Lock()
+	defer claims.Unlock()
+	claims.etags[claimed.Name] = claimed.Etag
+}
+
+// claimedByRecomator checks if the recommendation is claimed by this run of recomator,
+// or by the run that stored its checkpoint in checkpoints, e.g. before a crash, and hasn't changed since then.
+// checkpoints can be nil.
+func claimedByRecomator(rec *gcloudRecommendation, checkpoints CheckpointStore) bool {
+	claims.Lock()
+	etag := claims.etags[rec.Name]
+	claims.Unlock()
+	if claimedWith(rec, claimToken, etag) {
+		return true
+	}
+	if checkpoints == nil {
+		return false
+	}
+	checkpoint, ok := checkpoints.Load(rec.Name)
+	return ok && claimedWith(rec, checkpoint.ClaimToken, checkpoint.Etag)
+}
+
+// claimedWith checks if the recommendation is claimed by recomator with the token and has the etag of the claim.
+func claimedWith(rec *gcloudRecommendation, token, etag string) bool {
+	return rec.StateInfo != nil && rec.StateInfo.State == "CLAIMED" &&
+		rec.StateInfo.StateMetadata[ClaimedByMetadataKey] == ClaimedByMetadataValue &&
+		rec.StateInfo.StateMetadata[ClaimTokenMetadataKey] == token && etag != "" && rec.Etag == etag
+}
+
+// GetRecommendation gets the recommendation by its name
+// using projects.locations.recommenders.recommendations/get method from Recommender API.
+// At most one of returned values will be non-nil.
+func (s *googleService) GetRecommendation(ctx context.Context, name string) (*gcloudRecommendation, error) {
+	recommendationsService := recommender.NewProjectsLocationsRecommendersRecommendationsService(s.recommenderService)
+	return recommendationsService.Get(name).Context(ctx).Do()
+}
+
+// MarkRecommendationClaimed marks the recommendation as claimed, meaning it is being applied,
+// using projects.locations.recommenders.recommendations/markClaimed method from Recommender API.
+// etag must be the fingerprint of the current state of the recommendation.
+// The state metadata is set to recognize recommendations claimed by recomator.
+// Returns the updated recommendation, at most one of returned values will be non-nil.
+func (s *googleService) MarkRecommendationClaimed(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	recommendationsService := recommender.NewProjectsLocationsRecommendersRecommendationsService(s.recommenderService)
+	request := &recommender.GoogleCloudRecommenderV1MarkRecommendationClaimedRequest{Etag: etag, StateMetadata: stateMetadata}
+	return recommendationsService.MarkClaimed(name, request).Context(ctx).Do()
+}
+
+// MarkRecommendationFailed marks the recommendation as failed to be applied,
+// using projects.locations.recommenders.recommendations/markFailed method from Recommender API.
+// etag must be the fingerprint of the current state of the recommendation.
+// Returns the updated recommendation, at most one of returned values will be non-nil.
+func (s *googleService) MarkRecommendationFailed(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	recommendationsService := recommender.NewProjectsLocationsRecommendersRecommendationsService(s.recommenderService)
+	request := &recommender.GoogleCloudRecommenderV1MarkRecommendationFailedRequest{Etag: etag, StateMetadata: stateMetadata}
+	return recommendationsService.MarkFailed(name, request).Context(ctx).Do()
+}
+
+// MarkRecommendationSucceeded marks the recommendation as successfully applied,
+// using projects.locations.recommenders.recommendations/markSucceeded method from Recommender API.
+// etag must be the fingerprint of the current state of the recommendation.
+// Returns the updated recommendation, at most one of returned values will be non-nil.
+func (s *googleService) MarkRecommendationSucceeded(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	recommendationsService := recommender.NewProjectsLocationsRecommendersRecommendationsService(s.recommenderService)
+	request := &recommender.GoogleCloudRecommenderV1MarkRecommendationSucceededRequest{Etag: etag, StateMetadata: stateMetadata}
+	return recommendationsService.MarkSucceeded(name, request).Context(ctx).Do()
+}
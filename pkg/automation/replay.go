@@ -0,0 +1,92 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ReplayStep is the result of replaying one operation of the applied recommendation.
+// Difference describes how the current state differs from the state at the time of apply,
+// it is empty if no difference was found or the operation can't be checked, e.g. creating a snapshot.
+type ReplayStep struct {
+	Group       int    `json:"group"`
+	Index       int    `json:"index"`
+	Description string `json:"description"`
+	Difference  string `json:"difference"`
+}
+
+// Replay is the result of ReplayRecommendation.
+type Replay struct {
+	Recommendation string        `json:"recommendation"`
+	Steps          []*ReplayStep `json:"steps"`
+}
+
+// Differences returns differences found by all steps, in order.
+func (r *Replay) Differences() []string {
+	var result []string
+	for _, step := range r.Steps {
+		if step.Difference != "" {
+			result = append(result, step.Difference)
+		}
+	}
+	return result
+}
+
+// ReplayRecommendation re-executes read-only parts of the applied recommendation against the current state
+// of resources, without modifying them. Test operations, which passed at the time of apply, are checked again
+// against values from before apply, so the test of a modified value reports the expected difference.
+// Modifying operations are checked like in VerifyApplied, with options the recommendation was applied with.
+// It is meant for debugging recommendations that were applied successfully, but whose resources look wrong.
+// At most one of returned values will be non-nil.
+func ReplayRecommendation(ctx context.Context, service GoogleService, rec *gcloudRecommendation, options ...ApplyOption) (*Replay, error) {
+	calls, err := finalCalls(rec, newApplyConfig(options))
+	if err != nil {
+		return nil, err
+	}
+	replay := &Replay{Recommendation: rec.Name}
+	for i, group := range rec.Content.OperationGroups {
+		for j, operation := range group.Operations {
+			progress := &OperationProgress{Recommendation: rec.Name, Group: i, Index: j, Operation: operation}
+			step := &ReplayStep{Group: i, Index: j, Description: progress.Description()}
+			switch operation.Action {
+			case "test":
+				err := testOperation(ctx, service, operation)
+				var testErr *ErrTestFailed
+				if errors.As(err, &testErr) {
+					step.Difference = fmt.Sprintf("%s of %s was %s at apply, now %s", testErr.Path, testErr.Resource, testErr.Want, testErr.Got)
+				} else if err != nil {
+					return nil, err
+				}
+			default:
+				call, ok := calls[operation]
+				if !ok {
+					break
+				}
+				regression, err := verifyCall(ctx, service, call)
+				if err != nil {
+					return nil, err
+				}
+				step.Difference = regression
+			}
+			replay.Steps = append(replay.Steps, step)
+		}
+	}
+	return replay, nil
+}
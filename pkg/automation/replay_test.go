@@ -0,0 +1,47 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/compute/v1"
+)
+
+func TestReplayRecommendation(t *testing.T) {
+	service := &mockVerificationService{
+		instance: &compute.Instance{MachineType: "zones/us-east1-b/machineTypes/custom-2-5120", Status: "RUNNING"},
+	}
+	replay, err := ReplayRecommendation(context.Background(), service, machineTypeRecommendation())
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, len(replay.Steps))
+		assert.Equal(t, "changing machine type of instance alicja-test", replay.Steps[1].Description)
+		assert.Equal(t, []string{
+			"/machineType of " + applyInstance + " was pattern .*zones/us-east1-b/machineTypes/n1-standard-4 at apply, now zones/us-east1-b/machineTypes/custom-2-5120",
+		}, replay.Differences(), "Only tested values should differ after successful apply")
+	}
+
+	service.instance = &compute.Instance{MachineType: "zones/us-east1-b/machineTypes/n1-standard-4", Status: "RUNNING"}
+	replay, err = ReplayRecommendation(context.Background(), service, machineTypeRecommendation())
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{
+			"instance alicja-test has machine type n1-standard-4 instead of custom-2-5120",
+		}, replay.Differences())
+	}
+}
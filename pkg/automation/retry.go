@@ -0,0 +1,420 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/sqladmin/v1beta4"
+)
+
+// RetryConfig configures retries of calls failed with transient errors.
+// Backoff before the n-th retry is random between 0 and min(MaxBackoff, InitialBackoff * 2^n).
+type RetryConfig struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+// DefaultRetryConfig returns the configuration used if nil is passed to NewRetryingService.
+func DefaultRetryConfig() *RetryConfig {
+	return &RetryConfig{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: 30 * time.Second}
+}
+
+// reasons of googleapi errors that are retried regardless of the status code
+var retryableReasons = []string{"rateLimitExceeded", "userRateLimitExceeded", "backendError"}
+
+// IsRetryable returns whether the call failed with err may succeed if retried:
+// the quota was exceeded (status 429 or rate limit reasons) or the server failed (status 5xx).
+// err can wrap the googleapi error.
+func IsRetryable(err error) bool {
+	var googleErr *googleapi.Error
+	if !errors.As(err, &googleErr) {
+		return false
+	}
+	if googleErr.Code == http.StatusTooManyRequests || googleErr.Code >= http.StatusInternalServerError {
+		return true
+	}
+	for _, item := range googleErr.Errors {
+		for _, reason := range retryableReasons {
+			if item.Reason == reason {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// backoff returns the random duration to wait before the retry after attempt failed attempts.
+func (c *RetryConfig) backoff(attempt int) time.Duration {
+	limit := c.InitialBackoff << uint(attempt-1)
+	if limit > c.MaxBackoff || limit <= 0 {
+		limit = c.MaxBackoff
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit)))
+}
+
+// retry calls f until it succeeds, fails with an error that is not retryable,
+// MaxAttempts attempts are made or ctx is done. Returns the last error.
+func (c *RetryConfig) retry(ctx context.Context, f func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = f()
+		if err == nil || !IsRetryable(err) || attempt >= c.MaxAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(c.backoff(attempt)):
+		}
+	}
+}
+
+// retryingService implements GoogleService interface retrying calls of the wrapped service.
+type retryingService struct {
+	service GoogleService
+	config  *RetryConfig
+}
+
+// NewRetryingService creates new GoogleService retrying calls of service
+// that fail with transient errors, see IsRetryable, with exponential backoff and jitter.
+// If config is nil, DefaultRetryConfig is used.
+// Calls modifying resources are retried too. They are safe to repeat, but a retry may
+// fail with an error like "not found" if the first attempt succeeded and only the response was lost.
+func NewRetryingService(service GoogleService, config *RetryConfig) GoogleService {
+	if config == nil {
+		config = DefaultRetryConfig()
+	}
+	return &retryingService{service: service, config: config}
+}
+
+func (s *retryingService) ChangeMachineType(ctx context.Context, project, zone, instance, machineType string) error {
+	return s.config.retry(ctx, func() error {
+		return s.service.ChangeMachineType(ctx, project, zone, instance, machineType)
+	})
+}
+
+func (s *retryingService) ChangeSQLInstanceTier(ctx context.Context, project, instance, tier string) error {
+	return s.config.retry(ctx, func() error {
+		return s.service.ChangeSQLInstanceTier(ctx, project, instance, tier)
+	})
+}
+
+func (s *retryingService) CreateRegionalSnapshot(ctx context.Context, project, region, disk, name string) error {
+	return s.config.retry(ctx, func() error {
+		return s.service.CreateRegionalSnapshot(ctx, project, region, disk, name)
+	})
+}
+
+func (s *retryingService) CreateSnapshot(ctx context.Context, project, zone, disk, name string) error {
+	return s.config.retry(ctx, func() error {
+		return s.service.CreateSnapshot(ctx, project, zone, disk, name)
+	})
+}
+
+func (s *retryingService) DeleteDisk(ctx context.Context, project, zone, disk string) error {
+	return s.config.retry(ctx, func() error {
+		return s.service.DeleteDisk(ctx, project, zone, disk)
+	})
+}
+
+func (s *retryingService) DeleteImage(ctx context.Context, project, image string) error {
+	return s.config.retry(ctx, func() error {
+		return s.service.DeleteImage(ctx, project, image)
+	})
+}
+
+func (s *retryingService) DeleteInstance(ctx context.Context, project, zone, instance string) error {
+	return s.config.retry(ctx, func() error {
+		return s.service.DeleteInstance(ctx, project, zone, instance)
+	})
+}
+
+func (s *retryingService) DeleteProject(ctx context.Context, project string) error {
+	return s.config.retry(ctx, func() error {
+		return s.service.DeleteProject(ctx, project)
+	})
+}
+
+func (s *retryingService) DeleteRegionalDisk(ctx context.Context, project, region, disk string) error {
+	return s.config.retry(ctx, func() error {
+		return s.service.DeleteRegionalDisk(ctx, project, region, disk)
+	})
+}
+
+func (s *retryingService) DeleteSnapshot(ctx context.Context, project, snapshot string) error {
+	return s.config.retry(ctx, func() error {
+		return s.service.DeleteSnapshot(ctx, project, snapshot)
+	})
+}
+
+func (s *retryingService) GetDisk(ctx context.Context, project, zone, disk string) (*compute.Disk, error) {
+	var result *compute.Disk
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.GetDisk(ctx, project, zone, disk)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) GetImage(ctx context.Context, project, image string) (*compute.Image, error) {
+	var result *compute.Image
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.GetImage(ctx, project, image)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) GetInstance(ctx context.Context, project, zone, instance string) (*compute.Instance, error) {
+	var result *compute.Instance
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.GetInstance(ctx, project, zone, instance)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) GetRegionalDisk(ctx context.Context, project, region, disk string) (*compute.Disk, error) {
+	var result *compute.Disk
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.GetRegionalDisk(ctx, project, region, disk)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) GetSQLInstance(ctx context.Context, project, instance string) (*sqladmin.DatabaseInstance, error) {
+	var result *sqladmin.DatabaseInstance
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.GetSQLInstance(ctx, project, instance)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) GetProjectIAMPolicy(ctx context.Context, project string) (*cloudresourcemanager.Policy, error) {
+	var result *cloudresourcemanager.Policy
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.GetProjectIAMPolicy(ctx, project)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	var result []string
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.GetRolePermissions(ctx, role)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) GetRecommendation(ctx context.Context, name string) (*gcloudRecommendation, error) {
+	var result *gcloudRecommendation
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.GetRecommendation(ctx, name)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) GetProjectAncestry(ctx context.Context, project string) ([]string, error) {
+	var result []string
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.GetProjectAncestry(ctx, project)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) ListAPIRequirements(ctx context.Context, project string, apis []string) ([]*Requirement, error) {
+	var result []*Requirement
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.ListAPIRequirements(ctx, project, apis)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) ListPermissionRequirements(ctx context.Context, project string, permissions [][]string) ([]*Requirement, error) {
+	var result []*Requirement
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.ListPermissionRequirements(ctx, project, permissions)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) ListDisks(ctx context.Context, project, zone, filter string) ([]*compute.Disk, error) {
+	var result []*compute.Disk
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.ListDisks(ctx, project, zone, filter)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) ListImages(ctx context.Context, project, filter string) ([]*compute.Image, error) {
+	var result []*compute.Image
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.ListImages(ctx, project, filter)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) ListInstances(ctx context.Context, project, zone string) ([]*compute.Instance, error) {
+	var result []*compute.Instance
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.ListInstances(ctx, project, zone)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) ListMachineTypes(ctx context.Context, project, zone string) ([]*compute.MachineType, error) {
+	var result []*compute.MachineType
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.ListMachineTypes(ctx, project, zone)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) ListOrganizationRecommendations(ctx context.Context, organization, location, recommenderID string) ([]*gcloudRecommendation, error) {
+	var result []*gcloudRecommendation
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.ListOrganizationRecommendations(ctx, organization, location, recommenderID)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) ListProjects(ctx context.Context) ([]string, error) {
+	var result []string
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.ListProjects(ctx)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) ListRecommendations(ctx context.Context, project, location, recommenderID string) ([]*gcloudRecommendation, error) {
+	var result []*gcloudRecommendation
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.ListRecommendations(ctx, project, location, recommenderID)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) ListSnapshots(ctx context.Context, project, filter string) ([]*compute.Snapshot, error) {
+	var result []*compute.Snapshot
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.ListSnapshots(ctx, project, filter)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) ListZonesNames(ctx context.Context, project string) ([]string, error) {
+	var result []string
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.ListZonesNames(ctx, project)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) ListRegionsNames(ctx context.Context, project string) ([]string, error) {
+	var result []string
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.ListRegionsNames(ctx, project)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) MarkRecommendationClaimed(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	var result *gcloudRecommendation
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.MarkRecommendationClaimed(ctx, name, etag)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) MarkRecommendationFailed(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	var result *gcloudRecommendation
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.MarkRecommendationFailed(ctx, name, etag)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) MarkRecommendationSucceeded(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	var result *gcloudRecommendation
+	err := s.config.retry(ctx, func() (err error) {
+		result, err = s.service.MarkRecommendationSucceeded(ctx, name, etag)
+		return err
+	})
+	return result, err
+}
+
+func (s *retryingService) SetDiskLabels(ctx context.Context, project, zone, disk string, labels map[string]string, fingerprint string) error {
+	return s.config.retry(ctx, func() error {
+		return s.service.SetDiskLabels(ctx, project, zone, disk, labels, fingerprint)
+	})
+}
+
+func (s *retryingService) SetProjectIAMPolicy(ctx context.Context, project string, policy *cloudresourcemanager.Policy) error {
+	return s.config.retry(ctx, func() error {
+		return s.service.SetProjectIAMPolicy(ctx, project, policy)
+	})
+}
+
+func (s *retryingService) StartInstance(ctx context.Context, project, zone, instance string) error {
+	return s.config.retry(ctx, func() error {
+		return s.service.StartInstance(ctx, project, zone, instance)
+	})
+}
+
+func (s *retryingService) StopInstance(ctx context.Context, project, zone, instance string) error {
+	return s.config.retry(ctx, func() error {
+		return s.service.StopInstance(ctx, project, zone, instance)
+	})
+}
+
+func (s *retryingService) StopSQLInstance(ctx context.Context, project, instance string) error {
+	return s.config.retry(ctx, func() error {
+		return s.service.StopSQLInstance(ctx, project, instance)
+	})
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+// mockFlakyService fails StopInstance with errors from the list, then succeeds.
+type mockFlakyService struct {
+	GoogleService
+	errs  []error
+	calls int
+}
+
+func (s *mockFlakyService) StopInstance(ctx context.Context, project, zone, instance string) error {
+	s.calls++
+	if s.calls <= len(s.errs) {
+		return s.errs[s.calls-1]
+	}
+	return nil
+}
+
+var testRetryConfig = &RetryConfig{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, IsRetryable(&googleapi.Error{Code: http.StatusTooManyRequests}))
+	assert.True(t, IsRetryable(&googleapi.Error{Code: http.StatusServiceUnavailable}))
+	assert.True(t, IsRetryable(&googleapi.Error{Code: http.StatusForbidden,
+		Errors: []googleapi.ErrorItem{googleapi.ErrorItem{Reason: "rateLimitExceeded"}}}), "403 with rate limit reason is retryable")
+	assert.False(t, IsRetryable(&googleapi.Error{Code: http.StatusForbidden}))
+	assert.False(t, IsRetryable(errors.New("parsing failed")))
+	assert.True(t, IsRetryable(fmt.Errorf("waiting for operation: %w", &googleapi.Error{Code: http.StatusServiceUnavailable})),
+		"Wrapped errors should be classified")
+}
+
+func TestRetryingService(t *testing.T) {
+	flaky := &mockFlakyService{errs: []error{
+		&googleapi.Error{Code: http.StatusInternalServerError},
+		&googleapi.Error{Code: http.StatusTooManyRequests},
+	}}
+	err := NewRetryingService(flaky, testRetryConfig).StopInstance(context.Background(), "p", "z", "i")
+	assert.NoError(t, err, "Transient errors should be retried")
+	assert.Equal(t, 3, flaky.calls)
+}
+
+func TestRetryingServiceMaxAttempts(t *testing.T) {
+	serverErr := &googleapi.Error{Code: http.StatusInternalServerError}
+	flaky := &mockFlakyService{errs: []error{serverErr, serverErr, serverErr, serverErr}}
+	err := NewRetryingService(flaky, testRetryConfig).StopInstance(context.Background(), "p", "z", "i")
+	assert.Equal(t, serverErr, err, "Last error should be returned")
+	assert.Equal(t, 3, flaky.calls, "At most MaxAttempts calls should be made")
+}
+
+func TestRetryingServiceNotRetryable(t *testing.T) {
+	flaky := &mockFlakyService{errs: []error{&googleapi.Error{Code: http.StatusNotFound}}}
+	err := NewRetryingService(flaky, testRetryConfig).StopInstance(context.Background(), "p", "z", "i")
+	assert.Error(t, err)
+	assert.Equal(t, 1, flaky.calls, "Permanent errors should not be retried")
+}
+
+func TestRetryingServiceCanceled(t *testing.T) {
+	serverErr := &googleapi.Error{Code: http.StatusInternalServerError}
+	flaky := &mockFlakyService{errs: []error{serverErr, serverErr}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	config := &RetryConfig{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+	err := NewRetryingService(flaky, config).StopInstance(ctx, "p", "z", "i")
+	assert.Equal(t, serverErr, err)
+	assert.Equal(t, 1, flaky.calls, "Calls should not be retried after context is done")
+}
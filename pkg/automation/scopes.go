@@ -0,0 +1,107 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"fmt"
+	"sort"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/recommender/v1"
+	"google.golang.org/api/sqladmin/v1beta4"
+)
+
+// baseScopes are OAuth scopes required to list projects, check requirements and list locations.
+var baseScopes = []string{
+	cloudresourcemanager.CloudPlatformReadOnlyScope, // ListProjects, ListAPIRequirements, ListPermissionRequirements
+	compute.ComputeReadonlyScope,                    // ListZonesNames, ListRegionsNames, GetInstance
+}
+
+// recommenderScopes are OAuth scopes required to list and to apply recommendations of each recommender.
+var recommenderScopes = map[string]struct {
+	list  []string
+	apply []string
+}{
+	"google.cloudsql.instance.IdleRecommender": {
+		list:  []string{recommender.CloudPlatformScope},
+		apply: []string{sqladmin.SqlserviceAdminScope},
+	},
+	"google.cloudsql.instance.OverprovisionedRecommender": {
+		list:  []string{recommender.CloudPlatformScope},
+		apply: []string{sqladmin.SqlserviceAdminScope},
+	},
+	commitmentRecommenderID: {
+		list: []string{recommender.CloudPlatformScope},
+	},
+	"google.compute.disk.IdleResourceRecommender": {
+		list:  []string{recommender.CloudPlatformScope},
+		apply: []string{compute.ComputeScope},
+	},
+	"google.compute.image.IdleResourceRecommender": {
+		list:  []string{recommender.CloudPlatformScope},
+		apply: []string{compute.ComputeScope},
+	},
+	"google.compute.instance.IdleResourceRecommender": {
+		list:  []string{recommender.CloudPlatformScope},
+		apply: []string{compute.ComputeScope},
+	},
+	"google.compute.instance.MachineTypeRecommender": {
+		list:  []string{recommender.CloudPlatformScope},
+		apply: []string{compute.ComputeScope},
+	},
+	iamRecommenderID: {
+		list:  []string{recommender.CloudPlatformScope},
+		apply: []string{cloudresourcemanager.CloudPlatformScope},
+	},
+	projectUtilizationRecommenderID: {
+		list:  []string{recommender.CloudPlatformScope},
+		apply: []string{cloudresourcemanager.CloudPlatformScope},
+	},
+}
+
+// RequiredScopes returns the sorted list of OAuth scopes required to list recommendations of recommenderIDs.
+// If apply is true, scopes required to apply them are included too.
+// The result can be used as oauth2.Config.Scopes, and shown to the user for security review.
+// It is an error if one of recommenders is not supported.
+func RequiredScopes(recommenderIDs []string, apply bool) ([]string, error) {
+	scopes := make(map[string]bool)
+	for _, scope := range baseScopes {
+		scopes[scope] = true
+	}
+	for _, recommenderID := range recommenderIDs {
+		recScopes, ok := recommenderScopes[recommenderID]
+		if !ok {
+			return nil, fmt.Errorf("recommender %s is not supported", recommenderID)
+		}
+		for _, scope := range recScopes.list {
+			scopes[scope] = true
+		}
+		if apply {
+			for _, scope := range recScopes.apply {
+				scopes[scope] = true
+			}
+		}
+	}
+
+	var result []string
+	for scope := range scopes {
+		result = append(result, scope)
+	}
+	sort.Strings(result)
+	return result, nil
+}
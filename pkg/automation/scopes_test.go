@@ -0,0 +1,63 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequiredScopes(t *testing.T) {
+	scopes, err := RequiredScopes(nil, true)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{
+			"https://www.googleapis.com/auth/cloud-platform.read-only",
+			"https://www.googleapis.com/auth/compute.readonly",
+		}, scopes, "Only read-only scopes are needed without recommenders")
+	}
+
+	scopes, err = RequiredScopes(googleRecommenders, false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{
+			"https://www.googleapis.com/auth/cloud-platform",
+			"https://www.googleapis.com/auth/cloud-platform.read-only",
+			"https://www.googleapis.com/auth/compute.readonly",
+		}, scopes, "Full compute scope should not be requested for listing")
+	}
+
+	scopes, err = RequiredScopes(googleRecommenders, true)
+	if assert.NoError(t, err) {
+		assert.Contains(t, scopes, "https://www.googleapis.com/auth/compute", "Full compute scope is needed to apply")
+		assert.Contains(t, scopes, "https://www.googleapis.com/auth/sqlservice.admin", "Cloud SQL scope is needed to apply")
+	}
+}
+
+func TestRequiredScopesOptionalRecommenders(t *testing.T) {
+	for _, recommenderID := range []string{"google.compute.image.IdleResourceRecommender", iamRecommenderID, projectUtilizationRecommenderID} {
+		scopes, err := RequiredScopes([]string{recommenderID}, true)
+		if assert.NoError(t, err, "Scopes of %s should be known", recommenderID) {
+			assert.Contains(t, scopes, "https://www.googleapis.com/auth/cloud-platform")
+		}
+	}
+}
+
+func TestRequiredScopesUnknownRecommender(t *testing.T) {
+	scopes, err := RequiredScopes([]string{"unknown"}, false)
+	assert.Error(t, err)
+	assert.Nil(t, scopes, "Only one of returned values should be non-nil")
+}
@@ -18,89 +18,224 @@ package automation
 
 import (
 	"context"
+	"net/http"
+	"time"
 
 	"golang.org/x/oauth2"
 	"google.golang.org/api/cloudresourcemanager/v1"
 	"google.golang.org/api/compute/v1"
-	"google.golang.org/api/option"
+	"google.golang.org/api/iam/v1"
 	"google.golang.org/api/recommender/v1"
 	"google.golang.org/api/serviceusage/v1"
+	"google.golang.org/api/sqladmin/v1beta4"
 )
 
 // GoogleService is the inferface that prodives methods required to list recommendations and apply them
 type GoogleService interface {
 	// changes the machine type of an instance
-	ChangeMachineType(project, zone, instance, machineType string) error
+	ChangeMachineType(ctx context.Context, project, zone, instance, machineType string) error
+
+	// changes the tier of a Cloud SQL instance
+	ChangeSQLInstanceTier(ctx context.Context, project, instance, tier string) error
+
+	// creates a snapshot of a regional disk
+	CreateRegionalSnapshot(ctx context.Context, project, region, disk, name string) error
 
 	// creates a snapshot of a disk
-	CreateSnapshot(project, zone, disk, name string) error
+	CreateSnapshot(ctx context.Context, project, zone, disk, name string) error
 
 	// deletes persistent disk
-	DeleteDisk(project, zone, disk string) error
+	DeleteDisk(ctx context.Context, project, zone, disk string) error
+
+	// deletes the custom image
+	DeleteImage(ctx context.Context, project, image string) error
+
+	// deletes the instance
+	DeleteInstance(ctx context.Context, project, zone, instance string) error
+
+	// requests deletion of the project
+	DeleteProject(ctx context.Context, project string) error
+
+	// deletes regional persistent disk
+	DeleteRegionalDisk(ctx context.Context, project, region, disk string) error
+
+	// deletes the snapshot
+	DeleteSnapshot(ctx context.Context, project, snapshot string) error
+
+	// gets the specified persistent disk
+	GetDisk(ctx context.Context, project, zone, disk string) (*compute.Disk, error)
+
+	// gets the specified custom image
+	GetImage(ctx context.Context, project, image string) (*compute.Image, error)
 
 	// gets the specified instance resource
-	GetInstance(project string, zone string, instance string) (*compute.Instance, error)
+	GetInstance(ctx context.Context, project string, zone string, instance string) (*compute.Instance, error)
+
+	// gets the specified regional persistent disk
+	GetRegionalDisk(ctx context.Context, project, region, disk string) (*compute.Disk, error)
+
+	// gets the specified Cloud SQL instance
+	GetSQLInstance(ctx context.Context, project, instance string) (*sqladmin.DatabaseInstance, error)
+
+	// gets the recommendation by its name
+	GetRecommendation(ctx context.Context, name string) (*gcloudRecommendation, error)
+
+	// gets names of the project and its ancestors in the resource hierarchy
+	GetProjectAncestry(ctx context.Context, project string) ([]string, error)
+
+	// gets the IAM policy of the project
+	GetProjectIAMPolicy(ctx context.Context, project string) (*cloudresourcemanager.Policy, error)
+
+	// gets permissions included in the IAM role
+	GetRolePermissions(ctx context.Context, role string) ([]string, error)
 
 	// lists whether the requirements have been met for all APIs (APIs enabled).
-	ListAPIRequirements(project string, apis []string) ([]*Requirement, error)
+	ListAPIRequirements(ctx context.Context, project string, apis []string) ([]*Requirement, error)
 
 	// lists whether the requirements have been met for all required permissions.
-	ListPermissionRequirements(project string, permissions [][]string) ([]*Requirement, error)
+	ListPermissionRequirements(ctx context.Context, project string, permissions [][]string) ([]*Requirement, error)
+
+	// lists disks in the zone, or in all zones if zone is empty, matching the filter
+	ListDisks(ctx context.Context, project, zone, filter string) ([]*compute.Disk, error)
+
+	// lists custom images in the project matching the filter
+	ListImages(ctx context.Context, project, filter string) ([]*compute.Image, error)
+
+	// lists instances in the zone, or in all zones if zone is empty
+	ListInstances(ctx context.Context, project, zone string) ([]*compute.Instance, error)
+
+	// lists machine types available in the zone
+	ListMachineTypes(ctx context.Context, project, zone string) ([]*compute.MachineType, error)
+
+	// listing recommendations for specified organization, location and recommender
+	ListOrganizationRecommendations(ctx context.Context, organization, location, recommenderID string) ([]*gcloudRecommendation, error)
 
 	// lists projects
-	ListProjects() ([]string, error)
+	ListProjects(ctx context.Context) ([]string, error)
 
 	// listing recommendations for specified project, zone and recommender
-	ListRecommendations(project, location, recommenderID string) ([]*gcloudRecommendation, error)
+	ListRecommendations(ctx context.Context, project, location, recommenderID string) ([]*gcloudRecommendation, error)
+
+	// lists snapshots in the project matching the filter
+	ListSnapshots(ctx context.Context, project, filter string) ([]*compute.Snapshot, error)
 
 	// listing every zone available for the project methods
-	ListZonesNames(project string) ([]string, error)
+	ListZonesNames(ctx context.Context, project string) ([]string, error)
 
 	// listing every region available for the project methods
-	ListRegionsNames(project string) ([]string, error)
+	ListRegionsNames(ctx context.Context, project string) ([]string, error)
+
+	// marks the recommendation as claimed, returns the updated recommendation
+	MarkRecommendationClaimed(ctx context.Context, name, etag string) (*gcloudRecommendation, error)
+
+	// marks the recommendation as failed, returns the updated recommendation
+	MarkRecommendationFailed(ctx context.Context, name, etag string) (*gcloudRecommendation, error)
+
+	// marks the recommendation as succeeded, returns the updated recommendation
+	MarkRecommendationSucceeded(ctx context.Context, name, etag string) (*gcloudRecommendation, error)
+
+	// replaces labels of the disk, fingerprint must match the current labels
+	SetDiskLabels(ctx context.Context, project, zone, disk string, labels map[string]string, fingerprint string) error
+
+	// replaces the IAM policy of the project, etag of the policy must match the current policy
+	SetProjectIAMPolicy(ctx context.Context, project string, policy *cloudresourcemanager.Policy) error
+
+	// starts the specified instance
+	StartInstance(ctx context.Context, project, zone, instance string) error
 
 	// stops the specified instance
-	StopInstance(project, zone, instance string) error
+	StopInstance(ctx context.Context, project, zone, instance string) error
+
+	// stops the specified Cloud SQL instance
+	StopSQLInstance(ctx context.Context, project, instance string) error
 }
 
-// googleService implements GoogleService interface for Recommender and Compute APIs.
+// googleService implements GoogleService interface for Recommender, Compute, Cloud SQL Admin and IAM APIs.
 type googleService struct {
-	ctx                    context.Context
 	computeService         *compute.Service
 	recommenderService     *recommender.Service
 	resourceManagerService *cloudresourcemanager.Service
 	serviceUsageService    *serviceusage.Service
+	sqlAdminService        *sqladmin.Service
+	iamService             *iam.Service
+	operationTimeout       time.Duration
 }
 
 // NewGoogleService creates new googleServices.
 // If creation failed the error will be non-nil.
-func NewGoogleService(ctx context.Context, conf *oauth2.Config, tok *oauth2.Token) (GoogleService, error) {
-	client := conf.Client(ctx, tok)
-	computeService, err := compute.NewService(ctx, option.WithHTTPClient(client))
+func NewGoogleService(ctx context.Context, conf *oauth2.Config, tok *oauth2.Token, options ...ServiceOption) (GoogleService, error) {
+	config := newServiceConfig(options)
+	ctx = config.withHTTPClient(ctx)
+	return newGoogleService(ctx, config, conf.TokenSource(ctx, tok))
+}
+
+// NewGoogleServiceFromTokenSource creates new googleServices using tokens from tokenSource,
+// for example the one created by NewCachedTokenSource.
+// Options are not applied to token refreshes done by tokenSource.
+// If creation failed the error will be non-nil.
+func NewGoogleServiceFromTokenSource(ctx context.Context, tokenSource oauth2.TokenSource, options ...ServiceOption) (GoogleService, error) {
+	config := newServiceConfig(options)
+	ctx = config.withHTTPClient(ctx)
+	return newGoogleService(ctx, config, tokenSource)
+}
+
+// newTokenClient creates http client authorizing requests with tokens from tokenSource,
+// sent using the transport of http client from ctx, see oauth2.HTTPClient.
+// Unlike oauth2.NewClient, it doesn't reuse tokens until they expire,
+// so that tokenSource can refresh them earlier, see NewCachedTokenSource.
+func newTokenClient(ctx context.Context, tokenSource oauth2.TokenSource) *http.Client {
+	var base http.RoundTripper
+	if client, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); ok {
+		base = client.Transport
+	}
+	return &http.Client{Transport: &oauth2.Transport{Source: tokenSource, Base: base}}
+}
+
+// newGoogleService creates new googleServices using http client from ctx and tokens from tokenSource.
+func newGoogleService(ctx context.Context, config *serviceConfig, tokenSource oauth2.TokenSource) (GoogleService, error) {
+	err := config.checkEndpoints([]string{computeAPI, recommenderAPI, resourceManagerAPI, serviceUsageAPI, sqlAdminAPI, iamAPI})
+	if err != nil {
+		return nil, err
+	}
+
+	client := newTokenClient(ctx, tokenSource)
+	computeService, err := compute.NewService(ctx, config.clientOptions(computeAPI, client)...)
+	if err != nil {
+		return nil, err
+	}
+
+	recommenderService, err := recommender.NewService(ctx, config.clientOptions(recommenderAPI, client)...)
+	if err != nil {
+		return nil, err
+	}
+
+	resourceManagerService, err := cloudresourcemanager.NewService(ctx, config.clientOptions(resourceManagerAPI, client)...)
 	if err != nil {
 		return nil, err
 	}
 
-	recommenderService, err := recommender.NewService(ctx)
+	serviceUsageService, err := serviceusage.NewService(ctx, config.clientOptions(serviceUsageAPI, client)...)
 	if err != nil {
 		return nil, err
 	}
 
-	resourceManagerService, err := cloudresourcemanager.NewService(ctx)
+	sqlAdminService, err := sqladmin.NewService(ctx, config.clientOptions(sqlAdminAPI, client)...)
 	if err != nil {
 		return nil, err
 	}
 
-	serviceUsageService, err := serviceusage.NewService(ctx)
+	iamService, err := iam.NewService(ctx, config.clientOptions(iamAPI, client)...)
 	if err != nil {
 		return nil, err
 	}
 
 	return &googleService{
-		ctx:                    ctx,
 		computeService:         computeService,
 		recommenderService:     recommenderService,
 		resourceManagerService: resourceManagerService,
 		serviceUsageService:    serviceUsageService,
+		sqlAdminService:        sqlAdminService,
+		iamService:             iamService,
+		operationTimeout:       config.operationTimeout,
 	}, nil
 }
@@ -0,0 +1,80 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestEndpointOverride(t *testing.T) {
+	var requestedPaths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedPaths = append(requestedPaths, r.URL.Path)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"items": [{"name": "zone1"}, {"name": "zone2"}]}`)
+	}))
+	defer server.Close()
+
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	service, err := NewGoogleServiceFromTokenSource(context.Background(), tokenSource,
+		WithEndpoint(computeAPI, server.URL+"/compute/v1/projects/"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	zones, err := service.ListZonesNames(context.Background(), "project")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"zone1", "zone2"}, zones, "Zones should be listed from the overridden endpoint")
+		assert.Equal(t, []string{"/compute/v1/projects/project/zones"}, requestedPaths)
+	}
+}
+
+func TestEndpointOverrideUnknownAPI(t *testing.T) {
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	service, err := NewGoogleServiceFromTokenSource(context.Background(), tokenSource,
+		WithEndpoint("unknown.googleapis.com", "http://localhost/"))
+	assert.Error(t, err, "Endpoint of unknown API can't be overridden")
+	assert.Nil(t, service, "At most one of returned values should be non-nil")
+}
+
+func TestCanceledContext(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"name": "instance"}`)
+	}))
+	defer server.Close()
+
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	service, err := NewGoogleServiceFromTokenSource(context.Background(), tokenSource,
+		WithEndpoint(computeAPI, server.URL+"/compute/v1/projects/"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = service.GetInstance(ctx, "project", "zone", "instance")
+	assert.Error(t, err, "Call with canceled context should fail")
+	assert.Equal(t, 0, requests, "Call with canceled context should not be sent")
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/api/compute/v1"
+)
+
+// SnapshotCostEstimate is the estimated monthly cost of the snapshot created
+// by the recommendation before deleting the disk.
+// The snapshot is assumed to be as large as the disk, so the estimate is the upper bound.
+type SnapshotCostEstimate struct {
+	Recommendation string  `json:"recommendation"`
+	Disk           string  `json:"disk"`
+	SizeGb         int64   `json:"sizeGb"`
+	MonthlyCost    float64 `json:"monthlyCost"`
+	CurrencyCode   string  `json:"currencyCode"`
+}
+
+// snapshotSourceDisk returns the source disk of the snapshot created by the recommendation.
+// If the recommendation doesn't create a snapshot, ok is false.
+func snapshotSourceDisk(rec *gcloudRecommendation) (disk string, ok bool) {
+	if rec == nil || rec.Content == nil {
+		return "", false
+	}
+	for _, group := range rec.Content.OperationGroups {
+		for _, operation := range group.Operations {
+			if operation.Action != "add" || operation.ResourceType != snapshotResourceType {
+				continue
+			}
+			value, isMap := operation.Value.(map[string]interface{})
+			if !isMap {
+				continue
+			}
+			if disk, ok := value["source_disk"].(string); ok {
+				return disk, true
+			}
+		}
+	}
+	return "", false
+}
+
+// EstimateSnapshotCost estimates the cost of the snapshot created by the recommendation,
+// using the size of the disk and the snapshot storage price in the region of the disk.
+// If the recommendation doesn't create a snapshot, both returned values are nil.
+// Requires compute.disks.get permission.
+func EstimateSnapshotCost(ctx context.Context, service GoogleService, catalog PriceCatalog, rec *gcloudRecommendation) (*SnapshotCostEstimate, error) {
+	sourceDisk, ok := snapshotSourceDisk(rec)
+	if !ok {
+		return nil, nil
+	}
+	var disk *compute.Disk
+	var region string
+	if isRegionalResource(sourceDisk) {
+		project, diskRegion, name, err := parseRegionalResource(sourceDisk)
+		if err != nil {
+			return nil, err
+		}
+		disk, err = service.GetRegionalDisk(ctx, project, diskRegion, name)
+		if err != nil {
+			return nil, err
+		}
+		region = diskRegion
+	} else {
+		project, zone, name, err := parseZonalResource(sourceDisk)
+		if err != nil {
+			return nil, err
+		}
+		disk, err = service.GetDisk(ctx, project, zone, name)
+		if err != nil {
+			return nil, err
+		}
+		region = zoneRegion(zone)
+	}
+	gbPrice, currencyCode, err := catalog.StoragePrice(SnapshotStorage, region)
+	if err != nil {
+		return nil, err
+	}
+	return &SnapshotCostEstimate{
+		Recommendation: rec.Name,
+		Disk:           sourceDisk,
+		SizeGb:         disk.SizeGb,
+		MonthlyCost:    float64(disk.SizeGb) * gbPrice,
+		CurrencyCode:   currencyCode,
+	}, nil
+}
+
+// costProjectionMonths returns the duration of the cost projection of the recommendation in months,
+// assuming one month if the duration is unknown.
+func costProjectionMonths(rec *gcloudRecommendation) float64 {
+	if rec.PrimaryImpact == nil || rec.PrimaryImpact.CostProjection == nil {
+		return 1
+	}
+	duration, err := time.ParseDuration(rec.PrimaryImpact.CostProjection.Duration)
+	if err != nil || duration <= 0 {
+		return 1
+	}
+	return float64(duration) / float64(month)
+}
+
+// SubtractSnapshotCosts estimates costs of snapshots created by recommendations in the cards
+// and subtracts them from Savings of the cards, over the same duration as their cost projections,
+// so that net savings are not overstated. The estimates are stored in SnapshotCosts of the cards.
+// If the error occurred the returned error is not nil, the cards may be partially updated.
+func SubtractSnapshotCosts(ctx context.Context, service GoogleService, catalog PriceCatalog, cards []*ResourceCard) error {
+	for _, card := range cards {
+		for _, rec := range card.Recommendations {
+			estimate, err := EstimateSnapshotCost(ctx, service, catalog, rec)
+			if err != nil {
+				return err
+			}
+			if estimate == nil {
+				continue
+			}
+			card.SnapshotCosts = append(card.SnapshotCosts, estimate)
+			card.Savings[estimate.CurrencyCode] -= estimate.MonthlyCost * costProjectionMonths(rec)
+		}
+	}
+	return nil
+}
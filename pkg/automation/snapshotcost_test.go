@@ -0,0 +1,73 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/cloudbilling/v1"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/recommender/v1"
+)
+
+type mockDiskService struct {
+	GoogleService
+	disk *compute.Disk
+}
+
+func (s *mockDiskService) GetDisk(ctx context.Context, project, zone, disk string) (*compute.Disk, error) {
+	return s.disk, nil
+}
+
+func TestSubtractSnapshotCosts(t *testing.T) {
+	rec, err := ParseRecommendation([]byte(diskRecommendationJSON))
+	if !assert.NoError(t, err) {
+		return
+	}
+	rec.PrimaryImpact = &recommender.GoogleCloudRecommenderV1Impact{
+		CostProjection: &recommender.GoogleCloudRecommenderV1CostProjection{
+			Cost:     &gcloudMoney{CurrencyCode: "USD", Units: -10},
+			Duration: "5184000s", // 60 days
+		},
+	}
+	catalog := &skuPriceCatalog{
+		listSkus: func() ([]*cloudbilling.Sku, error) {
+			return []*cloudbilling.Sku{makeSku("Storage PD Snapshot", "Storage", "GiBy.mo", 25000000, "europe-west1")}, nil
+		},
+		ttl: time.Hour,
+	}
+	service := &mockDiskService{disk: &compute.Disk{SizeGb: 100}}
+
+	cards := GroupByResource([]*gcloudRecommendation{rec, stopInstanceRecommendation("stop", 1)})
+	err = SubtractSnapshotCosts(context.Background(), service, catalog, cards)
+	if assert.NoError(t, err) && assert.Equal(t, 2, len(cards)) {
+		disk, instance := cards[0], cards[1]
+		if disk.ResourceType != diskResourceType {
+			disk, instance = instance, disk
+		}
+		if assert.Equal(t, 1, len(disk.SnapshotCosts)) {
+			assert.Equal(t, int64(100), disk.SnapshotCosts[0].SizeGb)
+			assert.InDelta(t, 2.5, disk.SnapshotCosts[0].MonthlyCost, 1e-9)
+		}
+		assert.InDelta(t, 5, disk.Savings["USD"], 1e-9, "Snapshot cost for the whole cost projection should be subtracted")
+		assert.Empty(t, instance.SnapshotCosts, "Stopping instance doesn't create snapshots")
+		assert.Equal(t, 1.0, instance.Savings["USD"])
+	}
+}
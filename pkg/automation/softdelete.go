@@ -0,0 +1,91 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// DeleteAfterLabel is the label of disks waiting for deletion, its value is the deletion time in Unix seconds.
+const DeleteAfterLabel = "recomator-delete-after"
+
+// softDeleteCall returns the call labeling the disk for deletion at deleteAfter instead of deleting it.
+func softDeleteCall(call *OperationCall, deleteAfter time.Time) *OperationCall {
+	argument := strconv.FormatInt(deleteAfter.Unix(), 10)
+	return &OperationCall{labelForDeletionMethod, call.Project, call.Zone, call.Resource, argument}
+}
+
+// labelDiskForDeletion sets DeleteAfterLabel of the disk to deleteAfter, keeping other labels.
+func labelDiskForDeletion(ctx context.Context, service GoogleService, project, zone, disk, deleteAfter string) error {
+	current, err := service.GetDisk(ctx, project, zone, disk)
+	if err != nil {
+		return err
+	}
+	labels := map[string]string{DeleteAfterLabel: deleteAfter}
+	for key, value := range current.Labels {
+		if key != DeleteAfterLabel {
+			labels[key] = value
+		}
+	}
+	return service.SetDiskLabels(ctx, project, zone, disk, labels, current.LabelFingerprint)
+}
+
+// ReclaimDisk cancels the deletion of the disk labeled by Apply with WithSoftDelete option.
+// Requires compute.disks.get and compute.disks.setLabels permissions.
+// If the error occurred the returned error is not nil.
+func ReclaimDisk(ctx context.Context, service GoogleService, project, zone, disk string) error {
+	current, err := service.GetDisk(ctx, project, zone, disk)
+	if err != nil {
+		return err
+	}
+	if _, ok := current.Labels[DeleteAfterLabel]; !ok {
+		return nil
+	}
+	labels := make(map[string]string)
+	for key, value := range current.Labels {
+		if key != DeleteAfterLabel {
+			labels[key] = value
+		}
+	}
+	return service.SetDiskLabels(ctx, project, zone, disk, labels, current.LabelFingerprint)
+}
+
+// DeleteExpiredDisks deletes disks in the project whose grace period set by Apply
+// with WithSoftDelete option has passed at now. Disks attached to instances are not deleted.
+// Returns the names of deleted disks, also if the error occurred.
+// Requires compute.disks.list and compute.disks.delete permissions.
+func DeleteExpiredDisks(ctx context.Context, service GoogleService, project string, now time.Time) ([]string, error) {
+	disks, err := service.ListDisks(ctx, project, "", "labels."+DeleteAfterLabel+":*")
+	if err != nil {
+		return nil, err
+	}
+	var deleted []string
+	for _, disk := range disks {
+		deleteAfter, err := strconv.ParseInt(disk.Labels[DeleteAfterLabel], 10, 64)
+		if err != nil || now.Before(time.Unix(deleteAfter, 0)) || len(disk.Users) != 0 {
+			continue
+		}
+		err = service.DeleteDisk(ctx, project, lastPathElement(disk.Zone), disk.Name)
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, disk.Name)
+	}
+	return deleted, nil
+}
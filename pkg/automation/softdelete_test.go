@@ -0,0 +1,133 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/compute/v1"
+)
+
+// mockSoftDeleteService keeps a single disk.
+type mockSoftDeleteService struct {
+	GoogleService
+	disk      *compute.Disk
+	snapshots int
+	deleted   []string
+}
+
+func (s *mockSoftDeleteService) CreateSnapshot(ctx context.Context, project, zone, disk, name string) error {
+	s.snapshots++
+	return nil
+}
+
+func (s *mockSoftDeleteService) GetDisk(ctx context.Context, project, zone, disk string) (*compute.Disk, error) {
+	return s.disk, nil
+}
+
+func (s *mockSoftDeleteService) SetDiskLabels(ctx context.Context, project, zone, disk string, labels map[string]string, fingerprint string) error {
+	s.disk.Labels = labels
+	return nil
+}
+
+func (s *mockSoftDeleteService) ListDisks(ctx context.Context, project, zone, filter string) ([]*compute.Disk, error) {
+	if _, ok := s.disk.Labels[DeleteAfterLabel]; ok {
+		return []*compute.Disk{s.disk}, nil
+	}
+	return nil, nil
+}
+
+func (s *mockSoftDeleteService) DeleteDisk(ctx context.Context, project, zone, disk string) error {
+	s.deleted = append(s.deleted, zone+"/"+disk)
+	return nil
+}
+
+func (s *mockSoftDeleteService) MarkRecommendationClaimed(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	return &gcloudRecommendation{Name: name, Etag: etag}, nil
+}
+
+func (s *mockSoftDeleteService) MarkRecommendationSucceeded(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	return &gcloudRecommendation{Name: name, Etag: etag}, nil
+}
+
+func newMockSoftDeleteService() *mockSoftDeleteService {
+	return &mockSoftDeleteService{disk: &compute.Disk{
+		Name:   "krzysztofk2",
+		Zone:   "https://www.googleapis.com/compute/v1/projects/rightsizer-test/zones/europe-west1-d",
+		Labels: map[string]string{"team": "infra"},
+	}}
+}
+
+func TestApplySoftDelete(t *testing.T) {
+	rec, err := ParseRecommendation([]byte(diskRecommendationJSON))
+	if !assert.NoError(t, err) {
+		return
+	}
+	service := newMockSoftDeleteService()
+	report, err := Apply(context.Background(), service, rec, WithSoftDelete(24*time.Hour))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, labelForDeletionMethod, report.Calls[1].Method)
+	assert.Equal(t, 1, service.snapshots, "Snapshot should still be created")
+	assert.Empty(t, service.deleted, "Disk should not be deleted during the grace period")
+	assert.Equal(t, "infra", service.disk.Labels["team"], "Other labels should be kept")
+
+	ctx := context.Background()
+	deleted, err := DeleteExpiredDisks(ctx, service, "rightsizer-test", time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, deleted, "Grace period hasn't passed yet")
+
+	deleted, err = DeleteExpiredDisks(ctx, service, "rightsizer-test", time.Now().Add(25*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"krzysztofk2"}, deleted)
+	assert.Equal(t, []string{"europe-west1-d/krzysztofk2"}, service.deleted)
+}
+
+func TestReclaimDisk(t *testing.T) {
+	service := newMockSoftDeleteService()
+	service.disk.Labels[DeleteAfterLabel] = "0"
+	err := ReclaimDisk(context.Background(), service, "rightsizer-test", "europe-west1-d", "krzysztofk2")
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]string{"team": "infra"}, service.disk.Labels)
+	}
+	deleted, err := DeleteExpiredDisks(context.Background(), service, "rightsizer-test", time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, deleted, "Reclaimed disk should not be deleted")
+
+	service.disk.Labels[DeleteAfterLabel] = "0"
+	service.disk.Users = []string{"instance"}
+	deleted, err = DeleteExpiredDisks(context.Background(), service, "rightsizer-test", time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, deleted, "Attached disk should not be deleted")
+}
+
+func TestApplySnapshotNaming(t *testing.T) {
+	rec, err := ParseRecommendation([]byte(diskRecommendationJSON))
+	if !assert.NoError(t, err) {
+		return
+	}
+	naming := &SnapshotNaming{Prefix: "before-delete", RandomSuffixLength: 6}
+	report, err := Apply(context.Background(), newMockSoftDeleteService(), rec, WithSnapshotNaming(naming))
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(report.Snapshots)) {
+		assert.Regexp(t, "^before-delete-krzysztofk2-[a-z0-9]{6}$", report.Snapshots[0])
+		assert.Equal(t, report.Calls[0].Argument, report.Snapshots[0])
+	}
+}
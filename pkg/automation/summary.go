@@ -0,0 +1,188 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const month = 30 * 24 * time.Hour
+
+// RecommendationSummary is the typed representation of the recommendation,
+// used to generate its text summary instead of relying on the description from Recommender API.
+// Machine types are set only for machine type changes.
+type RecommendationSummary struct {
+	Subtype            string
+	Resource           string
+	ResourceName       string
+	CurrentMachineType string
+	TargetMachineType  string
+	MonthlySavings     float64
+	CurrencyCode       string
+}
+
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+}
+
+// formatMoney returns the amount rounded to whole units with the currency symbol, e.g. "$23".
+func formatMoney(amount float64, currencyCode string) string {
+	if symbol, ok := currencySymbols[currencyCode]; ok {
+		return fmt.Sprintf("%s%.0f", symbol, amount)
+	}
+	return fmt.Sprintf("%.0f %s", amount, currencyCode)
+}
+
+// formatSavings returns the part of the summary about savings, empty if their currency is unknown.
+func formatSavings(s *RecommendationSummary) string {
+	if s.CurrencyCode == "" {
+		return ""
+	}
+	return fmt.Sprintf(", saving ~%s/mo", formatMoney(s.MonthlySavings, s.CurrencyCode))
+}
+
+var summaryFuncs = template.FuncMap{"money": formatMoney, "savings": formatSavings}
+
+// SummaryTemplates are templates of summaries per recommender subtype, executed with *RecommendationSummary.
+// They can be replaced to change the wording, summaryFuncs can be used in them.
+var SummaryTemplates = map[string]*template.Template{
+	"CHANGE_MACHINE_TYPE": template.Must(template.New("CHANGE_MACHINE_TYPE").Funcs(summaryFuncs).Parse(
+		"Resize {{.ResourceName}} from {{.CurrentMachineType}} to {{.TargetMachineType}}{{savings .}}")),
+	"STOP_VM": template.Must(template.New("STOP_VM").Funcs(summaryFuncs).Parse(
+		"Stop idle instance {{.ResourceName}}{{savings .}}")),
+	"SNAPSHOT_AND_DELETE_DISK": template.Must(template.New("SNAPSHOT_AND_DELETE_DISK").Funcs(summaryFuncs).Parse(
+		"Snapshot and delete idle disk {{.ResourceName}}{{savings .}}")),
+}
+
+// monthlySavings returns savings of the recommendation per month,
+// scaled from the duration of the cost projection.
+func monthlySavings(rec *gcloudRecommendation) (string, float64, error) {
+	currencyCode, savings, ok := recommendationSavings(rec)
+	if !ok {
+		return "", 0, nil
+	}
+	duration, err := time.ParseDuration(rec.PrimaryImpact.CostProjection.Duration)
+	if err != nil {
+		return "", 0, err
+	}
+	if duration <= 0 {
+		return "", 0, fmt.Errorf("duration of cost projection must be positive, got %s", duration)
+	}
+	return currencyCode, savings * float64(month) / float64(duration), nil
+}
+
+// NewRecommendationSummary extracts the data for the summary from the operations and impact of the recommendation.
+func NewRecommendationSummary(rec *gcloudRecommendation) (*RecommendationSummary, error) {
+	summary := &RecommendationSummary{Subtype: rec.RecommenderSubtype}
+	currencyCode, savings, err := monthlySavings(rec)
+	if err != nil {
+		return nil, err
+	}
+	summary.CurrencyCode = currencyCode
+	summary.MonthlySavings = math.Max(savings, 0)
+
+	for _, group := range rec.Content.OperationGroups {
+		for _, operation := range group.Operations {
+			if summary.Resource == "" && operation.Action != "add" {
+				summary.Resource = operation.Resource
+				summary.ResourceName = lastPathElement(operation.Resource)
+			}
+			if operation.Path != "/machineType" {
+				continue
+			}
+			switch operation.Action {
+			case "test":
+				if value, ok := operation.Value.(string); ok {
+					summary.CurrentMachineType = lastPathElement(value)
+				} else if operation.ValueMatcher != nil {
+					summary.CurrentMachineType = lastPathElement(operation.ValueMatcher.MatchesPattern)
+				}
+			case "replace":
+				if value, ok := operation.Value.(string); ok {
+					summary.TargetMachineType = lastPathElement(value)
+				}
+			}
+		}
+	}
+	return summary, nil
+}
+
+// Text returns the summary generated from the template for its subtype.
+// If there is no template for the subtype, the error is returned.
+func (s *RecommendationSummary) Text() (string, error) {
+	tmpl, ok := SummaryTemplates[s.Subtype]
+	if !ok {
+		return "", fmt.Errorf("no summary template for recommender subtype %s", s.Subtype)
+	}
+	return s.execute(tmpl)
+}
+
+// LocalizedText returns the summary generated as by Text, with money formatted by the formatter.
+func (s *RecommendationSummary) LocalizedText(formatter *Formatter) (string, error) {
+	tmpl, ok := SummaryTemplates[s.Subtype]
+	if !ok {
+		return "", fmt.Errorf("no summary template for recommender subtype %s", s.Subtype)
+	}
+	tmpl, err := tmpl.Clone()
+	if err != nil {
+		return "", err
+	}
+	tmpl.Funcs(template.FuncMap{
+		"money": formatter.RoundedMoney,
+		"savings": func(s *RecommendationSummary) string {
+			if s.CurrencyCode == "" {
+				return ""
+			}
+			return fmt.Sprintf(", saving ~%s/mo", formatter.RoundedMoney(s.MonthlySavings, s.CurrencyCode))
+		},
+	})
+	return s.execute(tmpl)
+}
+
+// execute returns the summary generated from tmpl.
+func (s *RecommendationSummary) execute(tmpl *template.Template) (string, error) {
+	var builder strings.Builder
+	err := tmpl.Execute(&builder, s)
+	if err != nil {
+		return "", err
+	}
+	return builder.String(), nil
+}
+
+// Summarize returns the text summary of the recommendation.
+// If it can't be generated, the description from Recommender API is returned.
+func Summarize(rec *gcloudRecommendation) string {
+	if rec == nil || rec.Content == nil {
+		return ""
+	}
+	summary, err := NewRecommendationSummary(rec)
+	if err != nil {
+		return rec.Description
+	}
+	text, err := summary.Text()
+	if err != nil {
+		return rec.Description
+	}
+	return text
+}
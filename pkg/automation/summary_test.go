@@ -0,0 +1,89 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/recommender/v1"
+)
+
+func TestSummarizeMachineTypeChange(t *testing.T) {
+	rec := makeRecommendation("resize", 46,
+		&gcloudOperation{Action: "test", Path: "/machineType", Resource: testInstance, ResourceType: instanceResourceType,
+			ValueMatcher: &gcloudValueMatcher{MatchesPattern: ".*zones/us-east1-b/machineTypes/n1-standard-4"}},
+		&gcloudOperation{Action: "replace", Path: "/machineType", Resource: testInstance, ResourceType: instanceResourceType,
+			Value: "zones/us-east1-b/machineTypes/custom-2-5120"})
+	rec.RecommenderSubtype = "CHANGE_MACHINE_TYPE"
+	rec.PrimaryImpact.CostProjection.Duration = "5184000s" // 60 days
+
+	summary, err := NewRecommendationSummary(rec)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "n1-standard-4", summary.CurrentMachineType)
+		assert.Equal(t, "custom-2-5120", summary.TargetMachineType)
+		assert.Equal(t, 23.0, summary.MonthlySavings, "Savings should be scaled to a month")
+	}
+	assert.Equal(t, "Resize "+lastPathElement(testInstance)+" from n1-standard-4 to custom-2-5120, saving ~$23/mo", Summarize(rec))
+}
+
+func TestSummarizeDiskDeletion(t *testing.T) {
+	rec := deleteDiskRecommendation("delete", 3)
+	rec.RecommenderSubtype = "SNAPSHOT_AND_DELETE_DISK"
+	rec.PrimaryImpact.CostProjection.Duration = "2592000s"
+	rec.PrimaryImpact.CostProjection.Cost.CurrencyCode = "PLN"
+	assert.Equal(t, "Snapshot and delete idle disk "+lastPathElement(testDisk)+", saving ~3 PLN/mo", Summarize(rec),
+		"Created snapshot is not the target of the recommendation")
+}
+
+func TestSummarizeFallback(t *testing.T) {
+	rec := stopInstanceRecommendation("stop", 1)
+	rec.Description = "Save cost by stopping Idle VM 'alicja-test'."
+	rec.PrimaryImpact.CostProjection.Duration = "2592000s"
+	rec.RecommenderSubtype = "UNKNOWN"
+	assert.Equal(t, rec.Description, Summarize(rec), "Description should be used for unknown subtypes")
+
+	rec.RecommenderSubtype = "STOP_VM"
+	rec.PrimaryImpact.CostProjection.Duration = "-1s"
+	assert.Equal(t, rec.Description, Summarize(rec), "Description should be used for invalid duration")
+
+	rec.PrimaryImpact = &recommender.GoogleCloudRecommenderV1Impact{}
+	assert.Equal(t, "Stop idle instance "+lastPathElement(testInstance), Summarize(rec), "Summary should not mention unknown savings")
+}
+
+func TestSummarizeLocalized(t *testing.T) {
+	rec := deleteDiskRecommendation("delete", 1234)
+	rec.RecommenderSubtype = "SNAPSHOT_AND_DELETE_DISK"
+	rec.PrimaryImpact.CostProjection.Duration = "2592000s"
+	summary, err := NewRecommendationSummary(rec)
+	if !assert.NoError(t, err) {
+		return
+	}
+	formatter, err := NewFormatter("de-DE")
+	if !assert.NoError(t, err) {
+		return
+	}
+	text, err := summary.LocalizedText(formatter)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Snapshot and delete idle disk "+lastPathElement(testDisk)+", saving ~$1.234/mo", text)
+	}
+	text, err = summary.Text()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Snapshot and delete idle disk "+lastPathElement(testDisk)+", saving ~$1234/mo", text,
+			"Templates should not be modified by localization")
+	}
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package automation
 
 import (
+	"context"
 	"errors"
 	"regexp"
 
@@ -77,8 +78,8 @@ func testMatching(toTest string, value interface{}, valueMatcher *gcloudValueMat
 // The value specified by the path field in the operation struct must match value or valueMatcher,
 // depending on which one is defined. More can be read here:
 // https://cloud.google.com/recommender/docs/reference/rest/v1/projects.locations.recommenders.recommendations#operation
-func (s *googleService) TestMachineType(project string, zone string, instance string, value interface{}, valueMatcher *gcloudValueMatcher) (bool, error) {
-	machineInstance, err := s.GetInstance(project, zone, instance)
+func (s *googleService) TestMachineType(ctx context.Context, project string, zone string, instance string, value interface{}, valueMatcher *gcloudValueMatcher) (bool, error) {
+	machineInstance, err := s.GetInstance(ctx, project, zone, instance)
 	if err != nil {
 		return false, err
 	}
@@ -92,8 +93,8 @@ func (s *googleService) TestMachineType(project string, zone string, instance st
 // The value specified by the path field in the operation struct must match value or valueMatcher,
 // depending on which one is defined. More can be read here:
 // https://cloud.google.com/recommender/docs/reference/rest/v1/projects.locations.recommenders.recommendations#operation
-func (s *googleService) TestStatus(project string, zone string, instance string, value interface{}, valueMatcher *gcloudValueMatcher) (bool, error) {
-	machineInstance, err := s.GetInstance(project, zone, instance)
+func (s *googleService) TestStatus(ctx context.Context, project string, zone string, instance string, value interface{}, valueMatcher *gcloudValueMatcher) (bool, error) {
+	machineInstance, err := s.GetInstance(ctx, project, zone, instance)
 	if err != nil {
 		return false, err
 	}
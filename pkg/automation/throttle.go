@@ -0,0 +1,492 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/sqladmin/v1beta4"
+)
+
+// ThrottleConfig configures adaptive concurrency of calls to each API.
+// Calls failed with errors for which IsRetryable returns true burn the error budget.
+// If more than ErrorBudget of at least MinCalls calls in the last Window failed,
+// the concurrency is halved, but not below MinConcurrency.
+// While the budget is not exceeded, the concurrency grows by one every RecoveryInterval up to MaxConcurrency.
+type ThrottleConfig struct {
+	Window           time.Duration
+	ErrorBudget      float64
+	MinCalls         int
+	MinConcurrency   int
+	MaxConcurrency   int
+	RecoveryInterval time.Duration
+}
+
+// DefaultThrottleConfig returns the configuration used if nil is passed to NewThrottlingService.
+func DefaultThrottleConfig() *ThrottleConfig {
+	return &ThrottleConfig{
+		Window:           time.Minute,
+		ErrorBudget:      0.05,
+		MinCalls:         20,
+		MinConcurrency:   1,
+		MaxConcurrency:   defaultApplyParallelism,
+		RecoveryInterval: 10 * time.Second,
+	}
+}
+
+// callOutcome is the result of one call recorded by adaptiveLimiter.
+type callOutcome struct {
+	time   time.Time
+	failed bool
+}
+
+// adaptiveLimiter limits the number of concurrent calls to one API,
+// adjusting the limit to the error rate of the calls.
+type adaptiveLimiter struct {
+	config     *ThrottleConfig
+	now        func() time.Time
+	mutex      sync.Mutex
+	limit      int
+	active     int
+	outcomes   []callOutcome // calls finished in the last Window, oldest first
+	lastChange time.Time
+	released   chan struct{} // closed when a call may be able to start
+}
+
+func newAdaptiveLimiter(config *ThrottleConfig, now func() time.Time) *adaptiveLimiter {
+	return &adaptiveLimiter{
+		config:     config,
+		now:        now,
+		limit:      config.MaxConcurrency,
+		lastChange: now(),
+		released:   make(chan struct{}),
+	}
+}
+
+// wake lets waiting calls check if they can start. Must be called with the mutex held.
+func (l *adaptiveLimiter) wake() {
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+// acquire waits until the call can start or ctx is done.
+func (l *adaptiveLimiter) acquire(ctx context.Context) error {
+	for {
+		l.mutex.Lock()
+		if l.active < l.limit {
+			l.active++
+			l.mutex.Unlock()
+			return nil
+		}
+		released := l.released
+		l.mutex.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-released:
+		}
+	}
+}
+
+// release records the result of the finished call and adjusts the limit.
+func (l *adaptiveLimiter) release(err error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.active--
+	now := l.now()
+	l.outcomes = append(l.outcomes, callOutcome{time: now, failed: err != nil && IsRetryable(err)})
+	for len(l.outcomes) > 0 && now.Sub(l.outcomes[0].time) > l.config.Window {
+		l.outcomes = l.outcomes[1:]
+	}
+	failed := 0
+	for _, outcome := range l.outcomes {
+		if outcome.failed {
+			failed++
+		}
+	}
+
+	if len(l.outcomes) >= l.config.MinCalls && float64(failed) > l.config.ErrorBudget*float64(len(l.outcomes)) {
+		l.limit /= 2
+		if l.limit < l.config.MinConcurrency {
+			l.limit = l.config.MinConcurrency
+		}
+		// the window starts over, so that the same failures don't reduce the limit again
+		l.outcomes = nil
+		l.lastChange = now
+	} else if l.limit < l.config.MaxConcurrency && now.Sub(l.lastChange) >= l.config.RecoveryInterval {
+		l.limit++
+		l.lastChange = now
+	}
+	l.wake()
+}
+
+// currentLimit returns the current limit of concurrent calls.
+func (l *adaptiveLimiter) currentLimit() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.limit
+}
+
+// throttlingService implements GoogleService interface limiting concurrent calls of the wrapped service,
+// separately for each API, see ThrottleConfig.
+type throttlingService struct {
+	service  GoogleService
+	limiters map[string]*adaptiveLimiter
+}
+
+// NewThrottlingService creates new GoogleService limiting concurrency of calls of service to each API,
+// reducing it when the calls burn the error budget too fast and recovering gradually.
+// It is meant to be wrapped by NewRetryingService, i.e. NewRetryingService(NewThrottlingService(service, nil), nil),
+// so that each retry passes the limiter, counts against the budget and is throttled too,
+// when applying recommendations to large fleets.
+// If config is nil, DefaultThrottleConfig is used.
+func NewThrottlingService(service GoogleService, config *ThrottleConfig) GoogleService {
+	if config == nil {
+		config = DefaultThrottleConfig()
+	}
+	return newThrottlingService(service, config, time.Now)
+}
+
+func newThrottlingService(service GoogleService, config *ThrottleConfig, now func() time.Time) *throttlingService {
+	limiters := make(map[string]*adaptiveLimiter)
+	for _, api := range []string{computeAPI, recommenderAPI, resourceManagerAPI, serviceUsageAPI, sqlAdminAPI, iamAPI} {
+		limiters[api] = newAdaptiveLimiter(config, now)
+	}
+	return &throttlingService{service: service, limiters: limiters}
+}
+
+// do calls f when the limiter of api allows it.
+func (s *throttlingService) do(ctx context.Context, api string, f func() error) error {
+	limiter := s.limiters[api]
+	err := limiter.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	err = f()
+	limiter.release(err)
+	return err
+}
+
+func (s *throttlingService) ChangeMachineType(ctx context.Context, project, zone, instance, machineType string) error {
+	return s.do(ctx, computeAPI, func() error {
+		return s.service.ChangeMachineType(ctx, project, zone, instance, machineType)
+	})
+}
+
+func (s *throttlingService) ChangeSQLInstanceTier(ctx context.Context, project, instance, tier string) error {
+	return s.do(ctx, sqlAdminAPI, func() error {
+		return s.service.ChangeSQLInstanceTier(ctx, project, instance, tier)
+	})
+}
+
+func (s *throttlingService) CreateRegionalSnapshot(ctx context.Context, project, region, disk, name string) error {
+	return s.do(ctx, computeAPI, func() error {
+		return s.service.CreateRegionalSnapshot(ctx, project, region, disk, name)
+	})
+}
+
+func (s *throttlingService) CreateSnapshot(ctx context.Context, project, zone, disk, name string) error {
+	return s.do(ctx, computeAPI, func() error {
+		return s.service.CreateSnapshot(ctx, project, zone, disk, name)
+	})
+}
+
+func (s *throttlingService) DeleteDisk(ctx context.Context, project, zone, disk string) error {
+	return s.do(ctx, computeAPI, func() error {
+		return s.service.DeleteDisk(ctx, project, zone, disk)
+	})
+}
+
+func (s *throttlingService) DeleteImage(ctx context.Context, project, image string) error {
+	return s.do(ctx, computeAPI, func() error {
+		return s.service.DeleteImage(ctx, project, image)
+	})
+}
+
+func (s *throttlingService) DeleteInstance(ctx context.Context, project, zone, instance string) error {
+	return s.do(ctx, computeAPI, func() error {
+		return s.service.DeleteInstance(ctx, project, zone, instance)
+	})
+}
+
+func (s *throttlingService) DeleteProject(ctx context.Context, project string) error {
+	return s.do(ctx, resourceManagerAPI, func() error {
+		return s.service.DeleteProject(ctx, project)
+	})
+}
+
+func (s *throttlingService) DeleteRegionalDisk(ctx context.Context, project, region, disk string) error {
+	return s.do(ctx, computeAPI, func() error {
+		return s.service.DeleteRegionalDisk(ctx, project, region, disk)
+	})
+}
+
+func (s *throttlingService) DeleteSnapshot(ctx context.Context, project, snapshot string) error {
+	return s.do(ctx, computeAPI, func() error {
+		return s.service.DeleteSnapshot(ctx, project, snapshot)
+	})
+}
+
+func (s *throttlingService) GetDisk(ctx context.Context, project, zone, disk string) (*compute.Disk, error) {
+	var result *compute.Disk
+	err := s.do(ctx, computeAPI, func() (err error) {
+		result, err = s.service.GetDisk(ctx, project, zone, disk)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) GetImage(ctx context.Context, project, image string) (*compute.Image, error) {
+	var result *compute.Image
+	err := s.do(ctx, computeAPI, func() (err error) {
+		result, err = s.service.GetImage(ctx, project, image)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) GetInstance(ctx context.Context, project, zone, instance string) (*compute.Instance, error) {
+	var result *compute.Instance
+	err := s.do(ctx, computeAPI, func() (err error) {
+		result, err = s.service.GetInstance(ctx, project, zone, instance)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) GetRegionalDisk(ctx context.Context, project, region, disk string) (*compute.Disk, error) {
+	var result *compute.Disk
+	err := s.do(ctx, computeAPI, func() (err error) {
+		result, err = s.service.GetRegionalDisk(ctx, project, region, disk)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) GetSQLInstance(ctx context.Context, project, instance string) (*sqladmin.DatabaseInstance, error) {
+	var result *sqladmin.DatabaseInstance
+	err := s.do(ctx, sqlAdminAPI, func() (err error) {
+		result, err = s.service.GetSQLInstance(ctx, project, instance)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) GetProjectIAMPolicy(ctx context.Context, project string) (*cloudresourcemanager.Policy, error) {
+	var result *cloudresourcemanager.Policy
+	err := s.do(ctx, resourceManagerAPI, func() (err error) {
+		result, err = s.service.GetProjectIAMPolicy(ctx, project)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) GetRolePermissions(ctx context.Context, role string) ([]string, error) {
+	var result []string
+	err := s.do(ctx, iamAPI, func() (err error) {
+		result, err = s.service.GetRolePermissions(ctx, role)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) GetRecommendation(ctx context.Context, name string) (*gcloudRecommendation, error) {
+	var result *gcloudRecommendation
+	err := s.do(ctx, recommenderAPI, func() (err error) {
+		result, err = s.service.GetRecommendation(ctx, name)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) GetProjectAncestry(ctx context.Context, project string) ([]string, error) {
+	var result []string
+	err := s.do(ctx, resourceManagerAPI, func() (err error) {
+		result, err = s.service.GetProjectAncestry(ctx, project)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) ListAPIRequirements(ctx context.Context, project string, apis []string) ([]*Requirement, error) {
+	var result []*Requirement
+	err := s.do(ctx, serviceUsageAPI, func() (err error) {
+		result, err = s.service.ListAPIRequirements(ctx, project, apis)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) ListPermissionRequirements(ctx context.Context, project string, permissions [][]string) ([]*Requirement, error) {
+	var result []*Requirement
+	err := s.do(ctx, resourceManagerAPI, func() (err error) {
+		result, err = s.service.ListPermissionRequirements(ctx, project, permissions)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) ListDisks(ctx context.Context, project, zone, filter string) ([]*compute.Disk, error) {
+	var result []*compute.Disk
+	err := s.do(ctx, computeAPI, func() (err error) {
+		result, err = s.service.ListDisks(ctx, project, zone, filter)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) ListImages(ctx context.Context, project, filter string) ([]*compute.Image, error) {
+	var result []*compute.Image
+	err := s.do(ctx, computeAPI, func() (err error) {
+		result, err = s.service.ListImages(ctx, project, filter)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) ListInstances(ctx context.Context, project, zone string) ([]*compute.Instance, error) {
+	var result []*compute.Instance
+	err := s.do(ctx, computeAPI, func() (err error) {
+		result, err = s.service.ListInstances(ctx, project, zone)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) ListMachineTypes(ctx context.Context, project, zone string) ([]*compute.MachineType, error) {
+	var result []*compute.MachineType
+	err := s.do(ctx, computeAPI, func() (err error) {
+		result, err = s.service.ListMachineTypes(ctx, project, zone)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) ListOrganizationRecommendations(ctx context.Context, organization, location, recommenderID string) ([]*gcloudRecommendation, error) {
+	var result []*gcloudRecommendation
+	err := s.do(ctx, recommenderAPI, func() (err error) {
+		result, err = s.service.ListOrganizationRecommendations(ctx, organization, location, recommenderID)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) ListProjects(ctx context.Context) ([]string, error) {
+	var result []string
+	err := s.do(ctx, resourceManagerAPI, func() (err error) {
+		result, err = s.service.ListProjects(ctx)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) ListRecommendations(ctx context.Context, project, location, recommenderID string) ([]*gcloudRecommendation, error) {
+	var result []*gcloudRecommendation
+	err := s.do(ctx, recommenderAPI, func() (err error) {
+		result, err = s.service.ListRecommendations(ctx, project, location, recommenderID)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) ListSnapshots(ctx context.Context, project, filter string) ([]*compute.Snapshot, error) {
+	var result []*compute.Snapshot
+	err := s.do(ctx, computeAPI, func() (err error) {
+		result, err = s.service.ListSnapshots(ctx, project, filter)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) ListZonesNames(ctx context.Context, project string) ([]string, error) {
+	var result []string
+	err := s.do(ctx, computeAPI, func() (err error) {
+		result, err = s.service.ListZonesNames(ctx, project)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) ListRegionsNames(ctx context.Context, project string) ([]string, error) {
+	var result []string
+	err := s.do(ctx, computeAPI, func() (err error) {
+		result, err = s.service.ListRegionsNames(ctx, project)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) MarkRecommendationClaimed(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	var result *gcloudRecommendation
+	err := s.do(ctx, recommenderAPI, func() (err error) {
+		result, err = s.service.MarkRecommendationClaimed(ctx, name, etag)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) MarkRecommendationFailed(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	var result *gcloudRecommendation
+	err := s.do(ctx, recommenderAPI, func() (err error) {
+		result, err = s.service.MarkRecommendationFailed(ctx, name, etag)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) MarkRecommendationSucceeded(ctx context.Context, name, etag string) (*gcloudRecommendation, error) {
+	var result *gcloudRecommendation
+	err := s.do(ctx, recommenderAPI, func() (err error) {
+		result, err = s.service.MarkRecommendationSucceeded(ctx, name, etag)
+		return err
+	})
+	return result, err
+}
+
+func (s *throttlingService) SetDiskLabels(ctx context.Context, project, zone, disk string, labels map[string]string, fingerprint string) error {
+	return s.do(ctx, computeAPI, func() error {
+		return s.service.SetDiskLabels(ctx, project, zone, disk, labels, fingerprint)
+	})
+}
+
+func (s *throttlingService) SetProjectIAMPolicy(ctx context.Context, project string, policy *cloudresourcemanager.Policy) error {
+	return s.do(ctx, resourceManagerAPI, func() error {
+		return s.service.SetProjectIAMPolicy(ctx, project, policy)
+	})
+}
+
+func (s *throttlingService) StartInstance(ctx context.Context, project, zone, instance string) error {
+	return s.do(ctx, computeAPI, func() error {
+		return s.service.StartInstance(ctx, project, zone, instance)
+	})
+}
+
+func (s *throttlingService) StopInstance(ctx context.Context, project, zone, instance string) error {
+	return s.do(ctx, computeAPI, func() error {
+		return s.service.StopInstance(ctx, project, zone, instance)
+	})
+}
+
+func (s *throttlingService) StopSQLInstance(ctx context.Context, project, instance string) error {
+	return s.do(ctx, sqlAdminAPI, func() error {
+		return s.service.StopSQLInstance(ctx, project, instance)
+	})
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/googleapi"
+)
+
+// mockClock is the time of the test, advanced manually.
+type mockClock struct {
+	mutex sync.Mutex
+	time  time.Time
+}
+
+func (c *mockClock) now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.time
+}
+
+func (c *mockClock) advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.time = c.time.Add(d)
+}
+
+var testThrottleConfig = &ThrottleConfig{
+	Window:           time.Minute,
+	ErrorBudget:      0.1,
+	MinCalls:         10,
+	MinConcurrency:   1,
+	MaxConcurrency:   8,
+	RecoveryInterval: 10 * time.Second,
+}
+
+func TestThrottlingServiceErrorBudget(t *testing.T) {
+	clock := &mockClock{time: time.Unix(0, 0)}
+	flaky := &mockFlakyService{errs: []error{
+		&googleapi.Error{Code: http.StatusTooManyRequests},
+		&googleapi.Error{Code: http.StatusTooManyRequests},
+	}}
+	service := newThrottlingService(flaky, testThrottleConfig, clock.now)
+	limiter := service.limiters[computeAPI]
+	for i := 0; i < 9; i++ {
+		service.StopInstance(context.Background(), "p", "z", "i")
+	}
+	assert.Equal(t, 8, limiter.currentLimit(), "Concurrency should not be reduced before MinCalls calls")
+	service.StopInstance(context.Background(), "p", "z", "i")
+	assert.Equal(t, 4, limiter.currentLimit(), "Concurrency should be halved when the budget is exceeded")
+	assert.Equal(t, 8, service.limiters[recommenderAPI].currentLimit(), "Other APIs should not be throttled")
+
+	service.StopInstance(context.Background(), "p", "z", "i")
+	assert.Equal(t, 4, limiter.currentLimit(), "Concurrency should not recover before RecoveryInterval")
+	clock.advance(10 * time.Second)
+	service.StopInstance(context.Background(), "p", "z", "i")
+	assert.Equal(t, 5, limiter.currentLimit(), "Concurrency should recover gradually")
+	clock.advance(10 * time.Second)
+	service.StopInstance(context.Background(), "p", "z", "i")
+	assert.Equal(t, 6, limiter.currentLimit())
+}
+
+func TestThrottlingServicePermanentErrors(t *testing.T) {
+	notFound := &googleapi.Error{Code: http.StatusNotFound}
+	flaky := &mockFlakyService{errs: []error{notFound, notFound, notFound, notFound, notFound,
+		notFound, notFound, notFound, notFound, notFound}}
+	service := newThrottlingService(flaky, testThrottleConfig, time.Now)
+	for i := 0; i < 10; i++ {
+		err := service.StopInstance(context.Background(), "p", "z", "i")
+		assert.Equal(t, notFound, err, "Errors should be returned unchanged")
+	}
+	assert.Equal(t, 8, service.limiters[computeAPI].currentLimit(), "Permanent errors should not burn the budget")
+}
+
+func TestThrottlingServiceRetries(t *testing.T) {
+	flaky := &mockFlakyService{errs: []error{
+		&googleapi.Error{Code: http.StatusTooManyRequests},
+		&googleapi.Error{Code: http.StatusTooManyRequests},
+	}}
+	config := *testThrottleConfig
+	config.MinCalls = 3
+	config.ErrorBudget = 0.5
+	throttling := newThrottlingService(flaky, &config, time.Now)
+	err := NewRetryingService(throttling, testRetryConfig).StopInstance(context.Background(), "p", "z", "i")
+	assert.NoError(t, err, "Call should succeed after retries")
+	assert.Equal(t, 3, flaky.calls)
+	assert.Equal(t, 4, throttling.limiters[computeAPI].currentLimit(), "Retried calls should burn the budget")
+}
+
+func TestAdaptiveLimiterAcquire(t *testing.T) {
+	limiter := newAdaptiveLimiter(&ThrottleConfig{MinConcurrency: 1, MaxConcurrency: 1, Window: time.Minute}, time.Now)
+	assert.NoError(t, limiter.acquire(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, limiter.acquire(ctx), "Call should wait for a free slot")
+
+	acquired := make(chan error)
+	go func() {
+		acquired <- limiter.acquire(context.Background())
+	}()
+	limiter.release(nil)
+	assert.NoError(t, <-acquired, "Waiting call should start after release")
+}
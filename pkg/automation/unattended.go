@@ -0,0 +1,133 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/recommender/v1"
+)
+
+const projectUtilizationRecommenderID = "google.resourcemanager.projectUtilization.Recommender"
+
+const (
+	// ReclaimProject is the action suggested for unattended projects that are used, but have no active owner
+	ReclaimProject = "RECLAIM_PROJECT"
+	// CleanupProject is the action suggested for unattended projects that are not used
+	CleanupProject = "CLEANUP_PROJECT"
+)
+
+// ListOrganizationRecommendations returns the list of recommendations for specified organization, location and recommender.
+// projects.locations.recommenders.recommendations/list method from Recommender API is used with the organization as parent,
+// the client library has no separate organizations service.
+// If the error occurred the returned error is not nil.
+func (s *googleService) ListOrganizationRecommendations(ctx context.Context, organization, location, recommenderID string) ([]*gcloudRecommendation, error) {
+	recommendationsService := recommender.NewProjectsLocationsRecommendersRecommendationsService(s.recommenderService)
+	listCall := recommendationsService.List(fmt.Sprintf("organizations/%s/locations/%s/recommenders/%s", organization, location, recommenderID))
+	var recommendations []*gcloudRecommendation
+	err := listCall.Pages(ctx, func(response *recommender.GoogleCloudRecommenderV1ListRecommendationsResponse) error {
+		recommendations = append(recommendations, response.Recommendations...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return recommendations, nil
+}
+
+// DeleteProject calls the projects.delete method of Resource Manager API.
+// The project is marked for deletion and can be restored within 30 days.
+// Requires resourcemanager.projects.delete permission.
+func (s *googleService) DeleteProject(ctx context.Context, project string) error {
+	projectsService := cloudresourcemanager.NewProjectsService(s.resourceManagerService)
+	_, err := projectsService.Delete(project).Context(ctx).Do()
+	return err
+}
+
+// UnattendedProject describes the recommendation of google.resourcemanager.projectUtilization.Recommender.
+// Action is ReclaimProject or CleanupProject. Only CleanupProject can be applied, by deleting the project,
+// and only with WithProjectDeletion option.
+type UnattendedProject struct {
+	Recommendation string `json:"recommendation"`
+	Project        string `json:"project"`
+	Action         string `json:"action"`
+	Description    string `json:"description"`
+}
+
+// ListUnattendedProjects returns unattended projects of the organization, e.g. "123456789".
+// Requires recommender.resourcemanagerProjectUtilizationRecommendations.list permission for the organization.
+// At most one of returned values will be non-nil.
+func ListUnattendedProjects(ctx context.Context, service GoogleService, organization string) ([]*UnattendedProject, error) {
+	recs, err := service.ListOrganizationRecommendations(ctx, organization, "global", projectUtilizationRecommenderID)
+	if err != nil {
+		return nil, err
+	}
+	var result []*UnattendedProject
+	for _, rec := range recs {
+		project, err := DescribeUnattendedProject(rec)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, project)
+	}
+	return result, nil
+}
+
+// DescribeUnattendedProject returns the project and the action suggested by the recommendation
+// of google.resourcemanager.projectUtilization.Recommender.
+// At most one of returned values will be non-nil.
+func DescribeUnattendedProject(rec *gcloudRecommendation) (*UnattendedProject, error) {
+	if rec.RecommenderSubtype != ReclaimProject && rec.RecommenderSubtype != CleanupProject {
+		return nil, fmt.Errorf("recommendation %s has unexpected subtype %s", rec.Name, rec.RecommenderSubtype)
+	}
+	result := &UnattendedProject{Recommendation: rec.Name, Action: rec.RecommenderSubtype, Description: rec.Description}
+	if rec.Content != nil {
+		for _, group := range rec.Content.OperationGroups {
+			for _, operation := range group.Operations {
+				if match := projectResourceRegexp.FindStringSubmatch(operation.Resource); match != nil {
+					result.Project = match[1]
+				}
+			}
+		}
+	}
+	if result.Project == "" {
+		return nil, fmt.Errorf("recommendation %s doesn't name the project", rec.Name)
+	}
+	return result, nil
+}
+
+// planProjectOperation returns the call applying the operation of the unattended project recommendation.
+// Only removing the project is supported.
+func planProjectOperation(operation *gcloudOperation) (*OperationCall, error) {
+	match := projectResourceRegexp.FindStringSubmatch(operation.Resource)
+	if match == nil || operation.Action != "remove" || operation.Path != "/" {
+		return nil, fmt.Errorf("%w: %s %s of %s", ErrOperationNotSupported, operation.Action, operation.Path, operation.Resource)
+	}
+	return &OperationCall{deleteProjectMethod, match[1], "", match[1], ""}, nil
+}
+
+// WithProjectDeletion confirms that Apply may delete projects, applying recommendations of
+// google.resourcemanager.projectUtilization.Recommender to clean up unattended projects.
+// Without it, Apply wraps ErrConfirmationRequired for such recommendations, unless in dry run,
+// and DoOperation always does.
+func WithProjectDeletion() ApplyOption {
+	return func(c *applyConfig) {
+		c.projectDeletion = true
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mockUnattendedService is mockApplyService listing unattended projects and recording their deletion.
+type mockUnattendedService struct {
+	*mockApplyService
+	parents []string
+}
+
+func (s *mockUnattendedService) DeleteProject(ctx context.Context, project string) error {
+	s.calls = append(s.calls, "DeleteProject "+project)
+	return nil
+}
+
+func (s *mockUnattendedService) ListOrganizationRecommendations(ctx context.Context, organization, location, recommenderID string) ([]*gcloudRecommendation, error) {
+	s.parents = append(s.parents, "organizations/"+organization+"/locations/"+location+"/recommenders/"+recommenderID)
+	reclaim := cleanupProjectRecommendation()
+	reclaim.RecommenderSubtype = ReclaimProject
+	return []*gcloudRecommendation{cleanupProjectRecommendation(), reclaim}, nil
+}
+
+func cleanupProjectRecommendation() *gcloudRecommendation {
+	rec := makeRecommendation("organizations/o/locations/global/recommenders/google.resourcemanager.projectUtilization.Recommender/recommendations/r", 10,
+		&gcloudOperation{Action: "remove", Path: "/", Resource: testProject, ResourceType: projectResourceType})
+	rec.RecommenderSubtype = CleanupProject
+	rec.StateInfo = &gcloudStateInfo{State: "ACTIVE"}
+	return rec
+}
+
+func TestListUnattendedProjects(t *testing.T) {
+	service := &mockUnattendedService{mockApplyService: newMockApplyService()}
+	projects, err := ListUnattendedProjects(context.Background(), service, "o")
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"organizations/o/locations/global/recommenders/google.resourcemanager.projectUtilization.Recommender"}, service.parents)
+		assert.Equal(t, 2, len(projects))
+		assert.Equal(t, &UnattendedProject{Recommendation: cleanupProjectRecommendation().Name, Project: "p", Action: CleanupProject}, projects[0])
+		assert.Equal(t, ReclaimProject, projects[1].Action)
+	}
+}
+
+func TestApplyCleanupProjectRecommendation(t *testing.T) {
+	service := &mockUnattendedService{mockApplyService: newMockApplyService()}
+	_, err := Apply(context.Background(), service, cleanupProjectRecommendation())
+	assert.True(t, errors.Is(err, ErrConfirmationRequired), "Project shouldn't be deleted without the option")
+	assert.Empty(t, service.calls)
+
+	_, err = Apply(context.Background(), service, cleanupProjectRecommendation(), WithProjectDeletion())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"DeleteProject p"}, service.calls)
+	assert.Equal(t, []string{"CLAIMED", "SUCCEEDED"}, service.marks)
+}
+
+func TestDoOperationProjectDeletion(t *testing.T) {
+	service := &mockUnattendedService{mockApplyService: newMockApplyService()}
+	operation := cleanupProjectRecommendation().Content.OperationGroups[0].Operations[0]
+	err := DoOperation(context.Background(), service, operation)
+	assert.True(t, errors.Is(err, ErrConfirmationRequired), "DoOperation shouldn't delete projects")
+	assert.Empty(t, service.calls, "Project shouldn't be deleted")
+}
@@ -0,0 +1,223 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"google.golang.org/api/recommender/v1"
+)
+
+type gcloudStateInfo = recommender.GoogleCloudRecommenderV1RecommendationStateInfo
+
+const (
+	instanceResourceType = "compute.googleapis.com/Instance"
+	diskResourceType     = "compute.googleapis.com/Disk"
+	snapshotResourceType = "compute.googleapis.com/Snapshot"
+	imageResourceType    = "compute.googleapis.com/Image"
+
+	sqlInstanceResourceType = "sqladmin.googleapis.com/Instance"
+	projectResourceType     = "cloudresourcemanager.googleapis.com/Project"
+)
+
+// operationShape describes an operation expected in recommendations of some recommender.
+type operationShape struct {
+	action       string
+	resourceType string
+	path         string
+}
+
+// expectedOperations lists operations that recommendations of each supported recommender can contain.
+var expectedOperations = map[string][]operationShape{
+	"google.compute.instance.MachineTypeRecommender": {
+		{"test", instanceResourceType, "/machineType"},
+		{"test", instanceResourceType, "/status"},
+		{"replace", instanceResourceType, "/machineType"},
+		{"replace", instanceResourceType, "/status"},
+	},
+	"google.compute.instance.IdleResourceRecommender": {
+		{"test", instanceResourceType, "/status"},
+		{"replace", instanceResourceType, "/status"},
+		{"remove", instanceResourceType, "/"},
+	},
+	"google.compute.disk.IdleResourceRecommender": {
+		{"add", snapshotResourceType, "/"},
+		{"remove", diskResourceType, "/"},
+	},
+	"google.compute.image.IdleResourceRecommender": {
+		{"remove", imageResourceType, "/"},
+	},
+	iamRecommenderID: {
+		{"add", projectResourceType, iamAddMemberPath},
+		{"remove", projectResourceType, iamMemberPath},
+	},
+	projectUtilizationRecommenderID: {
+		{"remove", projectResourceType, "/"},
+	},
+	"google.cloudsql.instance.IdleRecommender": {
+		{"test", sqlInstanceResourceType, "/state"},
+		{"test", sqlInstanceResourceType, "/settings/activationPolicy"},
+		{"replace", sqlInstanceResourceType, "/state"},
+		{"replace", sqlInstanceResourceType, "/settings/activationPolicy"},
+	},
+	"google.cloudsql.instance.OverprovisionedRecommender": {
+		{"test", sqlInstanceResourceType, "/state"},
+		{"test", sqlInstanceResourceType, "/settings/tier"},
+		{"replace", sqlInstanceResourceType, "/settings/tier"},
+	},
+}
+
+var recommendationStates = []string{"ACTIVE", "CLAIMED", "SUCCEEDED", "FAILED", "DISMISSED"}
+
+var recommendationNameRegexp = regexp.MustCompile("^(?:projects|organizations)/[^/]+/locations/[^/]+/recommenders/([^/]+)/recommendations/[^/]+$")
+
+// ValidationError contains all problems found in the recommendation.
+// Every problem starts with the path to the field, e.g. "content.operationGroups[0].operations[1].action".
+type ValidationError struct {
+	Recommendation string
+	Problems       []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("recommendation %s has unexpected shape: %s", e.Recommendation, strings.Join(e.Problems, "; "))
+}
+
+// recommenderID returns the ID of the recommender from the name of the recommendation.
+func recommenderID(name string) (string, bool) {
+	match := recommendationNameRegexp.FindStringSubmatch(name)
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
+
+// validateOperation returns problems found in the operation,
+// if recommenderName is empty, the operation is not checked against expected shapes.
+func validateOperation(path string, operation *gcloudOperation, recommenderName string) []string {
+	if operation == nil {
+		return []string{path + ": operation must not be null"}
+	}
+
+	var problems []string
+	if operation.Resource == "" {
+		problems = append(problems, path+".resource: must not be empty")
+	}
+	if recommenderName != "" {
+		known := false
+		for _, shape := range expectedOperations[recommenderName] {
+			known = known || shape == operationShape{operation.Action, operation.ResourceType, operation.Path}
+		}
+		if !known {
+			problems = append(problems, fmt.Sprintf("%s: unexpected operation %s %s of %s for %s",
+				path, operation.Action, operation.Path, operation.ResourceType, recommenderName))
+		}
+	}
+
+	switch operation.Action {
+	case "test":
+		if operation.Value == nil && operation.ValueMatcher == nil {
+			problems = append(problems, path+": either value or valueMatcher must be set for test operations")
+		}
+		if _, ok := operation.Value.(string); operation.Value != nil && !ok {
+			problems = append(problems, fmt.Sprintf("%s.value: expected string, got %T", path, operation.Value))
+		}
+	case "replace":
+		if _, ok := operation.Value.(string); !ok {
+			problems = append(problems, fmt.Sprintf("%s.value: expected string, got %T", path, operation.Value))
+		}
+	case "add":
+		if _, ok := operation.Value.(string); operation.ResourceType == projectResourceType && !ok {
+			problems = append(problems, fmt.Sprintf("%s.value: expected string, got %T", path, operation.Value))
+		}
+		if _, ok := operation.Value.(map[string]interface{}); operation.ResourceType != projectResourceType && !ok {
+			problems = append(problems, fmt.Sprintf("%s.value: expected object, got %T", path, operation.Value))
+		}
+	}
+	return problems
+}
+
+// ValidateRecommendation checks that the recommendation has the shape expected
+// for its recommender, so that it can be processed safely.
+// If the recommendation is valid, nil is returned, otherwise the error is *ValidationError.
+func ValidateRecommendation(rec *gcloudRecommendation) error {
+	if rec == nil {
+		return &ValidationError{Problems: []string{"recommendation must not be null"}}
+	}
+
+	var problems []string
+	recommenderName, ok := recommenderID(rec.Name)
+	if !ok {
+		problems = append(problems, fmt.Sprintf("name: unexpected format %q", rec.Name))
+	} else if _, ok := expectedOperations[recommenderName]; !ok {
+		problems = append(problems, fmt.Sprintf("name: recommender %s is not supported", recommenderName))
+		recommenderName = ""
+	}
+
+	if rec.StateInfo == nil {
+		problems = append(problems, "stateInfo: must be set")
+	} else {
+		known := false
+		for _, state := range recommendationStates {
+			known = known || state == rec.StateInfo.State
+		}
+		if !known {
+			problems = append(problems, fmt.Sprintf("stateInfo.state: unexpected value %q", rec.StateInfo.State))
+		}
+	}
+
+	if rec.Content == nil {
+		problems = append(problems, "content: must be set")
+	} else {
+		if len(rec.Content.OperationGroups) == 0 {
+			problems = append(problems, "content.operationGroups: must not be empty")
+		}
+		for i, group := range rec.Content.OperationGroups {
+			groupPath := fmt.Sprintf("content.operationGroups[%d]", i)
+			if group == nil || len(group.Operations) == 0 {
+				problems = append(problems, groupPath+".operations: must not be empty")
+				continue
+			}
+			for j, operation := range group.Operations {
+				operationPath := fmt.Sprintf("%s.operations[%d]", groupPath, j)
+				problems = append(problems, validateOperation(operationPath, operation, recommenderName)...)
+			}
+		}
+	}
+
+	if len(problems) != 0 {
+		return &ValidationError{Recommendation: rec.Name, Problems: problems}
+	}
+	return nil
+}
+
+// ParseRecommendation decodes the recommendation from JSON and validates it.
+// At most one of returned values will be non-nil.
+func ParseRecommendation(data []byte) (*gcloudRecommendation, error) {
+	var rec gcloudRecommendation
+	err := json.Unmarshal(data, &rec)
+	if err != nil {
+		return nil, err
+	}
+	err = ValidateRecommendation(&rec)
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const diskRecommendationJSON = `{
+	"content": {
+		"operationGroups": [
+			{
+				"operations": [
+					{
+						"action": "add",
+						"path": "/",
+						"resource": "//compute.googleapis.com/projects/rightsizer-test/global/snapshots/$snapshot-name",
+						"resourceType": "compute.googleapis.com/Snapshot",
+						"value": {
+							"name": "$snapshot-name",
+							"source_disk": "projects/rightsizer-test/zones/europe-west1-d/disks/krzysztofk2",
+							"storage_locations": ["europe-west1-d"]
+						}
+					},
+					{
+						"action": "remove",
+						"path": "/",
+						"resource": "//compute.googleapis.com/projects/rightsizer-test/zones/europe-west1-d/disks/krzysztofk2",
+						"resourceType": "compute.googleapis.com/Disk"
+					}
+				]
+			}
+		]
+	},
+	"etag": "\"4159bea4e7c90c00\"",
+	"name": "projects/323016592286/locations/europe-west1-d/recommenders/google.compute.disk.IdleResourceRecommender/recommendations/8962f57e-10c6-47cc-a48e-52e9f0f800c5",
+	"stateInfo": {
+		"state": "ACTIVE"
+	}
+}`
+
+func TestParseValidRecommendation(t *testing.T) {
+	rec, err := ParseRecommendation([]byte(diskRecommendationJSON))
+	if assert.NoError(t, err, "Recommendation from Recommender API should be valid") {
+		assert.Equal(t, "ACTIVE", rec.StateInfo.State)
+	}
+}
+
+func TestParseMalformedRecommendation(t *testing.T) {
+	rec, err := ParseRecommendation([]byte(`{"content": []}`))
+	assert.Error(t, err, "Wrong JSON types should result in error")
+	assert.Nil(t, rec, "Only one of returned values should be non-nil")
+}
+
+func TestValidateRecommendationProblems(t *testing.T) {
+	rec := makeRecommendation("projects/p/locations/l/recommenders/google.compute.instance.IdleResourceRecommender/recommendations/r", 1,
+		&gcloudOperation{Action: "test", Path: "/status", Resource: testInstance, ResourceType: instanceResourceType},
+		&gcloudOperation{Action: "replace", Path: "/status", Resource: testInstance, ResourceType: instanceResourceType, Value: 5},
+		&gcloudOperation{Action: "replace", Path: "/machineType", Resource: testInstance, ResourceType: instanceResourceType, Value: "n1-standard-1"},
+		nil)
+	err := ValidateRecommendation(rec)
+	if assert.IsType(t, &ValidationError{}, err) {
+		assert.Equal(t, []string{
+			"stateInfo: must be set",
+			"content.operationGroups[0].operations[0]: either value or valueMatcher must be set for test operations",
+			"content.operationGroups[0].operations[1].value: expected string, got int",
+			"content.operationGroups[0].operations[2]: unexpected operation replace /machineType of compute.googleapis.com/Instance for google.compute.instance.IdleResourceRecommender",
+			"content.operationGroups[0].operations[3]: operation must not be null",
+		}, err.(*ValidationError).Problems)
+	}
+}
+
+func TestValidateRecommendationName(t *testing.T) {
+	for _, name := range []string{"", "projects/p/locations/l/recommenders/google.unknown.Recommender/recommendations/r"} {
+		rec := stopInstanceRecommendation(name, 1)
+		rec.StateInfo = &gcloudStateInfo{State: "ACTIVE"}
+		err := ValidateRecommendation(rec)
+		if assert.IsType(t, &ValidationError{}, err) {
+			assert.Equal(t, 1, len(err.(*ValidationError).Problems), "Only name should be invalid")
+		}
+	}
+	assert.Error(t, ValidateRecommendation(nil))
+}
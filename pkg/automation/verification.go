@@ -0,0 +1,219 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+// Verification is the result of checking the applied recommendation some time later.
+// Regressions describe what is not in the state the recommendation was applied to.
+type Verification struct {
+	Recommendation string   `json:"recommendation"`
+	Regressions    []string `json:"regressions"`
+}
+
+// Passed returns whether no regressions were found.
+func (v *Verification) Passed() bool {
+	return len(v.Regressions) == 0
+}
+
+// isNotFound returns whether err is the googleapi error with status 404.
+func isNotFound(err error) bool {
+	var googleErr *googleapi.Error
+	return errors.As(err, &googleErr) && googleErr.Code == http.StatusNotFound
+}
+
+// finalCalls returns the calls setting the final state of resources modified by the recommendation
+// applied with config, keyed by their operations. Operations whose state is overwritten by later operations,
+// e.g. stopping the instance started again later, and operations skipped with config are left out.
+// Deleting disks is replaced by labeling them for deletion with WithSoftDelete option.
+func finalCalls(rec *gcloudRecommendation, config *applyConfig) (map[*gcloudOperation]*OperationCall, error) {
+	operations := make(map[string]*gcloudOperation)
+	result := make(map[*gcloudOperation]*OperationCall)
+	for _, group := range rec.Content.OperationGroups {
+		for _, operation := range group.Operations {
+			if operation.Action == "test" || operation.Action == "add" {
+				continue
+			}
+			if config.leaveStopped && isStartOperation(operation) {
+				continue
+			}
+			call, err := planOperation(operation, nil)
+			if err != nil {
+				return nil, err
+			}
+			if config.gracePeriod > 0 && call.Method == deleteDiskMethod {
+				call = softDeleteCall(call, time.Now().Add(config.gracePeriod))
+			}
+			// the machine type, the tier and roles of IAM members are set independently of the status
+			aspect := ""
+			switch call.Method {
+			case changeMachineTypeMethod:
+				aspect = "/machineType"
+			case changeSQLInstanceTierMethod:
+				aspect = "/settings/tier"
+			case addIAMPolicyMemberMethod, removeIAMPolicyMemberMethod:
+				aspect = call.Argument
+			}
+			key := fmt.Sprintf("%s/%s/%s %s", call.Project, call.Zone, call.Resource, aspect)
+			if previous, ok := operations[key]; ok {
+				delete(result, previous)
+			}
+			operations[key] = operation
+			result[operation] = call
+		}
+	}
+	return result, nil
+}
+
+// verifyCall returns the regression if the resource is no longer in the state set by the call.
+func verifyCall(ctx context.Context, service GoogleService, call *OperationCall) (string, error) {
+	switch call.Method {
+	case changeMachineTypeMethod, startInstanceMethod, stopInstanceMethod:
+		instance, err := service.GetInstance(ctx, call.Project, call.Zone, call.Resource)
+		if err != nil {
+			return "", err
+		}
+		if call.Method == changeMachineTypeMethod && lastPathElement(instance.MachineType) != call.Argument {
+			return fmt.Sprintf("instance %s has machine type %s instead of %s",
+				call.Resource, lastPathElement(instance.MachineType), call.Argument), nil
+		}
+		if call.Method == stopInstanceMethod && instance.Status != "TERMINATED" {
+			return fmt.Sprintf("instance %s is %s instead of TERMINATED", call.Resource, instance.Status), nil
+		}
+		if call.Method == startInstanceMethod && instance.Status != "RUNNING" {
+			return fmt.Sprintf("instance %s is %s instead of RUNNING", call.Resource, instance.Status), nil
+		}
+	case deleteDiskMethod:
+		_, err := service.GetDisk(ctx, call.Project, call.Zone, call.Resource)
+		if err == nil {
+			return fmt.Sprintf("disk %s exists again", call.Resource), nil
+		}
+		if !isNotFound(err) {
+			return "", err
+		}
+	case labelForDeletionMethod:
+		disk, err := service.GetDisk(ctx, call.Project, call.Zone, call.Resource)
+		if isNotFound(err) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, ok := disk.Labels[DeleteAfterLabel]; !ok {
+			return fmt.Sprintf("disk %s is no longer labeled for deletion", call.Resource), nil
+		}
+	case changeSQLInstanceTierMethod, stopSQLInstanceMethod:
+		instance, err := service.GetSQLInstance(ctx, call.Project, call.Resource)
+		if err != nil {
+			return "", err
+		}
+		path, want := "/settings/activationPolicy", sqlStoppedActivationPolicy
+		if call.Method == changeSQLInstanceTierMethod {
+			path, want = "/settings/tier", call.Argument
+		}
+		got, err := sqlInstanceValue(instance, path)
+		if err != nil {
+			return "", err
+		}
+		if got != want {
+			return fmt.Sprintf("Cloud SQL instance %s has %s %s instead of %s", call.Resource, path, got, want), nil
+		}
+	case addIAMPolicyMemberMethod, removeIAMPolicyMemberMethod:
+		policy, err := service.GetProjectIAMPolicy(ctx, call.Project)
+		if err != nil {
+			return "", err
+		}
+		if has := hasIAMPolicyMember(policy, call.Resource, call.Argument); has != (call.Method == addIAMPolicyMemberMethod) {
+			if has {
+				return fmt.Sprintf("%s has role %s again", call.Resource, call.Argument), nil
+			}
+			return fmt.Sprintf("%s doesn't have role %s", call.Resource, call.Argument), nil
+		}
+	case deleteRegionalDiskMethod:
+		_, err := service.GetRegionalDisk(ctx, call.Project, call.Zone, call.Resource)
+		if err == nil {
+			return fmt.Sprintf("disk %s exists again", call.Resource), nil
+		}
+		if !isNotFound(err) {
+			return "", err
+		}
+	case deleteImageMethod:
+		_, err := service.GetImage(ctx, call.Project, call.Resource)
+		if err == nil {
+			return fmt.Sprintf("image %s exists again", call.Resource), nil
+		}
+		if !isNotFound(err) {
+			return "", err
+		}
+	case deleteInstanceMethod:
+		_, err := service.GetInstance(ctx, call.Project, call.Zone, call.Resource)
+		if err == nil {
+			return fmt.Sprintf("instance %s exists again", call.Resource), nil
+		}
+		if !isNotFound(err) {
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// VerifyApplied checks that the recommendation applied some time ago wasn't emitted again
+// and that resources are still in the final state the recommendation set them to.
+// It is meant to be scheduled by the caller, for example a few hours after Apply succeeded.
+// options should be the options the recommendation was applied with, WithSoftDelete and WithLeaveStopped
+// change the expected state, e.g. soft deleted disks are expected to exist until they expire.
+// The snapshots created by the recommendation are not checked, because their names are random.
+// At most one of returned values will be non-nil.
+func VerifyApplied(ctx context.Context, service GoogleService, rec *gcloudRecommendation, options ...ApplyOption) (*Verification, error) {
+	calls, err := finalCalls(rec, newApplyConfig(options))
+	if err != nil {
+		return nil, err
+	}
+	verification := &Verification{Recommendation: rec.Name}
+	current, err := service.GetRecommendation(ctx, rec.Name)
+	if err != nil && !isNotFound(err) {
+		return nil, err
+	}
+	if err == nil && current.StateInfo != nil && current.StateInfo.State == "ACTIVE" {
+		verification.Regressions = append(verification.Regressions, "recommendation is active again")
+	}
+
+	for _, group := range rec.Content.OperationGroups {
+		for _, operation := range group.Operations {
+			call, ok := calls[operation]
+			if !ok {
+				continue
+			}
+			regression, err := verifyCall(ctx, service, call)
+			if err != nil {
+				return nil, err
+			}
+			if regression != "" {
+				verification.Regressions = append(verification.Regressions, regression)
+			}
+		}
+	}
+	return verification, nil
+}
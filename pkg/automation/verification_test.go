@@ -0,0 +1,152 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package automation
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+)
+
+type mockVerificationService struct {
+	GoogleService
+	state    string
+	instance *compute.Instance
+	disk     *compute.Disk
+}
+
+func (s *mockVerificationService) GetRecommendation(ctx context.Context, name string) (*gcloudRecommendation, error) {
+	return &gcloudRecommendation{Name: name, StateInfo: &gcloudStateInfo{State: s.state}}, nil
+}
+
+func (s *mockVerificationService) GetInstance(ctx context.Context, project, zone, instance string) (*compute.Instance, error) {
+	if s.instance == nil {
+		return nil, &googleapi.Error{Code: http.StatusNotFound}
+	}
+	return s.instance, nil
+}
+
+func (s *mockVerificationService) GetDisk(ctx context.Context, project, zone, disk string) (*compute.Disk, error) {
+	if s.disk == nil {
+		return nil, &googleapi.Error{Code: http.StatusNotFound}
+	}
+	return s.disk, nil
+}
+
+func TestVerifyApplied(t *testing.T) {
+	service := &mockVerificationService{
+		state:    "SUCCEEDED",
+		instance: &compute.Instance{MachineType: "zones/us-east1-b/machineTypes/custom-2-5120", Status: "RUNNING"},
+	}
+	verification, err := VerifyApplied(context.Background(), service, machineTypeRecommendation())
+	if assert.NoError(t, err) {
+		assert.True(t, verification.Passed())
+	}
+
+	service.state = "ACTIVE"
+	service.instance = &compute.Instance{MachineType: "zones/us-east1-b/machineTypes/n1-standard-4", Status: "RUNNING"}
+	verification, err = VerifyApplied(context.Background(), service, machineTypeRecommendation())
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{
+			"recommendation is active again",
+			"instance alicja-test has machine type n1-standard-4 instead of custom-2-5120",
+		}, verification.Regressions)
+	}
+}
+
+func TestVerifyAppliedDisk(t *testing.T) {
+	rec, err := ParseRecommendation([]byte(diskRecommendationJSON))
+	if !assert.NoError(t, err) {
+		return
+	}
+	service := &mockVerificationService{state: "SUCCEEDED"}
+	verification, err := VerifyApplied(context.Background(), service, rec)
+	if assert.NoError(t, err) {
+		assert.True(t, verification.Passed(), "Deleted disk should not be found")
+	}
+
+	service.disk = &compute.Disk{}
+	verification, err = VerifyApplied(context.Background(), service, rec)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"disk krzysztofk2 exists again"}, verification.Regressions)
+	}
+}
+
+func TestVerifyAppliedFinalState(t *testing.T) {
+	rec := makeRecommendation(applyRecName, 1,
+		&gcloudOperation{Action: "replace", Path: "/status", Resource: applyInstance, ResourceType: instanceResourceType, Value: "TERMINATED"},
+		&gcloudOperation{Action: "replace", Path: "/machineType", Resource: applyInstance, ResourceType: instanceResourceType,
+			Value: "zones/us-east1-b/machineTypes/custom-2-5120"},
+		&gcloudOperation{Action: "replace", Path: "/status", Resource: applyInstance, ResourceType: instanceResourceType, Value: "RUNNING"})
+	service := &mockVerificationService{
+		state:    "SUCCEEDED",
+		instance: &compute.Instance{MachineType: "zones/us-east1-b/machineTypes/custom-2-5120", Status: "RUNNING"},
+	}
+	verification, err := VerifyApplied(context.Background(), service, rec)
+	if assert.NoError(t, err) {
+		assert.True(t, verification.Passed(), "Only the final status should be checked, got %v", verification.Regressions)
+	}
+	verification, err = VerifyApplied(context.Background(), service, rec, WithLeaveStopped())
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"instance alicja-test is RUNNING instead of TERMINATED"}, verification.Regressions)
+	}
+
+	service.instance.Status = "TERMINATED"
+	verification, err = VerifyApplied(context.Background(), service, rec, WithLeaveStopped())
+	if assert.NoError(t, err) {
+		assert.True(t, verification.Passed(), "Skipped start should not be checked, got %v", verification.Regressions)
+	}
+}
+
+func TestVerifyAppliedSoftDelete(t *testing.T) {
+	rec, err := ParseRecommendation([]byte(diskRecommendationJSON))
+	if !assert.NoError(t, err) {
+		return
+	}
+	service := &mockVerificationService{state: "SUCCEEDED", disk: &compute.Disk{Labels: map[string]string{DeleteAfterLabel: "1600000000"}}}
+	verification, err := VerifyApplied(context.Background(), service, rec, WithSoftDelete(time.Hour))
+	if assert.NoError(t, err) {
+		assert.True(t, verification.Passed(), "Soft deleted disk should exist until it expires, got %v", verification.Regressions)
+	}
+
+	service.disk = &compute.Disk{}
+	verification, err = VerifyApplied(context.Background(), service, rec, WithSoftDelete(time.Hour))
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"disk krzysztofk2 is no longer labeled for deletion"}, verification.Regressions)
+	}
+}
+
+func TestVerifyAppliedInstanceDeletion(t *testing.T) {
+	rec := makeRecommendation(applyRecName, 1,
+		&gcloudOperation{Action: "remove", Path: "/", Resource: applyInstance, ResourceType: instanceResourceType})
+	service := &mockVerificationService{state: "SUCCEEDED"}
+	verification, err := VerifyApplied(context.Background(), service, rec)
+	if assert.NoError(t, err) {
+		assert.True(t, verification.Passed(), "Deleted instance should not be found")
+	}
+
+	service.instance = &compute.Instance{}
+	verification, err = VerifyApplied(context.Background(), service, rec)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []string{"instance alicja-test exists again"}, verification.Regressions)
+	}
+}
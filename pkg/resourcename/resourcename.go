@@ -0,0 +1,121 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package resourcename parses names of Compute Engine resources used by recommendations,
+// e.g. "//compute.googleapis.com/projects/p/zones/z/instances/i".
+package resourcename
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Scopes of resources.
+const (
+	ZoneScope   = "zones"
+	RegionScope = "regions"
+	GlobalScope = "global"
+)
+
+// prefixes of names accepted by Parse, removed before parsing
+var prefixes = []string{
+	"//compute.googleapis.com/",
+	"https://www.googleapis.com/compute/v1/",
+	"https://compute.googleapis.com/compute/v1/",
+}
+
+// Name is the parsed name of the resource.
+// Scope is one of ZoneScope, RegionScope and GlobalScope,
+// Location is the zone or the region of the resource, empty for global resources.
+// ResourceType is the collection of the resource, e.g. "instances" or "disks".
+type Name struct {
+	Project      string
+	Scope        string
+	Location     string
+	ResourceType string
+	Name         string
+}
+
+// String returns the relative name of the resource, e.g. "projects/p/zones/z/instances/i".
+func (n *Name) String() string {
+	if n.Scope == GlobalScope {
+		return fmt.Sprintf("projects/%s/global/%s/%s", n.Project, n.ResourceType, n.Name)
+	}
+	return fmt.Sprintf("projects/%s/%s/%s/%s/%s", n.Project, n.Scope, n.Location, n.ResourceType, n.Name)
+}
+
+// Error is returned by Parse for malformed names, Reason describes the problem.
+type Error struct {
+	Name   string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("malformed resource name %q: %s", e.Name, e.Reason)
+}
+
+// Parse parses the full resource name, the self link or the relative name of the resource,
+// e.g. "//compute.googleapis.com/projects/p/regions/r/disks/d", "https://www.googleapis.com/compute/v1/projects/p/global/snapshots/s"
+// or "projects/p/zones/z/instances/i".
+// If the name is malformed the returned error is *Error.
+func Parse(name string) (*Name, error) {
+	path := name
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(path, prefix) {
+			path = strings.TrimPrefix(path, prefix)
+			break
+		}
+	}
+	if strings.HasPrefix(path, "//") || strings.Contains(path, "://") {
+		return nil, &Error{name, "unknown service"}
+	}
+	parts := strings.Split(path, "/")
+	for _, part := range parts {
+		if part == "" {
+			return nil, &Error{name, "empty path element"}
+		}
+	}
+	if parts[0] != "projects" {
+		return nil, &Error{name, "must start with projects/"}
+	}
+	if len(parts) < 2 {
+		return nil, &Error{name, "missing project"}
+	}
+	if len(parts) < 3 {
+		return nil, &Error{name, "missing zones/, regions/ or global/ after the project"}
+	}
+
+	result := &Name{Project: parts[1], Scope: parts[2]}
+	var rest []string
+	switch result.Scope {
+	case ZoneScope, RegionScope:
+		if len(parts) < 4 {
+			return nil, &Error{name, "missing location"}
+		}
+		result.Location = parts[3]
+		rest = parts[4:]
+	case GlobalScope:
+		rest = parts[3:]
+	default:
+		return nil, &Error{name, fmt.Sprintf("unknown scope %s, expected zones, regions or global", result.Scope)}
+	}
+	if len(rest) != 2 {
+		return nil, &Error{name, "expected resource type and name after the location"}
+	}
+	result.ResourceType = rest[0]
+	result.Name = rest[1]
+	return result, nil
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2020 Google LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    https://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resourcename
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		want Name
+	}{
+		{"//compute.googleapis.com/projects/rightsizer-test/zones/us-east1-b/instances/alicja-test",
+			Name{"rightsizer-test", ZoneScope, "us-east1-b", "instances", "alicja-test"}},
+		{"https://www.googleapis.com/compute/v1/projects/p/regions/europe-west1/disks/d",
+			Name{"p", RegionScope, "europe-west1", "disks", "d"}},
+		{"projects/p/global/snapshots/s", Name{"p", GlobalScope, "", "snapshots", "s"}},
+	} {
+		name, err := Parse(test.name)
+		if assert.NoError(t, err, "Name %s should be parsed", test.name) {
+			assert.Equal(t, test.want, *name)
+		}
+	}
+}
+
+func TestParseString(t *testing.T) {
+	for _, relative := range []string{"projects/p/zones/z/instances/i", "projects/p/global/images/i"} {
+		name, err := Parse("//compute.googleapis.com/" + relative)
+		if assert.NoError(t, err) {
+			assert.Equal(t, relative, name.String())
+		}
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		reason string
+	}{
+		{"//storage.googleapis.com/b/o", "unknown service"},
+		{"instances/i", "must start with projects/"},
+		{"projects/p", "missing zones/, regions/ or global/ after the project"},
+		{"projects/p/zones/z/instances/i/extra", "expected resource type and name after the location"},
+		{"projects/p/zones//instances/i", "empty path element"},
+		{"projects/p/locations/l/instances/i", "unknown scope locations, expected zones, regions or global"},
+	} {
+		_, err := Parse(test.name)
+		var nameErr *Error
+		if assert.True(t, errors.As(err, &nameErr), "Name %s should be malformed", test.name) {
+			assert.Equal(t, test.reason, nameErr.Reason)
+		}
+	}
+	_, err := Parse("projects/p")
+	assert.EqualError(t, err, `malformed resource name "projects/p": missing zones/, regions/ or global/ after the project`)
+}